@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/GameXost/wbTestCase/internal/repository/cache"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// прогоняет лог обращений к заказам через все политики кэша и печатает hit ratio,
+// чтобы CACHE_SIZE и CACHE_POLICY выбирались по данным, а не наугад
+func main() {
+	logPath := flag.String("log", "-", "access log: one order_uid per line or chi request log lines, - for stdin")
+	policiesFlag := flag.String("policies", strings.Join(cache.Policies, ","), "comma separated cache policies")
+	sizesFlag := flag.String("sizes", "10,100,1000,10000", "comma separated cache capacities")
+	flag.Parse()
+
+	sizes, err := parseSizes(*sizesFlag)
+	if err != nil {
+		log.Fatalf("bad -sizes: %v", err)
+	}
+	policies := strings.Split(*policiesFlag, ",")
+
+	uids, err := readLog(*logPath)
+	if err != nil {
+		log.Fatalf("failed to read access log: %v", err)
+	}
+	if len(uids) == 0 {
+		log.Fatal("access log is empty")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "policy\tsize\trequests\thits\thit ratio")
+	for _, size := range sizes {
+		for _, name := range policies {
+			hits, err := replay(name, size, uids)
+			if err != nil {
+				log.Fatalf("replay %s: %v", name, err)
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.2f%%\n", name, size, len(uids), hits, 100*float64(hits)/float64(len(uids)))
+		}
+	}
+	if err = w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// replay ведет себя как service.GetOrder: промах в кэше - заказ "грузится из бд" и кладется в кэш
+func replay(policyName string, size uint64, uids []string) (int, error) {
+	policy, err := cache.NewPolicy(policyName, size)
+	if err != nil {
+		return 0, err
+	}
+	c := cache.NewCacheWithPolicy(size, policy)
+	hits := 0
+	for _, uid := range uids {
+		if _, has := c.Get(uid); has {
+			hits++
+			continue
+		}
+		c.Set(&models.Order{OrderUId: uid})
+	}
+	return hits, nil
+}
+
+func readLog(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		r = f
+	}
+
+	var uids []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if uid := parseUID(scanner.Text()); uid != "" {
+			uids = append(uids, uid)
+		}
+	}
+	return uids, scanner.Err()
+}
+
+// parseUID понимает голый uid и строку лога chi вида "GET http://host/order/<uid> HTTP/1.1"
+func parseUID(line string) string {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ""
+	}
+	if idx := strings.Index(line, "/order/"); idx >= 0 {
+		uid := line[idx+len("/order/"):]
+		if end := strings.IndexAny(uid, " \"?"); end >= 0 {
+			uid = uid[:end]
+		}
+		return uid
+	}
+	if strings.ContainsAny(line, " \t") {
+		return ""
+	}
+	return line
+}
+
+func parseSizes(s string) ([]uint64, error) {
+	var sizes []uint64
+	for _, part := range strings.Split(s, ",") {
+		size, err := strconv.ParseUint(strings.TrimSpace(part), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if size == 0 {
+			return nil, fmt.Errorf("cache size must be positive")
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/chaos"
+	"io"
+	"slices"
+	"text/tabwriter"
+)
+
+// вердикт по строке манифеста
+const (
+	verdictOK      = "ok"
+	verdictWrong   = "wrong"
+	verdictPending = "pending" // консьюмер до записи еще не дошел
+	verdictSkipped = "skipped" // запись не доехала до брокера
+)
+
+var verdicts = []string{verdictOK, verdictWrong, verdictPending, verdictSkipped}
+
+// position - где запись лежала в исходном топике, по ней dlq связывается с манифестом
+type position struct {
+	topic     string
+	partition int32
+	offset    int64
+}
+
+// observed - что консьюмер успел сделать: причины dlq по исходной позиции и транзакции сохраненных заказов по uid
+type observed struct {
+	dlq    map[position]string
+	orders map[string]string
+}
+
+type result struct {
+	entry   chaos.Entry
+	verdict string
+	detail  string
+}
+
+// check сверяет каждую отправленную запись с dlq и бд
+func check(entries []chaos.Entry, obs observed) []result {
+	results := make([]result, 0, len(entries))
+	for _, e := range entries {
+		verdict, detail := judge(e, obs)
+		results = append(results, result{entry: e, verdict: verdict, detail: detail})
+	}
+	return results
+}
+
+func judge(e chaos.Entry, obs observed) (string, string) {
+	if e.Error != "" {
+		return verdictSkipped, e.Error
+	}
+	reason, dead := obs.dlq[position{topic: e.Topic, partition: e.Partition, offset: e.Offset}]
+	transaction, saved := obs.orders[e.OrderUID]
+	saved = saved && e.OrderUID != ""
+
+	switch e.Expect {
+	case chaos.ExpectDeadLetter:
+		switch {
+		case dead && reason == e.Reason:
+			return verdictOK, ""
+		case dead:
+			return verdictWrong, fmt.Sprintf("dead-lettered as %s, want %s", reason, e.Reason)
+		case saved:
+			// uid битых записей свежие, сохраниться под ним могла только сама запись
+			return verdictWrong, "persisted instead of dead-lettered"
+		}
+		return verdictPending, ""
+	case chaos.ExpectPersisted, chaos.ExpectDuplicate:
+		switch {
+		case dead:
+			return verdictWrong, "dead-lettered as " + reason
+		case saved && transaction == e.Transaction:
+			return verdictOK, ""
+		case saved:
+			return verdictWrong, fmt.Sprintf("db has transaction %s, want %s", transaction, e.Transaction)
+		}
+		return verdictPending, ""
+	}
+	return verdictWrong, "unknown expectation " + e.Expect
+}
+
+// сколько неверных записей показывать в отчете
+const wrongShown = 20
+
+// report печатает вердикты по видам записей и первые неверные, возвращает сколько неверных
+func report(w io.Writer, results []result) int {
+	byKind := make(map[string]map[string]int)
+	var wrong []result
+	for _, r := range results {
+		if byKind[r.entry.Kind] == nil {
+			byKind[r.entry.Kind] = make(map[string]int)
+		}
+		byKind[r.entry.Kind][r.verdict]++
+		if r.verdict == verdictWrong {
+			wrong = append(wrong, r)
+		}
+	}
+	kinds := make([]string, 0, len(byKind))
+	for kind := range byKind {
+		kinds = append(kinds, kind)
+	}
+	slices.Sort(kinds)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "kind\tok\twrong\tpending\tskipped")
+	total := make(map[string]int)
+	for _, kind := range kinds {
+		_, _ = fmt.Fprint(tw, kind)
+		for _, v := range verdicts {
+			_, _ = fmt.Fprintf(tw, "\t%d", byKind[kind][v])
+			total[v] += byKind[kind][v]
+		}
+		_, _ = fmt.Fprintln(tw)
+	}
+	_, _ = fmt.Fprint(tw, "total")
+	for _, v := range verdicts {
+		_, _ = fmt.Fprintf(tw, "\t%d", total[v])
+	}
+	_, _ = fmt.Fprintln(tw)
+	_ = tw.Flush()
+
+	if total[verdictPending] > 0 {
+		_, _ = fmt.Fprintln(w, "\npending records are not handled yet: let the consumer catch up and run the check again")
+	}
+	if len(wrong) > 0 {
+		_, _ = fmt.Fprintln(w)
+	}
+	for _, r := range wrong[:min(len(wrong), wrongShown)] {
+		e := r.entry
+		_, _ = fmt.Fprintf(w, "%s/%d@%d %s (uid %q): %s\n", e.Topic, e.Partition, e.Offset, e.Kind, e.OrderUID, r.detail)
+	}
+	if len(wrong) > wrongShown {
+		_, _ = fmt.Fprintf(w, "... and %d more\n", len(wrong)-wrongShown)
+	}
+	return len(wrong)
+}
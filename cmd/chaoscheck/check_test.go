@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/GameXost/wbTestCase/internal/chaos"
+	"github.com/GameXost/wbTestCase/internal/kafka"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"testing"
+)
+
+func TestJudge(t *testing.T) {
+	at := func(offset int64) chaos.Entry {
+		return chaos.Entry{Topic: "orders", Partition: 1, Offset: offset}
+	}
+	obs := observed{
+		dlq: map[position]string{
+			{topic: "orders", partition: 1, offset: 10}: kafka.ReasonInvalidJSON,
+			{topic: "orders", partition: 1, offset: 11}: kafka.ReasonValidation,
+		},
+		orders: map[string]string{"saved": "tx-1"},
+	}
+	tests := []struct {
+		name    string
+		entry   func(e chaos.Entry) chaos.Entry
+		offset  int64
+		verdict string
+	}{
+		{"dead letter with the right reason", func(e chaos.Entry) chaos.Entry {
+			e.Expect, e.Reason = chaos.ExpectDeadLetter, kafka.ReasonInvalidJSON
+			return e
+		}, 10, verdictOK},
+		{"dead letter with another reason", func(e chaos.Entry) chaos.Entry {
+			e.Expect, e.Reason = chaos.ExpectDeadLetter, kafka.ReasonInvalidJSON
+			return e
+		}, 11, verdictWrong},
+		{"broken order persisted", func(e chaos.Entry) chaos.Entry {
+			e.Expect, e.Reason, e.OrderUID = chaos.ExpectDeadLetter, kafka.ReasonValidation, "saved"
+			return e
+		}, 12, verdictWrong},
+		{"dead letter not reached yet", func(e chaos.Entry) chaos.Entry {
+			e.Expect, e.Reason = chaos.ExpectDeadLetter, kafka.ReasonValidation
+			return e
+		}, 12, verdictPending},
+		{"persisted", func(e chaos.Entry) chaos.Entry {
+			e.Expect, e.OrderUID, e.Transaction = chaos.ExpectPersisted, "saved", "tx-1"
+			return e
+		}, 12, verdictOK},
+		{"duplicate kept the first version", func(e chaos.Entry) chaos.Entry {
+			e.Expect, e.OrderUID, e.Transaction = chaos.ExpectDuplicate, "saved", "tx-1"
+			return e
+		}, 12, verdictOK},
+		{"duplicate overwrote the order", func(e chaos.Entry) chaos.Entry {
+			e.Expect, e.OrderUID, e.Transaction = chaos.ExpectDuplicate, "saved", "tx-2"
+			return e
+		}, 12, verdictWrong},
+		{"valid order dead-lettered", func(e chaos.Entry) chaos.Entry {
+			e.Expect, e.OrderUID, e.Transaction = chaos.ExpectPersisted, "saved", "tx-1"
+			return e
+		}, 11, verdictWrong},
+		{"valid order not reached yet", func(e chaos.Entry) chaos.Entry {
+			e.Expect, e.OrderUID, e.Transaction = chaos.ExpectPersisted, "other", "tx-3"
+			return e
+		}, 12, verdictPending},
+		{"not delivered", func(e chaos.Entry) chaos.Entry {
+			e.Expect, e.Error = chaos.ExpectPersisted, "kafka produce error: timeout"
+			return e
+		}, 12, verdictSkipped},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict, detail := judge(tt.entry(at(tt.offset)), obs)
+			assert.Equal(t, tt.verdict, verdict, detail)
+		})
+	}
+}
+
+func TestDeadLetterHeaders(t *testing.T) {
+	pos, reason, ok := deadLetter(&kgo.Record{Headers: []kgo.RecordHeader{
+		{Key: kafka.HeaderOriginalTopic, Value: []byte("orders")},
+		{Key: kafka.HeaderOriginalPartition, Value: []byte("2")},
+		{Key: kafka.HeaderOriginalOffset, Value: []byte("41")},
+		{Key: kafka.HeaderReason, Value: []byte(kafka.ReasonMissingUID)},
+	}})
+	require.True(t, ok)
+	assert.Equal(t, position{topic: "orders", partition: 2, offset: 41}, pos)
+	assert.Equal(t, kafka.ReasonMissingUID, reason)
+
+	_, _, ok = deadLetter(&kgo.Record{Headers: []kgo.RecordHeader{{Key: kafka.HeaderReason, Value: []byte("validation")}}})
+	assert.False(t, ok, "records without the original position can not be matched")
+}
+
+type fakeLoader struct {
+	orders map[string]*models.Order
+	calls  [][]string
+}
+
+func (f *fakeLoader) GetFullOrdersOnIds(_ context.Context, ids []string) ([]*models.Order, error) {
+	f.calls = append(f.calls, ids)
+	var orders []*models.Order
+	for _, id := range ids {
+		if order, has := f.orders[id]; has {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+func TestLoadTransactions(t *testing.T) {
+	saved := &models.Order{OrderUId: "a", Payment: models.Payment{Transaction: "tx-a"}}
+	loader := &fakeLoader{orders: map[string]*models.Order{"a": saved}}
+	entries := []chaos.Entry{{OrderUID: "a"}, {OrderUID: "a"}, {OrderUID: ""}, {OrderUID: "b"}}
+
+	transactions, err := loadTransactions(context.Background(), loader, entries)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "tx-a"}, transactions)
+	assert.Equal(t, [][]string{{"a", "b"}}, loader.calls, "uids are deduplicated, empty ones skipped")
+}
+
+func TestReport(t *testing.T) {
+	results := []result{
+		{entry: chaos.Entry{Kind: chaos.KindValid}, verdict: verdictOK},
+		{entry: chaos.Entry{Kind: chaos.KindValid}, verdict: verdictPending},
+		{entry: chaos.Entry{Kind: chaos.KindTruncated, OrderUID: "x"}, verdict: verdictWrong, detail: "dead-lettered as validation, want invalid_json"},
+	}
+	var buf bytes.Buffer
+	assert.Equal(t, 1, report(&buf, results))
+	out := buf.String()
+	assert.Contains(t, out, "truncated_json")
+	assert.Contains(t, out, "let the consumer catch up")
+	assert.Contains(t, out, "want invalid_json")
+}
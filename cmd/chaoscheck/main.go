@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/chaos"
+	"github.com/GameXost/wbTestCase/internal/config"
+	"github.com/GameXost/wbTestCase/internal/kafka"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/GameXost/wbTestCase/internal/repository"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// сколько ждать новых записей dlq, прежде чем считать, что топик дочитан
+const pollTimeout = 10 * time.Second
+
+// сколько заказов грузить из бд одним запросом
+const loadBatch = 500
+
+// сверка манифеста продюсера (-manifest) с тем, что сделал консьюмер: что сохранено, что отброшено
+// как дубль, что ушло в dlq и с какой причиной
+func main() {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	manifestPath := flag.String("manifest", "", "NDJSON manifest written by producer -manifest (required)")
+	brokers := flag.String("brokers", strings.Join(cfg.Kafka.Brokers, ","), "comma separated kafka brokers")
+	dlqTopic := flag.String("dlq", cfg.Kafka.DLQTopic, "dead letter topic")
+	flag.Parse()
+	if *manifestPath == "" {
+		log.Fatal("-manifest is required")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	entries, err := chaos.ReadManifest(*manifestPath)
+	if err != nil {
+		log.Fatalf("read manifest: %v", err)
+	}
+	client, err := kgo.NewClient(kgo.SeedBrokers(strings.Split(*brokers, ",")...),
+		kgo.ConsumeTopics(*dlqTopic), kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+	dead, err := scanDLQ(ctx, client, *dlqTopic)
+	if err != nil {
+		log.Fatalf("scan dlq: %v", err)
+	}
+
+	pool, err := pgxpool.New(ctx, cfg.DB.DSN())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+	orders, err := loadTransactions(ctx, repository.NewRepo(pool), entries)
+	if err != nil {
+		log.Fatalf("load orders: %v", err)
+	}
+
+	if wrong := report(os.Stdout, check(entries, observed{dlq: dead, orders: orders})); wrong > 0 {
+		os.Exit(1)
+	}
+}
+
+// scanDLQ дочитывает dlq до текущего конца и запоминает причины по исходной позиции записи
+func scanDLQ(ctx context.Context, client *kgo.Client, topic string) (map[position]string, error) {
+	adm := kadm.NewClient(client)
+	starts, err := adm.ListStartOffsets(ctx, topic)
+	if err != nil {
+		return nil, fmt.Errorf("list start offsets: %w", err)
+	}
+	ends, err := adm.ListEndOffsets(ctx, topic)
+	if err != nil {
+		return nil, fmt.Errorf("list end offsets: %w", err)
+	}
+	remaining := make(map[int32]int64)
+	ends.Each(func(end kadm.ListedOffset) {
+		if start, has := starts.Lookup(topic, end.Partition); has && start.Offset < end.Offset {
+			remaining[end.Partition] = end.Offset
+		}
+	})
+
+	dead := make(map[position]string)
+	for len(remaining) > 0 {
+		pollCtx, cancel := context.WithTimeout(ctx, pollTimeout)
+		fetches := client.PollFetches(pollCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if fetches.Empty() && pollCtx.Err() != nil {
+			log.Printf("no new dlq records for %s, stopping early", pollTimeout)
+			break
+		}
+		for _, fetchErr := range fetches.Errors() {
+			if !errors.Is(fetchErr.Err, context.DeadlineExceeded) {
+				return nil, fmt.Errorf("fetch %s/%d: %w", fetchErr.Topic, fetchErr.Partition, fetchErr.Err)
+			}
+		}
+		for _, record := range fetches.Records() {
+			end, has := remaining[record.Partition]
+			if !has || record.Offset >= end {
+				continue
+			}
+			if record.Offset+1 >= end {
+				delete(remaining, record.Partition)
+			}
+			if pos, reason, ok := deadLetter(record); ok {
+				dead[pos] = reason
+			}
+		}
+	}
+	return dead, nil
+}
+
+// deadLetter достает из заголовков консьюмера исходную позицию и причину
+func deadLetter(record *kgo.Record) (position, string, bool) {
+	var pos position
+	var reason string
+	var hasPartition, hasOffset bool
+	for _, h := range record.Headers {
+		value := string(h.Value)
+		switch h.Key {
+		case kafka.HeaderOriginalTopic:
+			pos.topic = value
+		case kafka.HeaderOriginalPartition:
+			partition, err := strconv.ParseInt(value, 10, 32)
+			pos.partition, hasPartition = int32(partition), err == nil
+		case kafka.HeaderOriginalOffset:
+			offset, err := strconv.ParseInt(value, 10, 64)
+			pos.offset, hasOffset = offset, err == nil
+		case kafka.HeaderReason:
+			reason = value
+		}
+	}
+	return pos, reason, pos.topic != "" && hasPartition && hasOffset
+}
+
+type orderLoader interface {
+	GetFullOrdersOnIds(ctx context.Context, ids []string) ([]*models.Order, error)
+}
+
+// loadTransactions - транзакции сохраненных заказов по uid из манифеста
+func loadTransactions(ctx context.Context, repo orderLoader, entries []chaos.Entry) (map[string]string, error) {
+	uids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.OrderUID != "" {
+			uids = append(uids, e.OrderUID)
+		}
+	}
+	slices.Sort(uids)
+	uids = slices.Compact(uids)
+
+	transactions := make(map[string]string, len(uids))
+	for chunk := range slices.Chunk(uids, loadBatch) {
+		orders, err := repo.GetFullOrdersOnIds(ctx, chunk)
+		if err != nil {
+			return nil, err
+		}
+		for _, order := range orders {
+			transactions[order.OrderUId] = order.Payment.Transaction
+		}
+	}
+	return transactions, nil
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/codec"
+	"github.com/GameXost/wbTestCase/internal/config"
+	"github.com/GameXost/wbTestCase/internal/kafka"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/GameXost/wbTestCase/internal/service"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sr"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// сколько ждать новых записей, прежде чем считать, что топик дочитан
+const pollTimeout = 10 * time.Second
+
+const usage = `usage: dlq <command> [flags]
+
+commands:
+  list    print dead-lettered records with failure reasons
+  show    print headers and payload of one record (-partition, -offset)
+  replay  re-validate and republish records to the orders topic
+
+run "dlq <command> -h" for command flags`
+
+// разбор и переотправка записей из dlq топика
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "list":
+		err = runList(ctx, args)
+	case "show":
+		err = runShow(ctx, args)
+	case "replay":
+		err = runReplay(ctx, args)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type options struct {
+	brokers string
+	topic   string
+}
+
+func (o *options) register(fs *flag.FlagSet, cfg config.KafkaConfig) {
+	fs.StringVar(&o.brokers, "brokers", strings.Join(cfg.Brokers, ","), "comma separated kafka brokers")
+	fs.StringVar(&o.topic, "dlq", cfg.DLQTopic, "dead letter topic")
+}
+
+func (o *options) client(opts ...kgo.Opt) (*kgo.Client, error) {
+	return kgo.NewClient(append([]kgo.Opt{kgo.SeedBrokers(strings.Split(o.brokers, ",")...)}, opts...)...)
+}
+
+// filter отбирает записи по причине, ключу и времени попадания в dlq
+type filter struct {
+	reason string
+	key    string
+	since  timeFlag
+	until  timeFlag
+}
+
+func (f *filter) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.reason, "reason", "", "only records with this dlq.reason (invalid_json, invalid_payload, missing_uid, key_mismatch, validation, persistence)")
+	fs.StringVar(&f.key, "key", "", "only records with this key")
+	fs.Var(&f.since, "since", "only records dead-lettered at or after this RFC3339 time")
+	fs.Var(&f.until, "until", "only records dead-lettered before this RFC3339 time")
+}
+
+func (f *filter) match(r dlqRecord) bool {
+	switch {
+	case f.reason != "" && r.reason != f.reason:
+		return false
+	case f.key != "" && string(r.record.Key) != f.key:
+		return false
+	case !f.since.IsZero() && r.failedAt.Before(f.since.Time):
+		return false
+	case !f.until.IsZero() && !r.failedAt.Before(f.until.Time):
+		return false
+	}
+	return true
+}
+
+type timeFlag struct {
+	time.Time
+}
+
+func (t *timeFlag) String() string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func (t *timeFlag) Set(s string) error {
+	parsed, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
+
+// dlqRecord - запись dlq с разобранными заголовками консьюмера
+type dlqRecord struct {
+	record      *kgo.Record
+	reason      string
+	errText     string
+	violations  string
+	attempts    string
+	contentType string
+	failedAt    time.Time
+}
+
+func decodeRecord(record *kgo.Record) dlqRecord {
+	r := dlqRecord{record: record, failedAt: record.Timestamp}
+	for _, h := range record.Headers {
+		value := string(h.Value)
+		switch h.Key {
+		case kafka.HeaderReason:
+			r.reason = value
+		case kafka.HeaderError:
+			r.errText = value
+		case kafka.HeaderViolations:
+			r.violations = value
+		case kafka.HeaderAttempts:
+			r.attempts = value
+		case codec.HeaderContentType:
+			r.contentType = value
+		case kafka.HeaderFailedAt:
+			if at, err := time.Parse(time.RFC3339Nano, value); err == nil {
+				r.failedAt = at
+			}
+		}
+	}
+	if r.reason == "" {
+		// записи от старых версий консьюмера без заголовков
+		r.reason = "unknown"
+	}
+	return r
+}
+
+// scan читает топик от начала до текущего конца и отдает записи, подходящие под фильтр
+func scan(ctx context.Context, o *options, f *filter, fn func(dlqRecord) error) error {
+	client, err := o.client(
+		kgo.ConsumeTopics(o.topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	adm := kadm.NewClient(client)
+	starts, err := adm.ListStartOffsets(ctx, o.topic)
+	if err != nil {
+		return fmt.Errorf("list start offsets: %w", err)
+	}
+	ends, err := adm.ListEndOffsets(ctx, o.topic)
+	if err != nil {
+		return fmt.Errorf("list end offsets: %w", err)
+	}
+	remaining := make(map[int32]int64)
+	ends.Each(func(end kadm.ListedOffset) {
+		if start, has := starts.Lookup(o.topic, end.Partition); has && start.Offset < end.Offset {
+			remaining[end.Partition] = end.Offset
+		}
+	})
+
+	for len(remaining) > 0 {
+		pollCtx, cancel := context.WithTimeout(ctx, pollTimeout)
+		fetches := client.PollFetches(pollCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if fetches.Empty() && pollCtx.Err() != nil {
+			log.Printf("no new records for %s, stopping early", pollTimeout)
+			return nil
+		}
+		for _, fetchErr := range fetches.Errors() {
+			if !errors.Is(fetchErr.Err, context.DeadlineExceeded) {
+				return fmt.Errorf("fetch %s/%d: %w", fetchErr.Topic, fetchErr.Partition, fetchErr.Err)
+			}
+		}
+		for _, record := range fetches.Records() {
+			end, has := remaining[record.Partition]
+			if !has || record.Offset >= end {
+				continue
+			}
+			if record.Offset+1 >= end {
+				delete(remaining, record.Partition)
+			}
+			if r := decodeRecord(record); f.match(r) {
+				if err = fn(r); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func runList(ctx context.Context, args []string) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	var o options
+	var f filter
+	o.register(fs, cfg.Kafka)
+	f.register(fs)
+	_ = fs.Parse(args)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "partition\toffset\tkey\treason\tattempts\tfailed at\tdetails")
+	byReason := make(map[string]int)
+	err = scan(ctx, &o, &f, func(r dlqRecord) error {
+		byReason[r.reason]++
+		details := r.violations
+		if details == "" {
+			details = r.errText
+		}
+		_, err := fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\t%s\t%s\n", r.record.Partition, r.record.Offset, r.record.Key,
+			r.reason, r.attempts, r.failedAt.UTC().Format(time.RFC3339), truncate(details, 100))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+
+	reasons := make([]string, 0, len(byReason))
+	total := 0
+	for reason, n := range byReason {
+		reasons = append(reasons, reason)
+		total += n
+	}
+	sort.Strings(reasons)
+	fmt.Printf("\n%d records", total)
+	for _, reason := range reasons {
+		fmt.Printf(", %s: %d", reason, byReason[reason])
+	}
+	fmt.Println()
+	return nil
+}
+
+func runShow(ctx context.Context, args []string) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+	var o options
+	o.register(fs, cfg.Kafka)
+	partition := fs.Int("partition", 0, "record partition")
+	offset := fs.Int64("offset", -1, "record offset")
+	_ = fs.Parse(args)
+	if *offset < 0 {
+		return errors.New("-offset is required")
+	}
+
+	client, err := o.client(kgo.ConsumePartitions(map[string]map[int32]kgo.Offset{
+		o.topic: {int32(*partition): kgo.NewOffset().At(*offset)},
+	}))
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	pollCtx, cancel := context.WithTimeout(ctx, pollTimeout)
+	defer cancel()
+	for {
+		fetches := client.PollFetches(pollCtx)
+		if pollCtx.Err() != nil {
+			return fmt.Errorf("record %d/%d not found", *partition, *offset)
+		}
+		for _, record := range fetches.Records() {
+			if record.Offset == *offset {
+				printRecord(record)
+				return nil
+			}
+			if record.Offset > *offset {
+				return fmt.Errorf("record %d/%d not found", *partition, *offset)
+			}
+		}
+	}
+}
+
+func printRecord(record *kgo.Record) {
+	fmt.Printf("topic:     %s\npartition: %d\noffset:    %d\nkey:       %s\ntimestamp: %s\n\nheaders:\n",
+		record.Topic, record.Partition, record.Offset, record.Key, record.Timestamp.UTC().Format(time.RFC3339Nano))
+	for _, h := range record.Headers {
+		fmt.Printf("  %s: %s\n", h.Key, h.Value)
+	}
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, record.Value, "", "  "); err != nil {
+		fmt.Printf("\nvalue (not json: %v):\n%s\n", err, record.Value)
+		return
+	}
+	fmt.Printf("\nvalue:\n%s\n", pretty.String())
+}
+
+func runReplay(ctx context.Context, args []string) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	var o options
+	var f filter
+	o.register(fs, cfg.Kafka)
+	f.register(fs)
+	target := fs.String("target", cfg.Kafka.Topic, "topic to republish records to")
+	patchPath := fs.String("patch", "", "JSON Patch (RFC 6902) file applied to every record before validation; protobuf and avro records are patched and replayed as json")
+	registryURL := fs.String("registry", cfg.Kafka.SchemaRegistryURL, "schema registry url to decode protobuf and avro records")
+	dryRun := fs.Bool("dry-run", false, "only print what would be replayed")
+	statePath := fs.String("state", "dlq-replay-state.ndjson", "file with already replayed records")
+	_ = fs.Parse(args)
+
+	var patch jsonPatch
+	if *patchPath != "" {
+		if patch, err = loadPatch(*patchPath); err != nil {
+			return err
+		}
+	}
+	state, err := loadReplayState(*statePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := state.close(); err != nil {
+			log.Printf("replay state: %v", err)
+		}
+	}()
+	var registry *sr.Client
+	if *registryURL != "" {
+		if registry, err = sr.NewClient(sr.URLs(*registryURL)); err != nil {
+			return fmt.Errorf("schema registry client: %w", err)
+		}
+	}
+	decoder := codec.NewDecoder(registry)
+	producer, err := o.client(kgo.RequiredAcks(kgo.AllISRAcks()))
+	if err != nil {
+		return err
+	}
+	defer producer.Close()
+
+	var matched, replayed, already, invalid int
+	err = scan(ctx, &o, &f, func(r dlqRecord) error {
+		matched++
+		id := recordID(r.record.Topic, r.record.Partition, r.record.Offset)
+		if state.has(id) {
+			already++
+			return nil
+		}
+		value, contentType, order, err := prepare(ctx, decoder, r.contentType, r.record.Value, patch)
+		if errors.Is(err, codec.ErrRegistryUnavailable) {
+			// запись тут ни при чем, дальше будет то же самое
+			return fmt.Errorf("decode %s: %w", id, err)
+		}
+		if err != nil {
+			invalid++
+			log.Printf("skip %s: %v", id, err)
+			return nil
+		}
+		if *dryRun {
+			replayed++
+			log.Printf("would replay %s as order %s", id, order.OrderUId)
+			return nil
+		}
+
+		// ключ по той же стратегии, что у продюсера, иначе консьюмер не примет запись
+		key, err := kafka.OrderKey(cfg.Kafka.KeyStrategy, order)
+		if err != nil {
+			return err
+		}
+		record := &kgo.Record{
+			Topic:   *target,
+			Key:     []byte(key),
+			Value:   value,
+			Headers: replayHeaders(r.record, id, contentType),
+		}
+		if err = producer.ProduceSync(ctx, record).FirstErr(); err != nil {
+			return fmt.Errorf("republish %s: %w", id, err)
+		}
+		replayed++
+		return state.mark(id)
+	})
+	verb := "replayed"
+	if *dryRun {
+		verb = "would replay"
+	}
+	log.Printf("matched %d, %s %d, already replayed %d, still invalid %d", matched, verb, replayed, already, invalid)
+	return err
+}
+
+// prepare разбирает запись по content-type тем же декодером, что и консьюмер, применяет патч и проверяет заказ.
+// Возвращает значение и content-type для переотправки: патч - это JSON Patch, поэтому protobuf и avro
+// с патчем уходят уже json, без патча - как были
+func prepare(ctx context.Context, decoder *codec.Decoder, contentType string, value []byte, patch jsonPatch) ([]byte, string, *models.Order, error) {
+	if codec.Format(contentType) != codec.FormatJSON {
+		order, err := decoder.Decode(ctx, contentType, value)
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("invalid payload: %w", err)
+		}
+		if patch == nil {
+			if err = service.ValidateOrder(order); err != nil {
+				return nil, "", nil, fmt.Errorf("still invalid: %w", err)
+			}
+			return value, contentType, order, nil
+		}
+		if value, err = json.Marshal(order); err != nil {
+			return nil, "", nil, err
+		}
+		contentType = codec.ContentTypeJSON
+	}
+	if patch != nil {
+		var err error
+		if value, err = patch.apply(value); err != nil {
+			return nil, "", nil, err
+		}
+	}
+	var order models.Order
+	if err := json.Unmarshal(value, &order); err != nil {
+		return nil, "", nil, fmt.Errorf("invalid json: %w", err)
+	}
+	if err := service.ValidateOrder(&order); err != nil {
+		return nil, "", nil, fmt.Errorf("still invalid: %w", err)
+	}
+	return value, contentType, &order, nil
+}
+
+// replayHeaders - исходные заголовки без dlq.*, content-type переотправляемого значения и ссылка на запись в dlq
+func replayHeaders(record *kgo.Record, id, contentType string) []kgo.RecordHeader {
+	headers := make([]kgo.RecordHeader, 0, len(record.Headers)+2)
+	for _, h := range record.Headers {
+		if !strings.HasPrefix(h.Key, "dlq.") && h.Key != codec.HeaderContentType {
+			headers = append(headers, h)
+		}
+	}
+	if contentType != "" {
+		headers = append(headers, kgo.RecordHeader{Key: codec.HeaderContentType, Value: []byte(contentType)})
+	}
+	return append(headers, kgo.RecordHeader{Key: kafka.HeaderReplayedFrom, Value: []byte(id)})
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
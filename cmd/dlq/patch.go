@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// jsonPatch - JSON Patch (RFC 6902): add, remove, replace, move, copy, test
+type jsonPatch []patchOp
+
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+var errPatchPath = errors.New("path does not exist")
+
+func loadPatch(path string) (jsonPatch, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var patch jsonPatch
+	if err = json.Unmarshal(data, &patch); err != nil {
+		return nil, fmt.Errorf("patch must be a JSON array of operations: %w", err)
+	}
+	return patch, nil
+}
+
+func (p jsonPatch) apply(doc []byte) ([]byte, error) {
+	root, err := decodeJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range p {
+		if root, err = op.apply(root); err != nil {
+			return nil, fmt.Errorf("patch op %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return json.Marshal(root)
+}
+
+func (op patchOp) apply(root any) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, errors.New("value is required")
+		}
+		value, err := decodeJSON(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "test" {
+			current, err := getAt(root, path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, errors.New("test failed")
+			}
+			return root, nil
+		}
+		return setAt(root, path, value, op.Op == "add")
+	case "remove":
+		root, _, err = removeAt(root, path)
+		return root, err
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := getAt(root, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if root, _, err = removeAt(root, from); err != nil {
+				return nil, err
+			}
+		} else if value, err = deepCopy(value); err != nil {
+			return nil, err
+		}
+		return setAt(root, path, value, true)
+	default:
+		return nil, fmt.Errorf("unknown op %q", op.Op)
+	}
+}
+
+// parsePointer разбирает JSON Pointer (RFC 6901), "" - весь документ
+func parsePointer(ptr string) ([]string, error) {
+	if ptr == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(ptr, "/") {
+		return nil, fmt.Errorf("pointer %q must start with /", ptr)
+	}
+	tokens := strings.Split(ptr[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func getAt(node any, path []string) (any, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]any:
+			child, has := n[token]
+			if !has {
+				return nil, errPatchPath
+			}
+			node = child
+		case []any:
+			idx, err := arrayIndex(token, len(n)-1)
+			if err != nil {
+				return nil, err
+			}
+			node = n[idx]
+		default:
+			return nil, errPatchPath
+		}
+	}
+	return node, nil
+}
+
+// setAt возвращает новый корень: вставка в массив может поменять сам срез
+func setAt(node any, path []string, value any, add bool) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token, last := path[0], len(path) == 1
+	switch n := node.(type) {
+	case map[string]any:
+		child, has := n[token]
+		if !has && (!last || !add) {
+			return nil, errPatchPath
+		}
+		if last {
+			n[token] = value
+			return n, nil
+		}
+		child, err := setAt(child, path[1:], value, add)
+		if err != nil {
+			return nil, err
+		}
+		n[token] = child
+		return n, nil
+	case []any:
+		if last && add {
+			idx := len(n)
+			if token != "-" {
+				var err error
+				if idx, err = arrayIndex(token, len(n)); err != nil {
+					return nil, err
+				}
+			}
+			n = append(n, nil)
+			copy(n[idx+1:], n[idx:])
+			n[idx] = value
+			return n, nil
+		}
+		idx, err := arrayIndex(token, len(n)-1)
+		if err != nil {
+			return nil, err
+		}
+		if last {
+			n[idx] = value
+			return n, nil
+		}
+		if n[idx], err = setAt(n[idx], path[1:], value, add); err != nil {
+			return nil, err
+		}
+		return n, nil
+	default:
+		return nil, errPatchPath
+	}
+}
+
+func removeAt(node any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("cannot remove the whole document")
+	}
+	token, last := path[0], len(path) == 1
+	switch n := node.(type) {
+	case map[string]any:
+		child, has := n[token]
+		if !has {
+			return nil, nil, errPatchPath
+		}
+		if last {
+			delete(n, token)
+			return n, child, nil
+		}
+		child, removed, err := removeAt(child, path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[token] = child
+		return n, removed, nil
+	case []any:
+		idx, err := arrayIndex(token, len(n)-1)
+		if err != nil {
+			return nil, nil, err
+		}
+		if last {
+			removed := n[idx]
+			return append(n[:idx], n[idx+1:]...), removed, nil
+		}
+		child, removed, err := removeAt(n[idx], path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[idx] = child
+		return n, removed, nil
+	default:
+		return nil, nil, errPatchPath
+	}
+}
+
+func arrayIndex(token string, maxIdx int) (int, error) {
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 || idx > maxIdx || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("bad array index %q", token)
+	}
+	return idx, nil
+}
+
+// decodeJSON держит числа как json.Number, чтобы int64 не терял точность
+func decodeJSON(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func deepCopy(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON(data)
+}
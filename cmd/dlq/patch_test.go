@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/codec"
+	"github.com/GameXost/wbTestCase/internal/generator/generatortest"
+	"github.com/GameXost/wbTestCase/internal/kafka"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sr"
+	"github.com/twmb/franz-go/pkg/sr/srfake"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJSONPatch(t *testing.T) {
+	doc := `{"a":{"b":1,"c":[1,2,3]},"d/e":"x","big":9007199254740993}`
+	tests := []struct {
+		name    string
+		patch   string
+		want    string
+		wantErr bool
+	}{
+		{"replace", `[{"op":"replace","path":"/a/b","value":5}]`, `{"a":{"b":5,"c":[1,2,3]},"big":9007199254740993,"d/e":"x"}`, false},
+		{"add to object", `[{"op":"add","path":"/n","value":null}]`, `{"a":{"b":1,"c":[1,2,3]},"big":9007199254740993,"d/e":"x","n":null}`, false},
+		{"insert into array", `[{"op":"add","path":"/a/c/1","value":9}]`, `{"a":{"b":1,"c":[1,9,2,3]},"big":9007199254740993,"d/e":"x"}`, false},
+		{"append to array", `[{"op":"add","path":"/a/c/-","value":4}]`, `{"a":{"b":1,"c":[1,2,3,4]},"big":9007199254740993,"d/e":"x"}`, false},
+		{"remove escaped", `[{"op":"remove","path":"/d~1e"}]`, `{"a":{"b":1,"c":[1,2,3]},"big":9007199254740993}`, false},
+		{"remove from array", `[{"op":"remove","path":"/a/c/0"}]`, `{"a":{"b":1,"c":[2,3]},"big":9007199254740993,"d/e":"x"}`, false},
+		{"move", `[{"op":"move","from":"/a/b","path":"/b"}]`, `{"a":{"c":[1,2,3]},"b":1,"big":9007199254740993,"d/e":"x"}`, false},
+		{"copy", `[{"op":"copy","from":"/a/c","path":"/c"}]`, `{"a":{"b":1,"c":[1,2,3]},"big":9007199254740993,"c":[1,2,3],"d/e":"x"}`, false},
+		{"test passes", `[{"op":"test","path":"/d~1e","value":"x"},{"op":"remove","path":"/a"}]`, `{"big":9007199254740993,"d/e":"x"}`, false},
+		{"test fails", `[{"op":"test","path":"/d~1e","value":"y"}]`, "", true},
+		{"replace missing", `[{"op":"replace","path":"/nope","value":1}]`, "", true},
+		{"index out of range", `[{"op":"add","path":"/a/c/4","value":1}]`, "", true},
+		{"unknown op", `[{"op":"merge","path":"/a"}]`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patch jsonPatch
+			require.NoError(t, json.Unmarshal([]byte(tt.patch), &patch))
+			got, err := patch.apply([]byte(doc))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestPrepareFixesOrderWithPatch(t *testing.T) {
+	order := generatortest.New(t).ValidOrder("fixme")
+	amount := order.Payment.Amount
+	order.Payment.Amount = -1
+	value, err := json.Marshal(order)
+	require.NoError(t, err)
+
+	decoder := codec.NewDecoder(nil)
+	_, _, _, err = prepare(context.Background(), decoder, "", value, nil)
+	assert.ErrorContains(t, err, "still invalid")
+
+	var patch jsonPatch
+	require.NoError(t, json.Unmarshal(fmt.Appendf(nil, `[{"op":"replace","path":"/payment/amount","value":%d}]`, amount), &patch))
+	_, contentType, fixed, err := prepare(context.Background(), decoder, "", value, patch)
+	require.NoError(t, err)
+	assert.Equal(t, amount, fixed.Payment.Amount)
+	assert.Empty(t, contentType, "json records keep their headers as is")
+}
+
+func TestPrepareDecodesProtobuf(t *testing.T) {
+	ctx := context.Background()
+	registry := srfake.New()
+	t.Cleanup(registry.Close)
+	client, err := sr.NewClient(sr.URLs(registry.URL()))
+	require.NoError(t, err)
+	encoder, err := codec.NewEncoder(ctx, client, codec.FormatProtobuf, "orders-value")
+	require.NoError(t, err)
+	decoder := codec.NewDecoder(client)
+
+	order := generatortest.New(t).ValidOrder("proto")
+	value, err := encoder.Encode(order)
+	require.NoError(t, err)
+	got, contentType, decoded, err := prepare(ctx, decoder, encoder.ContentType(), value, nil)
+	require.NoError(t, err)
+	assert.Equal(t, value, got, "without a patch the record is replayed as it was")
+	assert.Equal(t, encoder.ContentType(), contentType)
+	assert.Equal(t, "proto", decoded.OrderUId)
+
+	amount := order.Payment.Amount
+	order.Payment.Amount = -1
+	value, err = encoder.Encode(order)
+	require.NoError(t, err)
+	_, _, _, err = prepare(ctx, decoder, encoder.ContentType(), value, nil)
+	assert.ErrorContains(t, err, "still invalid")
+
+	var patch jsonPatch
+	require.NoError(t, json.Unmarshal(fmt.Appendf(nil, `[{"op":"replace","path":"/payment/amount","value":%d}]`, amount), &patch))
+	got, contentType, decoded, err = prepare(ctx, decoder, encoder.ContentType(), value, patch)
+	require.NoError(t, err)
+	assert.Equal(t, codec.ContentTypeJSON, contentType, "patched records are replayed as json")
+	assert.Equal(t, amount, decoded.Payment.Amount)
+	assert.True(t, json.Valid(got))
+
+	_, _, _, err = prepare(ctx, decoder, encoder.ContentType(), []byte("{}"), nil)
+	assert.ErrorContains(t, err, "invalid payload")
+}
+
+func TestReplayStatePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.ndjson")
+	state, err := loadReplayState(path)
+	require.NoError(t, err)
+	id := recordID("orders.dlq", 1, 42)
+	assert.False(t, state.has(id))
+	require.NoError(t, state.mark(id))
+
+	require.NoError(t, state.close())
+
+	again, err := loadReplayState(path)
+	require.NoError(t, err)
+	assert.True(t, again.has(id))
+	assert.False(t, again.has(recordID("orders.dlq", 1, 43)))
+	require.NoError(t, again.close())
+}
+
+// mark дописывает строку, а не переписывает файл; оборванная последняя строка отрезается
+func TestReplayStateAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.ndjson")
+	state, err := loadReplayState(path)
+	require.NoError(t, err)
+	for offset := range int64(3) {
+		require.NoError(t, state.mark(recordID("orders.dlq", 0, offset)))
+	}
+	require.NoError(t, state.close())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 3, bytes.Count(data, []byte("\n")))
+
+	// падение посреди записи строки
+	require.NoError(t, os.WriteFile(path, append(data, `{"id":"orders.dlq/0/3","a`...), 0o644))
+	state, err = loadReplayState(path)
+	require.NoError(t, err)
+	assert.True(t, state.has(recordID("orders.dlq", 0, 2)))
+	assert.False(t, state.has(recordID("orders.dlq", 0, 3)))
+	require.NoError(t, state.mark(recordID("orders.dlq", 0, 4)))
+	require.NoError(t, state.close())
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 4, bytes.Count(data, []byte("\n")), "%s", data)
+
+	again, err := loadReplayState(path)
+	require.NoError(t, err)
+	assert.True(t, again.has(recordID("orders.dlq", 0, 4)))
+	require.NoError(t, again.close())
+}
+
+func TestFilterAndHeaders(t *testing.T) {
+	failedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	record := &kgo.Record{
+		Topic: "orders.dlq",
+		Key:   []byte("k1"),
+		Headers: []kgo.RecordHeader{
+			{Key: "source", Value: []byte("test")},
+			{Key: kafka.HeaderReason, Value: []byte(kafka.ReasonValidation)},
+			{Key: kafka.HeaderFailedAt, Value: []byte(failedAt.Format(time.RFC3339Nano))},
+		},
+	}
+	r := decodeRecord(record)
+
+	assert.True(t, (&filter{reason: kafka.ReasonValidation, key: "k1"}).match(r))
+	assert.False(t, (&filter{reason: kafka.ReasonInvalidJSON}).match(r))
+	assert.False(t, (&filter{key: "k2"}).match(r))
+	assert.True(t, (&filter{since: timeFlag{failedAt}, until: timeFlag{failedAt.Add(time.Second)}}).match(r))
+	assert.False(t, (&filter{until: timeFlag{failedAt}}).match(r))
+
+	headers := replayHeaders(record, "orders.dlq/0/7", "")
+	assert.Equal(t, []kgo.RecordHeader{
+		{Key: "source", Value: []byte("test")},
+		{Key: kafka.HeaderReplayedFrom, Value: []byte("orders.dlq/0/7")},
+	}, headers)
+
+	record.Headers = append(record.Headers, kgo.RecordHeader{Key: codec.HeaderContentType, Value: []byte(codec.ContentTypeProtobuf)})
+	headers = replayHeaders(record, "orders.dlq/0/7", codec.ContentTypeJSON)
+	assert.Equal(t, []kgo.RecordHeader{
+		{Key: "source", Value: []byte("test")},
+		{Key: codec.HeaderContentType, Value: []byte(codec.ContentTypeJSON)},
+		{Key: kafka.HeaderReplayedFrom, Value: []byte("orders.dlq/0/7")},
+	}, headers)
+}
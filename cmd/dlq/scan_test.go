@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/kafka"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"strings"
+	"testing"
+)
+
+func TestScanReadsUpToCurrentEnd(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(2, "orders.dlq"))
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(cluster.ListenAddrs()...),
+		kgo.RecordPartitioner(kgo.ManualPartitioner()),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+	for i := 0; i < 6; i++ {
+		reason := kafka.ReasonValidation
+		if i%3 == 0 {
+			reason = kafka.ReasonInvalidJSON
+		}
+		record := &kgo.Record{
+			Topic:     "orders.dlq",
+			Partition: int32(i % 2),
+			Key:       []byte(fmt.Sprintf("k%d", i)),
+			Headers:   []kgo.RecordHeader{{Key: kafka.HeaderReason, Value: []byte(reason)}},
+		}
+		require.NoError(t, client.ProduceSync(context.Background(), record).FirstErr())
+	}
+
+	o := &options{brokers: strings.Join(cluster.ListenAddrs(), ","), topic: "orders.dlq"}
+	var keys []string
+	err = scan(context.Background(), o, &filter{reason: kafka.ReasonValidation}, func(r dlqRecord) error {
+		keys = append(keys, string(r.record.Key))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"k1", "k2", "k4", "k5"}, keys)
+}
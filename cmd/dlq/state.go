@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// replayState помнит, какие записи dlq уже переотправлены, чтобы повторный replay их пропускал.
+// На диске - NDJSON, по строке на запись: mark только дописывает в конец, а не переписывает весь файл
+type replayState struct {
+	f        *os.File
+	enc      *json.Encoder
+	replayed map[string]time.Time
+}
+
+// replayMark - строка файла состояния
+type replayMark struct {
+	ID string    `json:"id"`
+	At time.Time `json:"at"`
+}
+
+func recordID(topic string, partition int32, offset int64) string {
+	return fmt.Sprintf("%s/%d/%d", topic, partition, offset)
+}
+
+func loadReplayState(path string) (*replayState, error) {
+	replayed, err := readReplayState(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &replayState{f: f, enc: json.NewEncoder(f), replayed: replayed}, nil
+}
+
+func readReplayState(path string) (map[string]time.Time, error) {
+	replayed := make(map[string]time.Time)
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return replayed, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	dec := json.NewDecoder(bufio.NewReader(f))
+	// конец последней целой строки
+	var good int64
+	for {
+		var mark replayMark
+		err = dec.Decode(&mark)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			// replay упал посреди записи строки: эта запись не считается отправленной, а обрывок отрезаем,
+			// иначе следующая строка допишется прямо к нему
+			log.Printf("replay state %s: dropping a truncated last line", path)
+			if err = truncateAfter(path, good); err != nil {
+				return nil, err
+			}
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("broken replay state %s: %w", path, err)
+		}
+		replayed[mark.ID] = mark.At
+		good = dec.InputOffset()
+	}
+	return replayed, nil
+}
+
+// truncateAfter обрезает файл по концу последней целой строки, оставляя за ней перевод строки
+func truncateAfter(path string, good int64) error {
+	if err := os.Truncate(path, good); err != nil || good == 0 {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write([]byte("\n")); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *replayState) has(id string) bool {
+	_, has := s.replayed[id]
+	return has
+}
+
+// mark сразу дописывает запись на диск: если replay упадет посередине, отправленное не повторится
+func (s *replayState) mark(id string) error {
+	at := time.Now().UTC()
+	if err := s.enc.Encode(replayMark{ID: id, At: at}); err != nil {
+		return err
+	}
+	s.replayed[id] = at
+	return nil
+}
+
+func (s *replayState) close() error {
+	return s.f.Close()
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/apperror"
+	"github.com/GameXost/wbTestCase/internal/codec"
+	"github.com/GameXost/wbTestCase/internal/kafka"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/GameXost/wbTestCase/internal/repository"
+	"github.com/GameXost/wbTestCase/internal/service"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// причины отказа в строке фикстуры
+const (
+	rejectInvalidJSON = "invalid_json"
+	rejectValidation  = "validation"
+	rejectPersistence = "persistence" // бд отвергла заказ: нарушение ограничений, кривые данные
+	rejectKey         = "key"         // ключ записи по KAFKA_KEY_STRATEGY не получить
+)
+
+// самая длинная строка NDJSON, которую читаем
+const maxLineSize = 16 << 20
+
+// sink - куда складываются провалидированные заказы. Ошибка *rejected - заказ не принят, но импорт продолжается,
+// любая другая останавливает импорт
+type sink interface {
+	save(ctx context.Context, order *models.Order, line []byte) error
+	// flush дожидается всего отправленного, возвращает сколько записей не доехало
+	flush(ctx context.Context) (int, error)
+}
+
+// rejected - заказ отвергнут по вине самой строки, reason - одна из reject*
+type rejected struct {
+	reason string
+	err    error
+}
+
+func (r *rejected) Error() string { return r.err.Error() }
+func (r *rejected) Unwrap() error { return r.err }
+
+type dryRunSink struct{}
+
+func (dryRunSink) save(context.Context, *models.Order, []byte) error { return nil }
+func (dryRunSink) flush(context.Context) (int, error)                { return 0, nil }
+
+// dbSink пишет заказ прямо в бд, минуя кафку. raw_orders не заполняется: исходной записи нет
+type dbSink struct {
+	repo interface {
+		CreateFullOrder(ctx context.Context, order *models.Order, raw *models.RawOrder) error
+	}
+}
+
+func (s dbSink) save(ctx context.Context, order *models.Order, _ []byte) error {
+	err := s.repo.CreateFullOrder(ctx, order, nil)
+	// бд отвергла данные - дело в заказе, остальное (бд недоступна) - останавливаемся
+	if repository.IsDataError(err) {
+		return &rejected{reason: rejectPersistence, err: err}
+	}
+	return err
+}
+
+func (dbSink) flush(context.Context) (int, error) { return 0, nil }
+
+// kafkaSink публикует строку как есть, сохранять ее будет консьюмер. Записи уходят асинхронно пачками
+type kafkaSink struct {
+	client      *kgo.Client
+	topic       string
+	keyStrategy string
+
+	mu      sync.Mutex
+	failed  int
+	lastErr error
+}
+
+func (s *kafkaSink) save(ctx context.Context, order *models.Order, line []byte) error {
+	key, err := kafka.OrderKey(s.keyStrategy, order)
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		return &rejected{reason: rejectKey, err: fmt.Errorf("empty %s key", s.keyStrategy)}
+	}
+	record := &kgo.Record{
+		Topic:   s.topic,
+		Key:     []byte(key),
+		Value:   slices.Clone(line),
+		Headers: []kgo.RecordHeader{{Key: codec.HeaderContentType, Value: []byte(codec.ContentTypeJSON)}},
+	}
+	s.client.Produce(ctx, record, func(_ *kgo.Record, err error) {
+		if err != nil {
+			s.mu.Lock()
+			s.failed++
+			s.lastErr = err
+			s.mu.Unlock()
+		}
+	})
+	return nil
+}
+
+func (s *kafkaSink) flush(ctx context.Context) (int, error) {
+	if err := s.client.Flush(ctx); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastErr != nil {
+		log.Printf("%d records are not delivered, last error: %v", s.failed, s.lastErr)
+	}
+	return s.failed, nil
+}
+
+// reject - отвергнутая строка фикстуры
+type reject struct {
+	Line   int             `json:"line"`
+	Reason string          `json:"reason"`
+	Error  string          `json:"error"`
+	Value  json.RawMessage `json:"value,omitempty"`
+	Text   string          `json:"text,omitempty"` // строка, которая не разобралась как json
+}
+
+type summary struct {
+	read, imported, duplicates, failed int
+	rejects                            []reject
+	// сколько раз нарушено каждое правило валидации: "Order.Payment.Amount: gt=0"
+	violations map[string]int
+}
+
+// importOrders читает NDJSON построчно, валидирует и отдает в sink. Плохие строки не останавливают импорт,
+// ошибка - только когда sink не может работать дальше
+func importOrders(ctx context.Context, in io.Reader, s sink) (*summary, error) {
+	sum := &summary{violations: make(map[string]int)}
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		sum.read++
+
+		var order models.Order
+		if err := json.Unmarshal(line, &order); err != nil {
+			sum.reject(lineNo, line, rejectInvalidJSON, err)
+			continue
+		}
+		if err := service.ValidateOrder(&order); err != nil {
+			sum.reject(lineNo, line, rejectValidation, err)
+			continue
+		}
+		err := s.save(ctx, &order, line)
+		var rej *rejected
+		switch {
+		case err == nil:
+			sum.imported++
+		case errors.Is(err, apperror.ErrDuplicate):
+			sum.duplicates++
+		case errors.As(err, &rej):
+			sum.reject(lineNo, line, rej.reason, rej.err)
+		default:
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	failed, err := s.flush(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sum.failed = failed
+	sum.imported -= failed
+	return sum, nil
+}
+
+func (s *summary) reject(lineNo int, line []byte, reason string, err error) {
+	r := reject{Line: lineNo, Reason: reason, Error: err.Error()}
+	if json.Valid(line) {
+		r.Value = slices.Clone(line)
+	} else {
+		r.Text = string(line)
+	}
+	s.rejects = append(s.rejects, r)
+
+	for _, rule := range service.Violations(err) {
+		s.violations[rule]++
+	}
+}
+
+// сколько отвергнутых строк показывать в отчете, остальные - в -rejects
+const rejectsShown = 20
+
+func (s *summary) print(w io.Writer) {
+	_, _ = fmt.Fprintf(w, "read: %d, imported: %d, duplicates: %d, rejected: %d", s.read, s.imported, s.duplicates, len(s.rejects))
+	if s.failed > 0 {
+		_, _ = fmt.Fprintf(w, ", not delivered: %d", s.failed)
+	}
+	_, _ = fmt.Fprintln(w)
+	if len(s.rejects) == 0 {
+		return
+	}
+
+	byReason := make(map[string]int)
+	for _, r := range s.rejects {
+		byReason[r.Reason]++
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "\nreason\trejected")
+	for _, reason := range sortedKeys(byReason) {
+		_, _ = fmt.Fprintf(tw, "%s\t%d\n", reason, byReason[reason])
+	}
+	if len(s.violations) > 0 {
+		_, _ = fmt.Fprintln(tw, "\nviolation\tlines")
+		for _, rule := range sortedKeys(s.violations) {
+			_, _ = fmt.Fprintf(tw, "%s\t%d\n", rule, s.violations[rule])
+		}
+	}
+	_ = tw.Flush()
+
+	_, _ = fmt.Fprintln(w)
+	for _, r := range s.rejects[:min(len(s.rejects), rejectsShown)] {
+		_, _ = fmt.Fprintf(w, "line %d: %s: %s\n", r.Line, r.Reason, r.Error)
+	}
+	if len(s.rejects) > rejectsShown {
+		_, _ = fmt.Fprintf(w, "... and %d more\n", len(s.rejects)-rejectsShown)
+	}
+}
+
+func (s *summary) writeRejects(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, r := range s.rejects {
+		if err = enc.Encode(r); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/GameXost/wbTestCase/internal/apperror"
+	"github.com/GameXost/wbTestCase/internal/codec"
+	"github.com/GameXost/wbTestCase/internal/config"
+	"github.com/GameXost/wbTestCase/internal/generator/generatortest"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSink запоминает заказы, а заказы из duplicates и broken отвергает как бд
+type fakeSink struct {
+	saved      []*models.Order
+	duplicates map[string]bool
+	broken     map[string]bool
+}
+
+func (s *fakeSink) save(ctx context.Context, order *models.Order, line []byte) error {
+	switch {
+	case s.duplicates[order.OrderUId]:
+		return apperror.ErrDuplicate
+	case s.broken[order.OrderUId]:
+		return &rejected{reason: rejectPersistence, err: errors.New("duplicate key value violates unique constraint")}
+	}
+	s.saved = append(s.saved, order)
+	return nil
+}
+
+func (s *fakeSink) flush(context.Context) (int, error) { return 0, nil }
+
+func ndjson(t *testing.T, lines ...any) string {
+	var b strings.Builder
+	for _, line := range lines {
+		if s, ok := line.(string); ok {
+			b.WriteString(s)
+		} else {
+			data, err := json.Marshal(line)
+			require.NoError(t, err)
+			b.Write(data)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func TestImportReportsRejects(t *testing.T) {
+	g := generatortest.New(t)
+	invalid, err := g.MutatedOrder("invalid", "payment.amount_zero")
+	require.NoError(t, err)
+	in := ndjson(t,
+		g.ValidOrder("ok"),
+		"{not json",
+		"",
+		invalid,
+		g.ValidOrder("dup"),
+		g.ValidOrder("broken"),
+	)
+	s := &fakeSink{duplicates: map[string]bool{"dup": true}, broken: map[string]bool{"broken": true}}
+
+	sum, err := importOrders(context.Background(), strings.NewReader(in), s)
+	require.NoError(t, err)
+	assert.Equal(t, 5, sum.read, "blank lines are skipped")
+	assert.Equal(t, 1, sum.imported)
+	assert.Equal(t, 1, sum.duplicates)
+	require.Len(t, sum.rejects, 3)
+	assert.Equal(t, reject{Line: 2, Reason: rejectInvalidJSON, Error: sum.rejects[0].Error, Text: "{not json"}, sum.rejects[0])
+	assert.Equal(t, 4, sum.rejects[1].Line)
+	assert.Equal(t, rejectValidation, sum.rejects[1].Reason)
+	assert.Equal(t, rejectPersistence, sum.rejects[2].Reason)
+	assert.Equal(t, 1, sum.violations["Order.Payment.Amount: gt=0"])
+
+	var out strings.Builder
+	sum.print(&out)
+	assert.Contains(t, out.String(), "read: 5, imported: 1, duplicates: 1, rejected: 3")
+	assert.Contains(t, out.String(), "Order.Payment.Amount: gt=0")
+	assert.Contains(t, out.String(), "line 2: invalid_json")
+
+	path := filepath.Join(t.TempDir(), "rejects.ndjson")
+	require.NoError(t, sum.writeRejects(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 3)
+	var r reject
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &r))
+	assert.Equal(t, "invalid", valueUID(t, r.Value))
+}
+
+func valueUID(t *testing.T, value json.RawMessage) string {
+	var order models.Order
+	require.NoError(t, json.Unmarshal(value, &order))
+	return order.OrderUId
+}
+
+func TestImportPublishesToKafka(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(2, "orders"))
+	require.NoError(t, err)
+	defer cluster.Close()
+	client, err := kgo.NewClient(kgo.SeedBrokers(cluster.ListenAddrs()...))
+	require.NoError(t, err)
+	defer client.Close()
+
+	g := generatortest.New(t)
+	in := ndjson(t, g.ValidOrder("a"), g.ValidOrder("b"))
+	s := &kafkaSink{client: client, topic: "orders", keyStrategy: config.KeyStrategyOrderUID}
+	sum, err := importOrders(context.Background(), strings.NewReader(in), s)
+	require.NoError(t, err)
+	assert.Equal(t, 2, sum.imported)
+
+	consumer, err := kgo.NewClient(kgo.SeedBrokers(cluster.ListenAddrs()...), kgo.ConsumeTopics("orders"),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()))
+	require.NoError(t, err)
+	defer consumer.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var records []*kgo.Record
+	for len(records) < 2 {
+		fetches := consumer.PollFetches(ctx)
+		require.NoError(t, ctx.Err())
+		records = append(records, fetches.Records()...)
+	}
+	for _, record := range records {
+		assert.Equal(t, valueUID(t, record.Value), string(record.Key))
+		assert.Equal(t, codec.ContentTypeJSON, string(record.Headers[0].Value))
+	}
+}
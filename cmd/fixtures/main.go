@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/config"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/GameXost/wbTestCase/internal/repository"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const usage = `usage: fixtures <command> [flags]
+
+commands:
+  export  write orders from the db as NDJSON, one order per line
+  import  validate NDJSON orders and write them to the db or publish to kafka
+
+run "fixtures <command> -h" for command flags`
+
+// выгрузка заказов в NDJSON и загрузка обратно: для тестовых стендов, воспроизведения багов и демо
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "export":
+		err = runExport(ctx, args)
+	case "import":
+		err = runImport(ctx, args)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// сколько заказов грузить из бд одним запросом
+const exportBatch = 500
+
+func runExport(ctx context.Context, args []string) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	uids := fs.String("uids", "", "comma separated order uids")
+	uidsFile := fs.String("uids-file", "", "file with order uids, one per line")
+	var from, to time.Time
+	fs.TextVar(&from, "from", time.Time{}, "export orders created at or after this RFC3339 time")
+	fs.TextVar(&to, "to", time.Time{}, "export orders created before this RFC3339 time, requires -from")
+	sample := fs.Uint64("sample", 0, "export this many random orders")
+	outPath := fs.String("out", "-", "output file, - for stdout")
+	_ = fs.Parse(args)
+
+	pool, err := pgxpool.New(ctx, cfg.DB.DSN())
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+	repo := repository.NewRepo(pool)
+
+	var ids []string
+	switch {
+	case *uids != "" || *uidsFile != "":
+		ids, err = readUIDs(*uids, *uidsFile)
+	case !from.IsZero():
+		if to.IsZero() {
+			to = time.Now()
+		}
+		ids, err = repo.GetIDsCreatedBetween(ctx, from, to)
+	case *sample > 0:
+		ids, err = repo.GetSampleIDs(ctx, *sample)
+	default:
+		return errors.New("choose orders with -uids, -uids-file, -from/-to or -sample")
+	}
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if *outPath != "-" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+	written, err := exportOrders(ctx, w, repo, ids)
+	if err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	log.Printf("exported %d of %d orders", written, len(ids))
+	return nil
+}
+
+type orderLoader interface {
+	GetFullOrdersOnIds(ctx context.Context, ids []string) ([]*models.Order, error)
+}
+
+// exportOrders пишет заказы пачками в порядке ids. Отмененные и несуществующие uid пропускаются и попадают в лог
+func exportOrders(ctx context.Context, w io.Writer, repo orderLoader, ids []string) (int, error) {
+	enc := json.NewEncoder(w)
+	written := 0
+	for chunk := range slices.Chunk(ids, exportBatch) {
+		orders, err := repo.GetFullOrdersOnIds(ctx, chunk)
+		if err != nil {
+			return written, err
+		}
+		byID := make(map[string]*models.Order, len(orders))
+		for _, order := range orders {
+			byID[order.OrderUId] = order
+		}
+		for _, id := range chunk {
+			order, has := byID[id]
+			if !has {
+				log.Printf("order %s not found", id)
+				continue
+			}
+			// служебный id строки бд в фикстуре не нужен
+			order.Delivery.Id = 0
+			if err = enc.Encode(order); err != nil {
+				return written, err
+			}
+			written++
+		}
+	}
+	return written, nil
+}
+
+func readUIDs(list, path string) ([]string, error) {
+	var uids []string
+	for _, uid := range strings.Split(list, ",") {
+		if uid = strings.TrimSpace(uid); uid != "" {
+			uids = append(uids, uid)
+		}
+	}
+	if path == "" {
+		return uids, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if uid := strings.TrimSpace(scanner.Text()); uid != "" && !strings.HasPrefix(uid, "#") {
+			uids = append(uids, uid)
+		}
+	}
+	return uids, scanner.Err()
+}
+
+func runImport(ctx context.Context, args []string) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	inPath := fs.String("in", "-", "NDJSON file with orders, - for stdin")
+	target := fs.String("to", "db", "where to import: db (straight through the repository) or kafka (the consumer saves them)")
+	brokers := fs.String("brokers", strings.Join(cfg.Kafka.Brokers, ","), "comma separated kafka brokers")
+	topic := fs.String("topic", cfg.Kafka.Topic, "topic to publish orders to")
+	rejectsPath := fs.String("rejects", "", "write rejected lines with errors to this NDJSON file")
+	dryRun := fs.Bool("dry-run", false, "only validate, do not write anywhere")
+	_ = fs.Parse(args)
+
+	var in io.Reader = os.Stdin
+	if *inPath != "-" {
+		f, err := os.Open(*inPath)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		in = f
+	}
+
+	var s sink = dryRunSink{}
+	if !*dryRun {
+		switch *target {
+		case "db":
+			pool, err := pgxpool.New(ctx, cfg.DB.DSN())
+			if err != nil {
+				return err
+			}
+			defer pool.Close()
+			s = dbSink{repo: repository.NewRepo(pool)}
+		case "kafka":
+			client, err := kgo.NewClient(kgo.SeedBrokers(strings.Split(*brokers, ",")...), kgo.RequiredAcks(kgo.AllISRAcks()))
+			if err != nil {
+				return err
+			}
+			defer client.Close()
+			s = &kafkaSink{client: client, topic: *topic, keyStrategy: cfg.Kafka.KeyStrategy}
+		default:
+			return fmt.Errorf("unknown -to %q, want db or kafka", *target)
+		}
+	}
+
+	sum, err := importOrders(ctx, in, s)
+	if err != nil {
+		return err
+	}
+	sum.print(os.Stdout)
+	if *rejectsPath != "" && len(sum.rejects) > 0 {
+		if err = sum.writeRejects(*rejectsPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
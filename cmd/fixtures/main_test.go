@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/GameXost/wbTestCase/internal/generator/generatortest"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type fakeLoader map[string]*models.Order
+
+func (l fakeLoader) GetFullOrdersOnIds(ctx context.Context, ids []string) ([]*models.Order, error) {
+	var orders []*models.Order
+	// бд отдает заказы в своем порядке
+	for i := len(ids) - 1; i >= 0; i-- {
+		if order, has := l[ids[i]]; has {
+			orders = append(orders, order.Clone())
+		}
+	}
+	return orders, nil
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	g := generatortest.New(t)
+	loader := fakeLoader{}
+	var ids []string
+	for range exportBatch + 3 {
+		order := g.ValidOrder(g.OrderUID())
+		order.Delivery.Id = 7
+		loader[order.OrderUId] = order
+		ids = append(ids, order.OrderUId)
+	}
+
+	var buf bytes.Buffer
+	written, err := exportOrders(context.Background(), &buf, loader, append(ids, "missing"))
+	require.NoError(t, err)
+	assert.Equal(t, len(ids), written)
+	assert.Equal(t, len(ids), bytes.Count(buf.Bytes(), []byte("\n")), "one order per line")
+
+	s := &fakeSink{}
+	sum, err := importOrders(context.Background(), &buf, s)
+	require.NoError(t, err)
+	assert.Equal(t, len(ids), sum.imported)
+	assert.Empty(t, sum.rejects)
+	require.Len(t, s.saved, len(ids))
+	for i, order := range s.saved {
+		assert.Equal(t, ids[i], order.OrderUId, "export keeps the requested order")
+		assert.Zero(t, order.Delivery.Id, "db row id is not exported")
+		want := loader[ids[i]].Clone()
+		want.Delivery.Id = 0
+		assert.Equal(t, want.Payment, order.Payment)
+		assert.Equal(t, want.Items, order.Items)
+	}
+}
+
+func TestReadUIDs(t *testing.T) {
+	uids, err := readUIDs(" a, b,,c ", "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, uids)
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/config"
+	"github.com/GameXost/wbTestCase/internal/repository"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// гоняет GET /order/{uid} в заданном темпе или с заданной параллельностью, печатает задержки и ошибки
+// по видам запросов и hit ratio кэша сервера по /metrics до и после прогона
+func main() {
+	addr := flag.String("addr", "http://localhost:8080", "order api base url")
+	uidsPath := flag.String("uids", "", "file with known order uids, one per line; empty - the latest uids from the db")
+	poolSize := flag.Uint64("pool", 10000, "how many latest uids to take from the db")
+	rate := flag.Float64("rate", 0, "target requests per second, 0 - every worker sends as soon as it gets an answer")
+	concurrency := flag.Int("concurrency", 16, "requests in flight at most")
+	duration := flag.Duration("duration", 30*time.Second, "stop after this time")
+	requests := flag.Int("requests", 0, "stop after this many requests, 0 - only -duration limits the run")
+	missRatio := flag.Float64("miss", 0.1, "share of requests for a uniformly random known uid, probably not cached")
+	notFoundRatio := flag.Float64("not-found", 0.05, "share of requests for uids that do not exist")
+	zipfS := flag.Float64("zipf", 1.1, "zipf exponent (> 1) of the rest of requests, the higher - the hotter the head of the pool")
+	timeout := flag.Duration("timeout", 5*time.Second, "request timeout")
+	seed := flag.Uint64("seed", 0, "seed of the request sequence, 0 - random")
+	flag.Parse()
+
+	if *duration <= 0 && *requests <= 0 {
+		log.Fatal("either -duration or -requests must be set")
+	}
+	if *zipfS <= 1 || *missRatio < 0 || *notFoundRatio < 0 || *missRatio+*notFoundRatio > 1 {
+		log.Fatal("-zipf must be > 1, -miss and -not-found must be non-negative and sum up to at most 1")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	uids, err := loadUIDs(ctx, *uidsPath, *poolSize)
+	if err != nil {
+		log.Fatalf("failed to load uids: %v", err)
+	}
+	if len(uids) == 0 {
+		log.Fatal("no known uids to request")
+	}
+
+	for *seed == 0 {
+		*seed = rand.Uint64()
+	}
+	pick := newPicker(uids, *seed, *zipfS, *missRatio, *notFoundRatio)
+	client := &http.Client{Timeout: *timeout}
+	base := strings.TrimRight(*addr, "/")
+
+	before, err := scrapeCache(ctx, client, base)
+	if err != nil {
+		log.Printf("cache hit ratio will not be reported: %v", err)
+	}
+	log.Printf("loadtest started: %s, pool %d uids, rate %.0f/s, concurrency %d, duration %s, seed %d",
+		base, len(uids), *rate, *concurrency, *duration, *seed)
+
+	runCtx := ctx
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+	rep := newReport()
+	start := time.Now()
+	run(runCtx, client, base, pick, rep, *requests, *rate, max(*concurrency, 1))
+	rep.print(os.Stdout, time.Since(start))
+
+	if before != nil {
+		after, err := scrapeCache(ctx, client, base)
+		if err != nil {
+			log.Printf("failed to scrape metrics after the run: %v", err)
+			return
+		}
+		printCache(os.Stdout, before, after)
+	}
+}
+
+// run раздает запросы воркерам в темпе rate (или так быстро, как они освобождаются), пока не отправлено
+// requests или не отменен ctx
+func run(ctx context.Context, client *http.Client, base string, pick *picker, rep *report, requests int, rate float64, concurrency int) {
+	// начатые запросы доживают до ответа или таймаута клиента: ctx останавливает только выдачу новых
+	reqCtx := context.WithoutCancel(ctx)
+	jobs := make(chan struct{})
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				kind, uid := pick.next()
+				sent := time.Now()
+				status, err := fetch(reqCtx, client, base, uid)
+				rep.observe(kind, time.Since(sent), status, err)
+			}
+		}()
+	}
+
+	var tick <-chan time.Time
+	if rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+loop:
+	for i := 0; requests <= 0 || i < requests; i++ {
+		if tick != nil {
+			select {
+			case <-ctx.Done():
+				break loop
+			case <-tick:
+			}
+		}
+		select {
+		case <-ctx.Done():
+			break loop
+		case jobs <- struct{}{}:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func fetch(ctx context.Context, client *http.Client, base, uid string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/order/"+url.PathEscape(uid), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	// тело дочитываем, чтобы соединение вернулось в пул, а задержка включала передачу заказа
+	if _, err = io.Copy(io.Discard, resp.Body); err != nil {
+		return resp.StatusCode, err
+	}
+	return resp.StatusCode, nil
+}
+
+// виды запросов: что сервер должен ответить и откуда, скорее всего, возьмет заказ
+const (
+	kindHit      = "hit"       // популярный uid по Zipf, должен жить в кэше
+	kindMiss     = "miss"      // любой известный uid, скорее всего пойдет в бд
+	kindNotFound = "not_found" // uid, которого нет, ждем 404
+)
+
+var kinds = []string{kindHit, kindMiss, kindNotFound}
+
+// picker выбирает, что запросить. uids упорядочены по популярности: голова пула достается Zipf'у чаще всего
+type picker struct {
+	missRatio     float64
+	notFoundRatio float64
+
+	mu   sync.Mutex
+	rnd  *rand.Rand
+	zipf *rand.Zipf
+	uids []string
+}
+
+func newPicker(uids []string, seed uint64, zipfS, missRatio, notFoundRatio float64) *picker {
+	rnd := rand.New(rand.NewPCG(seed, seed))
+	return &picker{
+		missRatio:     missRatio,
+		notFoundRatio: notFoundRatio,
+		rnd:           rnd,
+		zipf:          rand.NewZipf(rnd, zipfS, 1, uint64(len(uids)-1)),
+		uids:          uids,
+	}
+}
+
+func (p *picker) next() (string, string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch x := p.rnd.Float64(); {
+	case x < p.notFoundRatio:
+		// каждый раз новый, чтобы не отвечал негативный кэш
+		return kindNotFound, fmt.Sprintf("loadtest-missing-%016x", p.rnd.Uint64())
+	case x < p.notFoundRatio+p.missRatio:
+		return kindMiss, p.uids[p.rnd.IntN(len(p.uids))]
+	}
+	return kindHit, p.uids[p.zipf.Uint64()]
+}
+
+// loadUIDs читает uid из файла или берет последние из бд: свежие заказы и самые популярные
+func loadUIDs(ctx context.Context, path string, poolSize uint64) ([]string, error) {
+	if path != "" {
+		return readUIDs(path)
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	pool, err := pgxpool.New(ctx, cfg.DB.DSN())
+	if err != nil {
+		return nil, err
+	}
+	defer pool.Close()
+	return repository.NewRepo(pool).GetRecentIDs(ctx, poolSize)
+}
+
+func readUIDs(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var uids []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if uid := strings.TrimSpace(scanner.Text()); uid != "" && !strings.HasPrefix(uid, "#") {
+			uids = append(uids, uid)
+		}
+	}
+	return uids, scanner.Err()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeAPI отдает известные заказы, на остальные 404, и считает "кэш" в /metrics
+func fakeAPI(t *testing.T, known []string) *httptest.Server {
+	var mu sync.Mutex
+	hits, misses := 0, 0
+	seen := make(map[string]bool)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/metrics" {
+			_, _ = fmt.Fprintf(w, "# TYPE cache_hits_total counter\ncache_hits_total %d\ncache_misses_total %d\nnegative_cache_hits_total 0\n", hits, misses)
+			return
+		}
+		uid := strings.TrimPrefix(r.URL.Path, "/order/")
+		if seen[uid] {
+			hits++
+		} else {
+			misses++
+			seen[uid] = true
+		}
+		for _, k := range known {
+			if k == uid {
+				_, _ = w.Write([]byte(`{"order_uid":"` + uid + `"}`))
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRunSendsRequestsOfEveryKind(t *testing.T) {
+	known := []string{"a", "b", "c", "d", "e"}
+	srv := fakeAPI(t, known)
+	pick := newPicker(known, 7, 1.1, 0.2, 0.2)
+	rep := newReport()
+
+	before, err := scrapeCache(context.Background(), srv.Client(), srv.URL)
+	require.NoError(t, err)
+	run(context.Background(), srv.Client(), srv.URL, pick, rep, 300, 0, 4)
+	after, err := scrapeCache(context.Background(), srv.Client(), srv.URL)
+	require.NoError(t, err)
+
+	total := 0
+	for _, kind := range kinds {
+		s := rep.kinds[kind]
+		assert.NotEmpty(t, s.latencies, kind)
+		assert.Zero(t, s.errors, kind)
+		assert.Empty(t, s.unexpected, "%s got unexpected statuses", kind)
+		total += len(s.latencies)
+	}
+	assert.Equal(t, 300, total)
+	assert.Equal(t, float64(300), after["cache_hits_total"]+after["cache_misses_total"]-before["cache_hits_total"]-before["cache_misses_total"])
+
+	var out strings.Builder
+	printCache(&out, before, after)
+	assert.Contains(t, out.String(), "hit ratio")
+}
+
+func TestPickerMixAndPopularity(t *testing.T) {
+	uids := make([]string, 1000)
+	for i := range uids {
+		uids[i] = fmt.Sprint(i)
+	}
+	pick := newPicker(uids, 42, 1.2, 0.1, 0.05)
+	byKind := make(map[string]int)
+	byUID := make(map[string]int)
+	const n = 20000
+	for range n {
+		kind, uid := pick.next()
+		byKind[kind]++
+		if kind == kindHit {
+			byUID[uid]++
+		}
+	}
+	assert.InDelta(t, 0.05*n, byKind[kindNotFound], 0.01*n)
+	assert.InDelta(t, 0.1*n, byKind[kindMiss], 0.01*n)
+	assert.Greater(t, byUID["0"], byUID["10"], "the head of the pool is the most popular")
+	assert.Greater(t, byUID["10"], byUID["500"])
+}
+
+func TestParseCounters(t *testing.T) {
+	metrics := `# HELP cache_hits_total hits
+cache_hits_total 12
+cache_misses_total 3e+00
+http_requests_total{code="200"} 5
+`
+	got, err := parseCounters(strings.NewReader(metrics), []string{"cache_hits_total", "cache_misses_total"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"cache_hits_total": 12, "cache_misses_total": 3}, got)
+
+	_, err = parseCounters(strings.NewReader(metrics), []string{"negative_cache_hits_total"})
+	assert.ErrorContains(t, err, "not found")
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// счетчики кэша сервера из metrics/prometheus.go, по разнице до и после прогона считается hit ratio
+var cacheCounters = []string{"cache_hits_total", "cache_misses_total", "negative_cache_hits_total"}
+
+// scrapeCache забирает /metrics и достает из текстового формата счетчики кэша
+func scrapeCache(ctx context.Context, client *http.Client, base string) (map[string]float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/metrics", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metrics: unexpected status %s", resp.Status)
+	}
+	return parseCounters(resp.Body, cacheCounters)
+}
+
+// parseCounters понимает строки "name value" текстового формата prometheus, метрики с лейблами не нужны
+func parseCounters(r io.Reader, names []string) (map[string]float64, error) {
+	values := make(map[string]float64, len(names))
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !slices.Contains(names, fields[0]) {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("metric %s: %w", fields[0], err)
+		}
+		values[fields[0]] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if _, has := values[name]; !has {
+			return nil, fmt.Errorf("metric %s not found", name)
+		}
+	}
+	return values, nil
+}
+
+func printCache(w io.Writer, before, after map[string]float64) {
+	hits := after["cache_hits_total"] - before["cache_hits_total"]
+	misses := after["cache_misses_total"] - before["cache_misses_total"]
+	negative := after["negative_cache_hits_total"] - before["negative_cache_hits_total"]
+	hitRatio := "-"
+	if hits+misses > 0 {
+		hitRatio = fmt.Sprintf("%.2f%%", 100*hits/(hits+misses))
+	}
+	// счетчики общие для всего сервера: чужие запросы во время прогона тоже сюда попадут
+	_, _ = fmt.Fprintf(w, "server cache: hits +%.0f, misses +%.0f, hit ratio %s, negative cache hits +%.0f\n",
+		hits, misses, hitRatio, negative)
+}
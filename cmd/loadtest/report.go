@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// границы корзин гистограммы задержек, последняя корзина - все, что дольше
+var buckets = []time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond,
+	25 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond,
+	250 * time.Millisecond, 500 * time.Millisecond, time.Second,
+}
+
+type kindStats struct {
+	latencies []time.Duration
+	// ответ пришел, но не тот, что ждали: 404 на известный uid, 200 на несуществующий, 5xx
+	unexpected map[int]int
+	errors     int
+	lastErr    error
+}
+
+// report копит задержки и ответы по видам запросов
+type report struct {
+	mu    sync.Mutex
+	kinds map[string]*kindStats
+}
+
+func newReport() *report {
+	r := &report{kinds: make(map[string]*kindStats, len(kinds))}
+	for _, kind := range kinds {
+		r.kinds[kind] = &kindStats{unexpected: make(map[int]int)}
+	}
+	return r
+}
+
+func (r *report) observe(kind string, latency time.Duration, status int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.kinds[kind]
+	if err != nil {
+		s.errors++
+		s.lastErr = err
+		return
+	}
+	s.latencies = append(s.latencies, latency)
+	want := http.StatusOK
+	if kind == kindNotFound {
+		want = http.StatusNotFound
+	}
+	if status != want {
+		s.unexpected[status]++
+	}
+}
+
+// percentile - значение, не меньше которого p процентов отсортированных latencies (nearest rank)
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	return sorted[min(max(rank, 0), len(sorted)-1)]
+}
+
+// histogram - сколько задержек попало в каждую корзину buckets плюс последняя корзина для остальных
+func histogram(latencies []time.Duration) []int {
+	counts := make([]int, len(buckets)+1)
+	for _, latency := range latencies {
+		i, _ := slices.BinarySearch(buckets, latency)
+		counts[i]++
+	}
+	return counts
+}
+
+func (r *report) print(w io.Writer, elapsed time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	_, _ = fmt.Fprintln(tw, "kind\trequests\trps\terrors\tunexpected\terror rate\tp50\tp90\tp99\tmax\t")
+	var all []time.Duration
+	total, failed := 0, 0
+	for _, kind := range kinds {
+		s := r.kinds[kind]
+		sorted := slices.Clone(s.latencies)
+		slices.Sort(sorted)
+		all = append(all, sorted...)
+
+		unexpected := 0
+		for _, n := range s.unexpected {
+			unexpected += n
+		}
+		requests := len(sorted) + s.errors
+		total += requests
+		failed += s.errors + unexpected
+		var maxLatency time.Duration
+		if len(sorted) > 0 {
+			maxLatency = sorted[len(sorted)-1]
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%.1f\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t\n", kind, requests,
+			float64(requests)/elapsed.Seconds(), s.errors, unexpected, ratio(s.errors+unexpected, requests),
+			percentile(sorted, 50), percentile(sorted, 90), percentile(sorted, 99), maxLatency)
+	}
+	_ = tw.Flush()
+	_, _ = fmt.Fprintf(w, "total: %d requests in %s, %.1f req/s, error rate %s\n",
+		total, elapsed.Round(time.Millisecond), float64(total)/elapsed.Seconds(), ratio(failed, total))
+
+	for _, kind := range kinds {
+		s := r.kinds[kind]
+		if len(s.unexpected) > 0 {
+			_, _ = fmt.Fprintf(w, "%s unexpected statuses: %v\n", kind, s.unexpected)
+		}
+		if s.lastErr != nil {
+			_, _ = fmt.Fprintf(w, "%s last error: %v\n", kind, s.lastErr)
+		}
+	}
+	if len(all) == 0 {
+		return
+	}
+
+	_, _ = fmt.Fprintln(w, "latency histogram:")
+	counts := histogram(all)
+	peak := slices.Max(counts)
+	tw = tabwriter.NewWriter(w, 0, 0, 1, ' ', tabwriter.AlignRight)
+	for i, n := range counts {
+		label := "> " + buckets[len(buckets)-1].String()
+		if i < len(buckets) {
+			label = "<= " + buckets[i].String()
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%s\t %s\n", label, n, ratio(n, len(all)), strings.Repeat("#", n*40/peak))
+	}
+	_ = tw.Flush()
+}
+
+func ratio(n, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f%%", 100*float64(n)/float64(total))
+}
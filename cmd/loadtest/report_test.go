@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	counts := histogram([]time.Duration{
+		500 * time.Microsecond, time.Millisecond, 3 * time.Millisecond, 2 * time.Second,
+	})
+	assert.Len(t, counts, len(buckets)+1)
+	assert.Equal(t, 2, counts[0], "bucket bounds are inclusive")
+	assert.Equal(t, 1, counts[2])
+	assert.Equal(t, 1, counts[len(buckets)])
+}
+
+func TestReportPrint(t *testing.T) {
+	rep := newReport()
+	rep.observe(kindHit, time.Millisecond, http.StatusOK, nil)
+	rep.observe(kindHit, 3*time.Millisecond, http.StatusNotFound, nil)
+	rep.observe(kindNotFound, 2*time.Millisecond, http.StatusNotFound, nil)
+	rep.observe(kindMiss, 0, 0, errors.New("connection refused"))
+
+	var out strings.Builder
+	rep.print(&out, time.Second)
+	assert.Contains(t, out.String(), "total: 4 requests")
+	assert.Contains(t, out.String(), "error rate 50.00%")
+	assert.Contains(t, out.String(), "hit unexpected statuses: map[404:1]")
+	assert.Contains(t, out.String(), "miss last error: connection refused")
+	assert.Contains(t, out.String(), "<= 1ms")
+}
@@ -2,36 +2,50 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"flag"
 	"fmt"
+	"github.com/GameXost/wbTestCase/internal/chaos"
+	"github.com/GameXost/wbTestCase/internal/codec"
+	"github.com/GameXost/wbTestCase/internal/config"
 	"github.com/GameXost/wbTestCase/internal/generator"
+	"github.com/GameXost/wbTestCase/internal/kafka"
 	"github.com/GameXost/wbTestCase/internal/models"
 	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sr"
 	"log"
-	"math/rand"
 	"os"
-	"strconv"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
-var count = 1000
-
 type Producer struct {
-	client *kgo.Client
-	topic  string
+	client      *kgo.Client
+	topic       string
+	encoder     *codec.Encoder
+	keyStrategy string
 }
 
-func NewProducer(brokers []string, topic string) (*Producer, error) {
-	client, err := kgo.NewClient(
+// keyStrategy - чем ключевать записи (order_uid, customer_id, shardkey): заказы с одним ключом идут в одну партицию.
+// opts дополняют настройки клиента (сжатие, батчи)
+func NewProducer(brokers []string, topic string, encoder *codec.Encoder, keyStrategy string, opts ...kgo.Opt) (*Producer, error) {
+	if _, err := kafka.OrderKey(keyStrategy, &models.Order{}); err != nil {
+		return nil, err
+	}
+	client, err := kgo.NewClient(append([]kgo.Opt{
 		kgo.SeedBrokers(brokers...),
 		kgo.RequiredAcks(kgo.AllISRAcks()),
-	)
+	}, opts...)...)
 	if err != nil {
 		return nil, err
 	}
 	return &Producer{
-		client: client,
-		topic:  topic,
+		client:      client,
+		topic:       topic,
+		encoder:     encoder,
+		keyStrategy: keyStrategy,
 	}, nil
 }
 
@@ -39,52 +53,441 @@ func (p *Producer) Close() {
 	p.client.Close()
 }
 
-func (p *Producer) PublishOrder(ctx context.Context, order *models.Order) error {
-	data, err := json.Marshal(order)
+// Publish отдает заказ в буфер клиента и не ждет подтверждения: done вызывается с записью, когда брокер ответил.
+// Записи копятся в батчи по партициям и уходят пачками. headers добавляются к content-type
+func (p *Producer) Publish(ctx context.Context, order *models.Order, headers []kgo.RecordHeader, done func(*kgo.Record, error)) error {
+	data, err := p.encoder.Encode(order)
 	if err != nil {
 		return err
 	}
+	return p.PublishValue(ctx, order, data, headers, done)
+}
 
-	record := &kgo.Record{
-		Topic: p.topic,
-		Key:   []byte(order.OrderUId),
-		Value: data,
+// PublishValue - Publish с уже готовым значением, например заведомо битым. Ключ по-прежнему считается из order
+func (p *Producer) PublishValue(ctx context.Context, order *models.Order, value []byte, headers []kgo.RecordHeader, done func(*kgo.Record, error)) error {
+	key, err := kafka.OrderKey(p.keyStrategy, order)
+	if err != nil {
+		return err
 	}
 
-	results := p.client.ProduceSync(ctx, record)
-	if err = results.FirstErr(); err != nil {
-		return fmt.Errorf("kafka produce error: %w", err)
+	record := &kgo.Record{
+		Topic:   p.topic,
+		Key:     []byte(key),
+		Value:   value,
+		Headers: append([]kgo.RecordHeader{{Key: codec.HeaderContentType, Value: []byte(p.encoder.ContentType())}}, headers...),
 	}
+	p.client.Produce(ctx, record, func(r *kgo.Record, err error) {
+		if err != nil {
+			err = fmt.Errorf("kafka produce error: %w", err)
+		}
+		done(r, err)
+	})
 	return nil
 }
 
+// Flush ждет подтверждения всех отданных записей
+func (p *Producer) Flush(ctx context.Context) error {
+	return p.client.Flush(ctx)
+}
+
 func main() {
+	format := flag.String("format", codec.FormatJSON, "value encoding: json, protobuf or avro")
+	registryURL := flag.String("registry", os.Getenv("KAFKA_SCHEMA_REGISTRY_URL"), "schema registry url, required for protobuf and avro")
+	subject := flag.String("subject", "orders-value", "schema registry subject to register the schema under")
+	keyStrategy := flag.String("key", envOr("KAFKA_KEY_STRATEGY", config.KeyStrategyOrderUID), "record key: order_uid, customer_id or shardkey")
+	brokers := flag.String("brokers", envOr("KAFKA_BROKERS", "localhost:9092"), "comma separated kafka brokers")
+	topic := flag.String("topic", envOr("KAFKA_TOPIC", "orders"), "topic to produce to")
+	count := flag.Int("count", 1000, "orders to send, 0 - until -duration is over")
+	rate := flag.Float64("rate", 0, "target orders per second, 0 - as fast as possible")
+	duration := flag.Duration("duration", 0, "stop after this time, 0 - only -count limits the run")
+	invalidRatio := flag.Float64("invalid", 0.2, "share of orders that fail validation")
+	duplicateRatio := flag.Float64("duplicates", 0, "share of records that repeat an already sent order")
+	chaosRatio := flag.Float64("chaos", 0, "share of new records that are chaos: broken json, wrong types, nulls, oversized, divergent duplicates; json only")
+	manifestPath := flag.String("manifest", "", "write every sent record with its partition, offset and expected outcome to this NDJSON file")
+	burst := flag.Int("burst", 0, "with -rate: send this many records at once every -burst-every")
+	burstEvery := flag.Duration("burst-every", 10*time.Second, "how often to send a -burst")
+	compression := flag.String("compression", "none", "batch compression: none, gzip, snappy, lz4 or zstd")
+	linger := flag.Duration("linger", 5*time.Millisecond, "how long to wait filling a batch before sending it")
+	concurrency := flag.Int("concurrency", 4, "goroutines encoding and producing orders")
+	seed := flag.Uint64("seed", 0, "generator seed, the same seed gives the same orders; 0 - random")
+	genOpts := generator.DefaultOptions()
+	flag.IntVar(&genOpts.MaxItems, "items", genOpts.MaxItems, "max items per order, each order gets 1..items")
+	flag.TextVar(&genOpts.From, "from", genOpts.From, "earliest date_created of generated orders, RFC 3339")
+	flag.TextVar(&genOpts.To, "to", genOpts.To, "latest date_created of generated orders, RFC 3339")
+	flag.Parse()
+
+	if *count <= 0 && *duration <= 0 {
+		log.Fatal("either -count or -duration must be set")
+	}
+	if genOpts.MaxItems <= 0 || !genOpts.To.After(genOpts.From) {
+		log.Fatal("-items must be positive and -to must be after -from")
+	}
+	if *chaosRatio > 0 && *format != codec.FormatJSON {
+		log.Fatal("-chaos works only with -format json")
+	}
+	if *burst > 0 && (*rate <= 0 || *burstEvery <= 0) {
+		log.Fatal("-burst needs -rate and a positive -burst-every")
+	}
+	codecOpt, err := compressionCodec(*compression)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+
+	var registry *sr.Client
+	if *registryURL != "" {
+		if registry, err = sr.NewClient(sr.URLs(*registryURL)); err != nil {
+			log.Fatalf("failed to create schema registry client: %v", err)
+		}
+	}
+	encoder, err := codec.NewEncoder(ctx, registry, *format, *subject)
+	if err != nil {
+		log.Fatalf("failed to create encoder: %v", err)
+	}
 
-	ctx := context.Background()
-	brokers := strings.Split(os.Getenv("KAFKA_BROKERS"), ",")
-	producer, err := NewProducer(brokers, "orders")
+	producer, err := NewProducer(strings.Split(*brokers, ","), *topic, encoder, *keyStrategy,
+		kgo.ProducerBatchCompression(codecOpt), kgo.ProducerLinger(*linger))
 	if err != nil {
 		log.Fatalf("failed to create producer: %v", err)
 	}
 	defer producer.Close()
 
-	log.Println("Producer started sending messages...")
+	gen := generator.NewWithOptions(*seed, genOpts)
+	log.Printf("producer started: topic %s, count %d, rate %.0f/s, duration %s, concurrency %d, seed %d, items %d, dates %s..%s",
+		*topic, *count, *rate, *duration, *concurrency, gen.Seed(), genOpts.MaxItems,
+		genOpts.From.Format(time.RFC3339), genOpts.To.Format(time.RFC3339))
+	src := &orderSource{invalidRatio: *invalidRatio, duplicateRatio: *duplicateRatio, chaosRatio: *chaosRatio, gen: gen}
+	opts := runOptions{count: *count, rate: *rate, concurrency: max(*concurrency, 1), burst: *burst, burstEvery: *burstEvery}
+	if *manifestPath != "" {
+		if opts.manifest, err = chaos.CreateManifest(*manifestPath); err != nil {
+			log.Fatalf("failed to create manifest: %v", err)
+		}
+	}
+	stats := &stats{}
+	start := time.Now()
+	run(ctx, producer, src, stats, opts)
+
+	// подтверждения дожидаемся, даже если время вышло, но не вечно
+	flushCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err = producer.Flush(flushCtx); err != nil {
+		log.Printf("flush: %v", err)
+	}
+	stats.print(os.Stdout, time.Since(start))
+	// манифест закрываем после Flush: колбэки дописывают в него подтверждения
+	if opts.manifest != nil {
+		if err = opts.manifest.Close(); err != nil {
+			log.Fatalf("manifest: %v", err)
+		}
+	}
+}
+
+type runOptions struct {
+	// count - сколько записей отправить, 0 - пока не отменен ctx
+	count int
+	// rate - записей в секунду, 0 - как можно быстрее
+	rate        float64
+	concurrency int
+	// burst записей разом раз в burstEvery поверх rate
+	burst      int
+	burstEvery time.Duration
+	// manifest - куда писать отправленное, nil - никуда
+	manifest *chaos.Manifest
+}
+
+// run раздает номера заказов воркерам в темпе rate, пока не отправлено count или не отменен ctx
+func run(ctx context.Context, producer *Producer, src *orderSource, stats *stats, opts runOptions) {
+	// отданные записи досылаются и после отмены: ctx останавливает только выдачу новых
+	produceCtx := context.WithoutCancel(ctx)
+	jobs := make(chan struct{})
+	var wg sync.WaitGroup
+	for range max(opts.concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				msg := src.next()
+				// копия сохраняемого заказа уходит только после подтверждения оригинала: тогда в партиции
+				// она точно дальше, и консьюмер сохранит оригинал, а копию посчитает дублем
+				if err := msg.after.wait(); err != nil {
+					err = fmt.Errorf("original not delivered: %w", err)
+					stats.observe(0, err)
+					if opts.manifest != nil {
+						opts.manifest.Add(msg.entry(nil, err))
+					}
+					continue
+				}
+				sent := time.Now()
+				done := func(r *kgo.Record, err error) {
+					stats.observe(time.Since(sent), err)
+					msg.ack.finish(err)
+					if opts.manifest != nil {
+						opts.manifest.Add(msg.entry(r, err))
+					}
+				}
+				var err error
+				if msg.value != nil {
+					err = producer.PublishValue(produceCtx, msg.order, msg.value, msg.headers(), done)
+				} else {
+					err = producer.Publish(produceCtx, msg.order, msg.headers(), done)
+				}
+				if err != nil {
+					stats.observe(0, err)
+					msg.ack.finish(err)
+					if opts.manifest != nil {
+						opts.manifest.Add(msg.entry(nil, err))
+					}
+				}
+			}
+		}()
+	}
+
+	var tick, burstTick <-chan time.Time
+	if opts.rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.rate))
+		defer ticker.Stop()
+		tick = ticker.C
+		if opts.burst > 0 && opts.burstEvery > 0 {
+			burstTicker := time.NewTicker(opts.burstEvery)
+			defer burstTicker.Stop()
+			burstTick = burstTicker.C
+		}
+	}
+	// сколько записей всплеска осталось отправить без ожидания тика
+	burstLeft := 0
+loop:
+	for i := 0; opts.count <= 0 || i < opts.count; i++ {
+		if tick != nil && burstLeft == 0 {
+			select {
+			case <-ctx.Done():
+				break loop
+			case <-tick:
+			case <-burstTick:
+				burstLeft = opts.burst
+			}
+		}
+		if burstLeft > 0 {
+			burstLeft--
+		}
+		select {
+		case <-ctx.Done():
+			break loop
+		case jobs <- struct{}{}:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// orderSource выдает заказы: валидные, испорченные, хаос и повторы уже отправленных.
+// Все решения берутся из генератора, поэтому один seed дает одну и ту же последовательность заказов
+type orderSource struct {
+	invalidRatio   float64
+	duplicateRatio float64
+	// доля хаоса среди новых записей, из оставшихся invalidRatio - испорченные
+	chaosRatio float64
+
+	mu   sync.Mutex
+	gen  *generator.Generator
+	sent []message
+	// записи, которые консьюмер сохранит: оригиналы для расходящихся дублей.
+	// Пишутся по кругу, а не через генератор, чтобы не сбивать последовательность без хаоса
+	persisted     []message
+	persistedNext int
+}
+
+// message - что отправить и что консьюмер должен с этим сделать
+type message struct {
+	kind  string
+	order *models.Order
+	// готовое значение записи хаоса, у остальных nil - order кодирует энкодер
+	value []byte
+	// имя порчи из каталога генератора, у остальных пустое
+	mutation string
 
-	for i := 1; i <= count; i++ {
-		orderUID := strconv.Itoa(rand.Int())
-		var order *models.Order
-		if rand.Intn(10) < 8 {
-			order = generator.ValidOrder(orderUID)
+	expect, reason string
+	// транзакция заказа, который должен остаться в бд
+	transaction string
+
+	// ack - подтверждение этой записи, его ждут ее копии; есть только у новых сохраняемых записей
+	ack *ack
+	// after - подтверждение оригинала, которого надо дождаться перед отправкой; nil - ждать нечего
+	after *ack
+}
+
+// ack - ответ брокера на запись: done закрывается, когда он пришел, err - с чем
+type ack struct {
+	done chan struct{}
+	err  error
+}
+
+func newAck() *ack {
+	return &ack{done: make(chan struct{})}
+}
+
+func (a *ack) finish(err error) {
+	if a == nil {
+		return
+	}
+	a.err = err
+	close(a.done)
+}
+
+// wait ждет ответа брокера и возвращает его ошибку, у nil - сразу
+func (a *ack) wait() error {
+	if a == nil {
+		return nil
+	}
+	<-a.done
+	return a.err
+}
+
+// сколько последних заказов помнить для дублей
+const duplicateWindow = 1000
+
+func (s *orderSource) next() message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.sent) > 0 && s.gen.Float64() < s.duplicateRatio {
+		return s.sent[s.gen.IntN(len(s.sent))].repeat()
+	}
+
+	var msg message
+	// без хаоса генератор не дергается лишний раз, и seed дает те же заказы, что и раньше
+	if s.chaosRatio > 0 && s.gen.Float64() < s.chaosRatio {
+		msg = s.chaos()
+	} else {
+		orderUID := s.gen.OrderUID()
+		if s.gen.Float64() < s.invalidRatio {
+			order, mutation := s.gen.InvalidOrder(orderUID)
+			msg = newMessage(chaos.KindInvalid, order)
+			msg.mutation = mutation
 		} else {
-			order = generator.InvalidOrder(orderUID)
+			msg = newMessage(chaos.KindValid, s.gen.ValidOrder(orderUID))
 		}
-		if err = producer.PublishOrder(ctx, order); err != nil {
-			log.Printf("Failed to send order %s: %v", order.OrderUId, err)
-			continue
+	}
+	if msg.expect == chaos.ExpectPersisted {
+		msg.ack = newAck()
+		if s.chaosRatio > 0 {
+			s.remember(msg)
 		}
-		log.Printf("order: %s", order.OrderUId)
+	}
+	if len(s.sent) < duplicateWindow {
+		s.sent = append(s.sent, msg)
+	} else {
+		s.sent[s.gen.IntN(duplicateWindow)] = msg
+	}
+	return msg
+}
 
+// remember запоминает сохраняемую запись как оригинал для расходящихся дублей
+func (s *orderSource) remember(msg message) {
+	if len(s.persisted) < duplicateWindow {
+		s.persisted = append(s.persisted, msg)
+	} else {
+		s.persisted[s.persistedNext%duplicateWindow] = msg
 	}
+	s.persistedNext++
+}
 
-	log.Println("Donon")
+// chaos - случайный вид хаоса, расходящийся дубль - один из видов наравне с остальными
+func (s *orderSource) chaos() message {
+	if n := len(chaos.Kinds()); len(s.persisted) > 0 && s.gen.IntN(n+1) == n {
+		original := s.persisted[s.gen.IntN(len(s.persisted))]
+		return message{
+			kind:        chaos.KindDivergentDuplicate,
+			order:       chaos.Diverge(s.gen, original.order),
+			expect:      chaos.ExpectDuplicate,
+			transaction: original.transaction,
+			after:       original.ack,
+		}
+	}
+	rec := chaos.New(s.gen)
+	msg := message{kind: rec.Kind, order: rec.Order, value: rec.Value, expect: rec.Expect, reason: rec.Reason}
+	if msg.expect == chaos.ExpectPersisted {
+		msg.transaction = rec.Order.Payment.Transaction
+	}
+	return msg
+}
+
+func newMessage(kind string, order *models.Order) message {
+	msg := message{kind: kind, order: order}
+	msg.expect, msg.reason = chaos.Expect(order)
+	if msg.expect == chaos.ExpectPersisted {
+		msg.transaction = order.Payment.Transaction
+	}
+	return msg
+}
+
+// repeat - та же запись еще раз: сохраняемое становится дублем и ждет подтверждения оригинала, битое снова идет в dlq
+func (m message) repeat() message {
+	m.kind = chaos.KindRepeat
+	if m.expect == chaos.ExpectPersisted {
+		m.expect = chaos.ExpectDuplicate
+	}
+	// повтор расходящегося дубля ждет того же оригинала, что и сам дубль
+	if m.ack != nil {
+		m.after, m.ack = m.ack, nil
+	}
+	return m
+}
+
+func (m message) headers() []kgo.RecordHeader {
+	var headers []kgo.RecordHeader
+	if m.mutation != "" {
+		headers = append(headers, kgo.RecordHeader{Key: generator.HeaderMutation, Value: []byte(m.mutation)})
+	}
+	if m.value != nil || m.kind == chaos.KindDivergentDuplicate {
+		headers = append(headers, kgo.RecordHeader{Key: chaos.HeaderKind, Value: []byte(m.kind)})
+	}
+	return headers
+}
+
+// entry - строка манифеста, r - запись из колбэка продюсера, nil если до продюсера не дошло
+func (m message) entry(r *kgo.Record, err error) chaos.Entry {
+	e := chaos.Entry{
+		Kind:        m.kind,
+		Mutation:    m.mutation,
+		OrderUID:    m.order.OrderUId,
+		Expect:      m.expect,
+		Reason:      m.reason,
+		Transaction: m.transaction,
+	}
+	if r != nil {
+		e.Key, e.Topic, e.Partition, e.Offset = string(r.Key), r.Topic, r.Partition, r.Offset
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
+
+func compressionCodec(name string) (kgo.CompressionCodec, error) {
+	switch name {
+	case "none":
+		return kgo.NoCompression(), nil
+	case "gzip":
+		return kgo.GzipCompression(), nil
+	case "snappy":
+		return kgo.SnappyCompression(), nil
+	case "lz4":
+		return kgo.Lz4Compression(), nil
+	case "zstd":
+		return kgo.ZstdCompression(), nil
+	}
+	return kgo.CompressionCodec{}, fmt.Errorf("unknown compression %q", name)
+}
+
+func envOr(key, defaultVal string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultVal
 }
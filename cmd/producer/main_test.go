@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/GameXost/wbTestCase/internal/chaos"
+	"github.com/GameXost/wbTestCase/internal/codec"
+	"github.com/GameXost/wbTestCase/internal/config"
+	"github.com/GameXost/wbTestCase/internal/generator"
+	"github.com/GameXost/wbTestCase/internal/generator/generatortest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunSendsCountWithDuplicates(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(3, "orders"))
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	encoder, err := codec.NewEncoder(context.Background(), nil, codec.FormatJSON, "")
+	require.NoError(t, err)
+	producer, err := NewProducer(cluster.ListenAddrs(), "orders", encoder, config.KeyStrategyOrderUID,
+		kgo.ProducerBatchCompression(kgo.ZstdCompression()))
+	require.NoError(t, err)
+	defer producer.Close()
+
+	src := &orderSource{duplicateRatio: 0.5, gen: generatortest.New(t)}
+	st := &stats{}
+	run(context.Background(), producer, src, st, runOptions{count: 200, concurrency: 4})
+	require.NoError(t, producer.Flush(context.Background()))
+
+	assert.Len(t, st.latencies, 200)
+	assert.Zero(t, st.failed)
+	assert.Less(t, len(src.sent), 150, "about half of the records repeat sent orders")
+}
+
+func TestRunStopsOnDeadline(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(1, "orders"))
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	encoder, err := codec.NewEncoder(context.Background(), nil, codec.FormatJSON, "")
+	require.NoError(t, err)
+	producer, err := NewProducer(cluster.ListenAddrs(), "orders", encoder, config.KeyStrategyOrderUID)
+	require.NoError(t, err)
+	defer producer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	st := &stats{}
+	run(ctx, producer, &orderSource{gen: generatortest.New(t)}, st, runOptions{rate: 20, concurrency: 2})
+	require.NoError(t, producer.Flush(context.Background()))
+
+	// 20 msg/s за 0.3s - около шести записей, а не бесконечно
+	assert.InDelta(t, 6, len(st.latencies), 3)
+	assert.Zero(t, st.failed)
+}
+
+func TestOrderSourceIsReproducible(t *testing.T) {
+	first := &orderSource{invalidRatio: 0.3, duplicateRatio: 0.2, chaosRatio: 0.3, gen: generator.New(42)}
+	second := &orderSource{invalidRatio: 0.3, duplicateRatio: 0.2, chaosRatio: 0.3, gen: generator.New(42)}
+	for range 200 {
+		a, b := first.next(), second.next()
+		assert.Equal(t, a.ack != nil, b.ack != nil)
+		assert.Equal(t, a.after != nil, b.after != nil)
+		// подтверждения у каждого источника свои
+		a.ack, a.after, b.ack, b.after = nil, nil, nil, nil
+		assert.Equal(t, a, b)
+	}
+}
+
+// копия сохраняемого заказа ждет подтверждения оригинала, а если оригинал не доехал - не отправляется
+func TestCopiesWaitForOriginal(t *testing.T) {
+	src := &orderSource{duplicateRatio: 1, gen: generatortest.New(t)}
+	original := src.next()
+	require.Equal(t, chaos.ExpectPersisted, original.expect)
+	repeat := src.next()
+	require.Equal(t, chaos.KindRepeat, repeat.kind)
+	require.Same(t, original.ack, repeat.after)
+	assert.Nil(t, repeat.ack, "nothing waits for a repeat")
+
+	waited := make(chan error)
+	go func() { waited <- repeat.after.wait() }()
+	select {
+	case <-waited:
+		t.Fatal("repeat is sent before the original is acked")
+	case <-time.After(50 * time.Millisecond):
+	}
+	original.ack.finish(errors.New("broker is down"))
+	assert.ErrorContains(t, <-waited, "broker is down")
+
+	chaotic := &orderSource{chaosRatio: 1, gen: generatortest.New(t)}
+	acks := make(map[*ack]bool)
+	for range 500 {
+		msg := chaotic.next()
+		if msg.ack != nil {
+			acks[msg.ack] = true
+		}
+		if msg.kind == chaos.KindDivergentDuplicate {
+			assert.True(t, acks[msg.after], "divergent duplicate waits for its original")
+			return
+		}
+	}
+	t.Fatal("no divergent duplicates in 500 chaos records")
+}
+
+func TestInvalidOrdersCarryMutationHeader(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(1, "orders"))
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	encoder, err := codec.NewEncoder(context.Background(), nil, codec.FormatJSON, "")
+	require.NoError(t, err)
+	producer, err := NewProducer(cluster.ListenAddrs(), "orders", encoder, config.KeyStrategyOrderUID)
+	require.NoError(t, err)
+	defer producer.Close()
+
+	st := &stats{}
+	run(context.Background(), producer, &orderSource{invalidRatio: 0.5, gen: generatortest.New(t)}, st, runOptions{count: 40, concurrency: 2})
+	require.NoError(t, producer.Flush(context.Background()))
+
+	client, err := kgo.NewClient(kgo.SeedBrokers(cluster.ListenAddrs()...), kgo.ConsumeTopics("orders"),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()))
+	require.NoError(t, err)
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var records []*kgo.Record
+	for len(records) < 40 {
+		fetches := client.PollFetches(ctx)
+		require.NoError(t, ctx.Err())
+		records = append(records, fetches.Records()...)
+	}
+
+	mutated := 0
+	for _, record := range records {
+		for _, h := range record.Headers {
+			if h.Key == generator.HeaderMutation {
+				mutated++
+				assert.Contains(t, generator.Mutations(), string(h.Value))
+			}
+		}
+	}
+	assert.InDelta(t, 20, mutated, 15, "about half of the orders are broken")
+}
+
+// в манифесте каждая отправленная запись со своей позицией и ожиданием, расходящиеся дубли - после оригинала
+func TestChaosRunWritesManifest(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(3, "orders"))
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	encoder, err := codec.NewEncoder(context.Background(), nil, codec.FormatJSON, "")
+	require.NoError(t, err)
+	producer, err := NewProducer(cluster.ListenAddrs(), "orders", encoder, config.KeyStrategyCustomerID)
+	require.NoError(t, err)
+	defer producer.Close()
+
+	path := filepath.Join(t.TempDir(), "manifest.ndjson")
+	manifest, err := chaos.CreateManifest(path)
+	require.NoError(t, err)
+	src := &orderSource{chaosRatio: 0.6, invalidRatio: 0.2, duplicateRatio: 0.1, gen: generatortest.New(t)}
+	st := &stats{}
+	run(context.Background(), producer, src, st, runOptions{count: 300, concurrency: 4, manifest: manifest})
+	require.NoError(t, producer.Flush(context.Background()))
+	require.NoError(t, manifest.Close())
+
+	entries, err := chaos.ReadManifest(path)
+	require.NoError(t, err)
+	require.Len(t, entries, 300)
+
+	type position struct {
+		partition int32
+		offset    int64
+	}
+	seen := make(map[position]bool)
+	firstAt := make(map[string]chaos.Entry)
+	kinds := make(map[string]int)
+	for _, e := range entries {
+		require.Empty(t, e.Error)
+		kinds[e.Kind]++
+		pos := position{e.Partition, e.Offset}
+		assert.False(t, seen[pos], "one record per offset")
+		seen[pos] = true
+
+		switch e.Expect {
+		case chaos.ExpectPersisted:
+			assert.NotEmpty(t, e.Transaction, e.Kind)
+			if _, has := firstAt[e.OrderUID]; !has {
+				firstAt[e.OrderUID] = e
+			}
+		case chaos.ExpectDuplicate:
+			assert.NotEmpty(t, e.Transaction, e.Kind)
+		case chaos.ExpectDeadLetter:
+			assert.NotEmpty(t, e.Reason, e.Kind)
+		}
+	}
+	// копии сохраняемых заказов лежат в партиции оригинала после него, даже когда воркеров несколько
+	for _, e := range entries {
+		if e.Expect != chaos.ExpectDuplicate {
+			continue
+		}
+		original, has := firstAt[e.OrderUID]
+		require.True(t, has, "%s of an unknown order", e.Kind)
+		assert.Equal(t, original.Transaction, e.Transaction, "the first version must stay in the db")
+		assert.Equal(t, original.Partition, e.Partition, e.Kind)
+		assert.Greater(t, e.Offset, original.Offset, e.Kind)
+	}
+	assert.NotZero(t, kinds[chaos.KindValid])
+	assert.NotZero(t, kinds[chaos.KindInvalid])
+	assert.NotZero(t, kinds[chaos.KindRepeat])
+	assert.NotZero(t, kinds[chaos.KindDivergentDuplicate])
+	for _, kind := range chaos.Kinds() {
+		assert.NotZero(t, kinds[kind], kind)
+	}
+}
+
+func TestRunSendsBursts(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(1, "orders"))
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	encoder, err := codec.NewEncoder(context.Background(), nil, codec.FormatJSON, "")
+	require.NoError(t, err)
+	producer, err := NewProducer(cluster.ListenAddrs(), "orders", encoder, config.KeyStrategyOrderUID)
+	require.NoError(t, err)
+	defer producer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 350*time.Millisecond)
+	defer cancel()
+	st := &stats{}
+	run(ctx, producer, &orderSource{gen: generatortest.New(t)}, st,
+		runOptions{rate: 10, concurrency: 2, burst: 30, burstEvery: 100 * time.Millisecond})
+	require.NoError(t, producer.Flush(context.Background()))
+
+	// без всплесков за 0.35s ушло бы три записи, с ними - три всплеска по 30
+	assert.Greater(t, len(st.latencies), 60)
+	assert.Zero(t, st.failed)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// stats копит время от отдачи записи клиенту до подтверждения брокером
+type stats struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	failed    int
+	lastErr   error
+}
+
+func (s *stats) observe(latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.failed++
+		s.lastErr = err
+		return
+	}
+	s.latencies = append(s.latencies, latency)
+}
+
+// percentile - значение, не меньше которого p процентов отсортированных latencies (nearest rank)
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	return sorted[min(max(rank, 0), len(sorted)-1)]
+}
+
+func (s *stats) print(w io.Writer, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sorted := slices.Clone(s.latencies)
+	slices.Sort(sorted)
+
+	_, _ = fmt.Fprintf(w, "acked: %d, failed: %d, elapsed: %s, throughput: %.1f msg/s\n",
+		len(sorted), s.failed, elapsed.Round(time.Millisecond), float64(len(sorted))/elapsed.Seconds())
+	if s.lastErr != nil {
+		_, _ = fmt.Fprintf(w, "last error: %v\n", s.lastErr)
+	}
+	if len(sorted) == 0 {
+		return
+	}
+	_, _ = fmt.Fprintf(w, "latency p50: %s, p90: %s, p99: %s, max: %s\n",
+		percentile(sorted, 50), percentile(sorted, 90), percentile(sorted, 99), sorted[len(sorted)-1])
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i+1) * time.Millisecond
+	}
+	assert.Equal(t, 50*time.Millisecond, percentile(sorted, 50))
+	assert.Equal(t, 99*time.Millisecond, percentile(sorted, 99))
+	assert.Equal(t, 100*time.Millisecond, percentile(sorted, 100))
+	assert.Equal(t, time.Millisecond, percentile(sorted, 0))
+	assert.Equal(t, time.Duration(0), percentile(nil, 50))
+}
+
+func TestStatsPrint(t *testing.T) {
+	s := &stats{}
+	s.observe(2*time.Millisecond, nil)
+	s.observe(time.Millisecond, nil)
+	s.observe(0, errors.New("broker is down"))
+
+	var out strings.Builder
+	s.print(&out, time.Second)
+	assert.Contains(t, out.String(), "acked: 2, failed: 1")
+	assert.Contains(t, out.String(), "throughput: 2.0 msg/s")
+	assert.Contains(t, out.String(), "last error: broker is down")
+	assert.Contains(t, out.String(), "p50: 1ms")
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/codec"
+	"github.com/GameXost/wbTestCase/internal/config"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/GameXost/wbTestCase/internal/repository"
+	"github.com/GameXost/wbTestCase/internal/service"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/twmb/franz-go/pkg/sr"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// пересобирает нормализованные таблицы заказов из raw_orders после изменения модели или валидации.
+// Записи, которые больше не разбираются или не проходят валидацию, остаются как были
+func main() {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	batch := flag.Int("batch", 500, "raw records read per query")
+	registryURL := flag.String("registry", cfg.Kafka.SchemaRegistryURL, "schema registry url, required for protobuf and avro records")
+	dryRun := flag.Bool("dry-run", false, "only decode and validate, do not write")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var registry *sr.Client
+	if *registryURL != "" {
+		if registry, err = sr.NewClient(sr.URLs(*registryURL)); err != nil {
+			log.Fatalf("failed to create schema registry client: %v", err)
+		}
+	}
+	pool, err := pgxpool.New(ctx, cfg.DB.DSN())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pool.Close()
+
+	r := &rebuilder{repo: repository.NewRepo(pool), decoder: codec.NewDecoder(registry), dryRun: *dryRun}
+	if err = r.run(ctx, max(*batch, 1)); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("rebuilt: %d, invalid: %d\n", r.rebuilt, r.invalid)
+}
+
+type rebuilder struct {
+	repo    *repository.Repo
+	decoder *codec.Decoder
+	dryRun  bool
+
+	rebuilt, invalid int
+}
+
+func (r *rebuilder) run(ctx context.Context, batch int) error {
+	after := ""
+	for {
+		list, err := r.repo.ListRawOrders(ctx, after, batch)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			return nil
+		}
+		for _, raw := range list {
+			after = raw.OrderUId
+			if err = r.rebuild(ctx, &raw); err != nil {
+				return fmt.Errorf("rebuild %s: %w", raw.OrderUId, err)
+			}
+		}
+	}
+}
+
+func (r *rebuilder) rebuild(ctx context.Context, raw *models.RawOrder) error {
+	order, err := r.decoder.Decode(ctx, contentType(raw.Headers), raw.Value)
+	if errors.Is(err, codec.ErrRegistryUnavailable) {
+		return err
+	}
+	if err == nil && order.OrderUId != raw.OrderUId {
+		err = fmt.Errorf("record now decodes as order %q", order.OrderUId)
+	}
+	if err == nil {
+		err = service.ValidateOrder(order)
+	}
+	if err != nil {
+		r.invalid++
+		log.Printf("skip %s (%s/%d@%d): %v", raw.OrderUId, raw.Topic, raw.Partition, raw.Offset, err)
+		return nil
+	}
+	if r.dryRun {
+		r.rebuilt++
+		return nil
+	}
+
+	// raw_orders ссылается на orders, так что ErrNotFound тут не бывает
+	if err = r.repo.RebuildOrder(ctx, order); err != nil {
+		return err
+	}
+	r.rebuilt++
+	return nil
+}
+
+func contentType(headers []models.Header) string {
+	for _, h := range headers {
+		if strings.EqualFold(h.Key, codec.HeaderContentType) {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/config"
+	"github.com/GameXost/wbTestCase/internal/kafka"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/GameXost/wbTestCase/internal/repository"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// разовая перемотка группы консьюмеров на момент времени, чтобы заново обработать заказы.
+// Консьюмеры группы должны быть остановлены
+func main() {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	brokers := flag.String("brokers", strings.Join(cfg.Kafka.Brokers, ","), "comma separated kafka brokers")
+	group := flag.String("group", cfg.Kafka.Group, "consumer group to rewind")
+	topic := flag.String("topic", cfg.Kafka.Topic, "topic to rewind")
+	to := flag.String("to", "", "RFC3339 time, records at or after it are consumed again (required)")
+	inDB := flag.Bool("db", cfg.Kafka.OffsetsInDB, "also rewind offsets stored in postgres (KAFKA_OFFSETS_IN_DB)")
+	flag.Parse()
+
+	at, err := time.Parse(time.RFC3339, *to)
+	if err != nil {
+		log.Fatalf("-to must be an RFC3339 time: %v", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	client, err := kgo.NewClient(kgo.SeedBrokers(strings.Split(*brokers, ",")...))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+	offsets, err := kafka.RewindGroup(ctx, kadm.NewClient(client), *group, *topic, at)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	partitions := make([]int32, 0, len(offsets))
+	for p := range offsets {
+		partitions = append(partitions, p)
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+	for _, p := range partitions {
+		fmt.Printf("%s/%d -> %d\n", *topic, p, offsets[p])
+	}
+
+	// позиции в бд главнее закоммиченных в кафке, без них перемотка ничего не даст
+	if *inDB {
+		if err = rewindDB(ctx, cfg.DB.DSN(), *group, *topic, offsets); err != nil {
+			log.Fatalf("kafka offsets are rewound, but db offsets are not: %v", err)
+		}
+		fmt.Println("db offsets rewound")
+	}
+}
+
+func rewindDB(ctx context.Context, dsn, group, topic string, offsets map[int32]int64) error {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+	repo := repository.NewRepo(pool)
+	for partition, offset := range offsets {
+		err = repo.SaveOffset(ctx, models.PartitionOffset{Group: group, Topic: topic, Partition: partition, Offset: offset})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
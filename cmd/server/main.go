@@ -43,25 +43,35 @@ func main() {
 	defer pool.Close()
 
 	//services
-	orderService, orderHandler := initLayers(pool, cfg)
+	orderService, orderCache, orderHandler, err := initLayers(pool, cfg)
+	if err != nil {
+		log.Fatalf("failed to init layers: %v", err)
+	}
 
 	//cache preload
-	if err := orderService.LoadCache(ctx, cfg.Cache.Size); err != nil {
-		log.Printf("failed to restore cache from db: %v", err)
-	} else {
-		log.Println("Cache loaded")
+	if !restoreSnapshot(ctx, cfg, orderCache, repository.NewRepo(pool)) {
+		if cfg.Cache.WarmupAsync {
+			go warmupCache(ctx, cfg, orderService)
+		} else {
+			warmupCache(ctx, cfg, orderService)
+		}
+	}
+	if cfg.Cache.SnapshotPath != "" {
+		go orderCache.RunSnapshots(ctx, cfg.Cache.SnapshotPath, cfg.Cache.SnapshotInterval)
 	}
 
 	//kafka
-	consumerErrs, err := startKafka(ctx, cfg, orderService)
+	consumer, consumerErrs, err := startKafka(ctx, cfg, orderService, repository.NewRepo(pool))
 	if err != nil {
 		log.Fatalf("failed to init kafka: %v", err)
 	}
+	orderHandler.Quarantine = consumer
+	orderHandler.Consumer = consumer
 	//prometheus
 	registerMetrics()
 
 	//router handlers
-	router := SetupRouter(orderHandler)
+	router := SetupRouter(orderHandler, cfg.Server.AdminToken)
 	httpServer := &http.Server{
 		Addr:    ":" + cfg.Server.Port,
 		Handler: router,
@@ -79,13 +89,13 @@ func main() {
 
 	select {
 	case err := <-consumerErrs:
+		// консьюмер уже вышел, ждать его при остановке не надо
+		consumerErrs = nil
 		if err != nil && !errors.Is(err, context.Canceled) {
 			log.Printf("kafka died - critical error: %v", err)
-			return
 		}
 	case err := <-serverErrors:
 		log.Printf("server error: %v", err)
-		return
 	case sig := <-shutdown:
 		log.Printf("shitdown signal: %v", sig)
 	}
@@ -100,16 +110,43 @@ func main() {
 			log.Printf("closing httpServer failed: %v", errHttp)
 		}
 	}
+	// Start на выходе коммитит обработанное, клиент закрываем только после него: Close уходит из группы
+	// и коммитит на revoke, а без ожидания процесс завершится раньше и обработанное прочитается заново
+	if consumerErrs != nil {
+		select {
+		case <-consumerErrs:
+		case <-shutdownCtx.Done():
+			log.Printf("kafka consumer did not stop in time")
+		}
+	}
+	consumer.Close()
+	if cfg.Cache.SnapshotPath != "" {
+		if err := orderCache.SaveSnapshot(cfg.Cache.SnapshotPath); err != nil {
+			log.Printf("failed to save cache snapshot: %v", err)
+		}
+	}
 	log.Println("server stopped gracefully")
 }
 
-func SetupRouter(handler *server.Handler) *chi.Mux {
+// adminToken закрывает /admin/*: release переотправляет записи в кафку, открытым на публичном порту ему не место.
+// Без токена админские ручки не поднимаются совсем
+func SetupRouter(handler *server.Handler, adminToken string) *chi.Mux {
 	r := chi.NewRouter()
 
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 
 	r.Get("/order/{order_uid}", handler.GetOrder)
+	if adminToken != "" {
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(server.AdminAuth(adminToken))
+			r.Get("/quarantine", handler.ListQuarantined)
+			r.Post("/quarantine/{id}/release", handler.ReleaseQuarantined)
+			r.Get("/consumer", handler.ConsumerStatus)
+		})
+	} else {
+		log.Println("ADMIN_TOKEN is empty, /admin endpoints are disabled")
+	}
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("OK"))
@@ -148,38 +185,67 @@ func initDB(ctx context.Context, cfg *config.Config) (*pgxpool.Pool, error) {
 	return pool, nil
 }
 
-func initLayers(pool *pgxpool.Pool, cfg *config.Config) (*service.Service, *server.Handler) {
+func initLayers(pool *pgxpool.Pool, cfg *config.Config) (*service.Service, *cache.Cache, *server.Handler, error) {
 	orderRepo := repository.NewRepo(pool)
-	orderCache := cache.NewCache(cfg.Cache.Size)
-	orderService := service.NewService(orderRepo, orderCache)
+	policy, err := cache.NewPolicy(cfg.Cache.Policy, cfg.Cache.Size)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	orderCache := cache.NewCacheWithPolicy(cfg.Cache.Size, policy)
+	var misses service.MissCache
+	if cfg.Cache.NegativeSize > 0 {
+		misses = cache.NewNegativeCache(cfg.Cache.NegativeSize, cfg.Cache.NegativeTTL)
+	}
+	orderService := service.NewService(orderRepo, orderCache, misses)
 	orderHandler := server.NewHandler(orderService)
 	log.Println("initialized all layers")
-	return orderService, orderHandler
+	return orderService, orderCache, orderHandler, nil
 }
 
-func startKafka(ctx context.Context, cfg *config.Config, srvs *service.Service) (<-chan error, error) {
+func warmupCache(ctx context.Context, cfg *config.Config, srvs *service.Service) {
+	opts := service.WarmupOptions{
+		ChunkSize:   cfg.Cache.WarmupChunkSize,
+		Concurrency: cfg.Cache.WarmupConcurrency,
+	}
+	if err := srvs.LoadCache(ctx, cfg.Cache.Size, opts); err != nil {
+		log.Printf("failed to restore cache from db: %v", err)
+		return
+	}
+	log.Println("Cache loaded")
+}
 
-	consumer, err := kafka.NewConsumer(
-		cfg.Kafka.Brokers,
-		cfg.Kafka.Topic,
-		cfg.Kafka.Group,
-		srvs,
-		cfg.Kafka.DLQTopic,
-	)
+// restoreSnapshot поднимает кэш с диска, false - надо греть из бд
+func restoreSnapshot(ctx context.Context, cfg *config.Config, orderCache *cache.Cache, repo *repository.Repo) bool {
+	if cfg.Cache.SnapshotPath == "" {
+		return false
+	}
+	n, err := orderCache.LoadSnapshot(ctx, cfg.Cache.SnapshotPath, cfg.Cache.SnapshotMaxAge, repo.CancelledIDs)
 	if err != nil {
-		return nil, err
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("cache snapshot unusable, warming up from db: %v", err)
+		}
+		return false
 	}
+	log.Printf("cache restored from snapshot: %d orders", n)
+	return true
+}
 
+func startKafka(ctx context.Context, cfg *config.Config, srvs *service.Service, repo *repository.Repo) (*kafka.Consumer, <-chan error, error) {
+
+	consumer, err := kafka.NewConsumer(cfg.Kafka, srvs, repo, repo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// в канал приходит результат Start, в том числе nil: по нему main понимает, что консьюмер вышел
 	errChan := make(chan error, 1)
 
 	go func() {
 		log.Println("Kafka consumer started")
-		if err := consumer.Start(ctx); err != nil {
-			errChan <- err
-		}
+		errChan <- consumer.Start(ctx)
 	}()
 
-	return errChan, nil
+	return consumer, errChan, nil
 }
 
 func registerMetrics() {
@@ -190,6 +256,24 @@ func registerMetrics() {
 		metrics.RequestsNotFound,
 		metrics.CacheHits,
 		metrics.CacheMisses,
+		metrics.NegativeCacheHits,
+		metrics.CacheWarmupLoaded,
+		metrics.CacheWarmupFailures,
+		metrics.CacheWarmupProgress,
+		metrics.CacheWarmupDuration,
+		metrics.ConsumerCircuitOpen,
+		metrics.DLQMessages,
+		metrics.QuarantinedMessages,
+		metrics.ConsumerStoppedPartitions,
+		metrics.ConsumerRecordsConsumed,
+		metrics.ConsumerRecordsPersisted,
+		metrics.ConsumerRecordsDuplicated,
+		metrics.ConsumerStageDuration,
+		metrics.ConsumerLag,
+		metrics.ConsumerCommitFailures,
+		metrics.ConsumerRebalances,
+		metrics.ConsumerTombstones,
+		metrics.ConsumerKeyMismatches,
 		metrics.RequestsSuccess,
 	)
 }
@@ -9,7 +9,8 @@ CREATE TABLE orders (
                         shardkey VARCHAR(100) NOT NULL,
                         sm_id INT NOT NULL,
                         date_created TIMESTAMPTZ NOT NULL,
-                        oof_shard VARCHAR(50) NOT NULL
+                        oof_shard VARCHAR(50) NOT NULL,
+                        cancelled_at TIMESTAMPTZ -- отмененный заказ остается в бд, но больше не отдается
 );
 
 CREATE TABLE delivery(
@@ -52,4 +53,51 @@ CREATE TABLE items(
                       nm_id BIGINT NOT NULL,
                       brand VARCHAR(255), --does not matter?
                       status INT NOT NULL
-);
\ No newline at end of file
+);
+-- записи, которые не удалось положить в dlq (кафка недоступна), лежат тут до ручного release
+CREATE TABLE quarantine(
+                           id BIGSERIAL PRIMARY KEY,
+                           topic VARCHAR(255) NOT NULL,
+                           partition_id INT NOT NULL,
+                           record_offset BIGINT NOT NULL,
+                           record_key BYTEA,
+                           record_value BYTEA,
+                           headers JSONB NOT NULL DEFAULT '[]', -- [{"key": ..., "value": base64}]
+                           reason VARCHAR(50) NOT NULL,
+                           error TEXT NOT NULL DEFAULT '',
+                           created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                           released_at TIMESTAMPTZ,
+                           UNIQUE(topic, partition_id, record_offset)
+);
+
+-- оффсеты консьюмера, пишутся в той же транзакции, что и заказ (KAFKA_OFFSETS_IN_DB)
+CREATE TABLE consumer_offsets(
+                                 group_id VARCHAR(255) NOT NULL,
+                                 topic VARCHAR(255) NOT NULL,
+                                 partition_id INT NOT NULL,
+                                 next_offset BIGINT NOT NULL,
+                                 updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                                 PRIMARY KEY(group_id, topic, partition_id)
+);
+
+-- журнал изменений заказов: кто и когда отменил
+CREATE TABLE order_audit(
+                            id BIGSERIAL PRIMARY KEY,
+                            order_uid VARCHAR(255) NOT NULL REFERENCES orders(order_uid),
+                            action VARCHAR(50) NOT NULL,
+                            source VARCHAR(255) NOT NULL,
+                            created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX order_audit_order_uid_idx ON order_audit(order_uid);
+
+-- записи кафки, из которых собраны заказы, как пришли (пишутся в транзакции заказа): для аудита и cmd/rebuild
+CREATE TABLE raw_orders(
+                           order_uid VARCHAR(255) PRIMARY KEY REFERENCES orders(order_uid),
+                           topic VARCHAR(255) NOT NULL,
+                           partition_id INT NOT NULL,
+                           record_offset BIGINT NOT NULL,
+                           headers JSONB NOT NULL DEFAULT '[]', -- [{"key": ..., "value": base64}], значения заголовков бывают бинарными
+                           value BYTEA NOT NULL,
+                           payload JSONB, -- value, если это json; protobuf и avro лежат только в value
+                           received_at TIMESTAMPTZ NOT NULL
+);
@@ -6,6 +6,7 @@ var (
 	ErrNotFound   = errors.New("order not found")
 	ErrValidation = errors.New("validation error")
 	ErrServer     = errors.New("unexpected server error")
+	ErrDuplicate  = errors.New("order already exists")
 	// Validate order
 	ErrOrderUIDMissing           = errors.New("order_uid is missing")
 	ErrTrackNumberMissing        = errors.New("track number is missing")
@@ -0,0 +1,269 @@
+package chaos
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/GameXost/wbTestCase/internal/generator"
+	"github.com/GameXost/wbTestCase/internal/kafka"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/GameXost/wbTestCase/internal/service"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// HeaderKind - заголовок записи с видом хаоса, доезжает до dlq вместе с остальными
+const HeaderKind = "chaos.kind"
+
+// виды записей продюсера: обычные и хаос
+const (
+	KindValid   = "valid"
+	KindInvalid = "invalid" // порча из каталога генератора
+	KindRepeat  = "repeat"  // побайтный повтор уже отправленной записи
+
+	KindTruncated          = "truncated_json"
+	KindMalformed          = "malformed_json"
+	KindWrongTypes         = "wrong_types"
+	KindOversized          = "oversized"
+	KindNullValues         = "null_values"
+	KindShuffledKeys       = "shuffled_keys"
+	KindDivergentDuplicate = "divergent_duplicate" // uid уже отправленного заказа, но другое содержимое
+)
+
+// что консьюмер должен сделать с записью
+const (
+	ExpectPersisted  = "persisted"
+	ExpectDuplicate  = "duplicate" // заказ с этим uid уже сохранен, в бд остается первая версия
+	ExpectDeadLetter = "dead_letter"
+)
+
+// сколько позиций в раздутом заказе: сотни килобайт json, но меньше лимита записи кафки в 1MB
+const oversizedItems = 1000
+
+// Record - запись хаоса. Order - заказ, по которому считается ключ: у разбираемых записей - то, что разберет
+// консьюмер, у битых - заказ, из которого их испортили
+type Record struct {
+	Kind   string
+	Order  *models.Order
+	Value  []byte
+	Expect string
+	Reason string
+}
+
+var makers = []struct {
+	kind string
+	make func(g *generator.Generator) Record
+}{
+	{KindTruncated, truncated},
+	{KindMalformed, malformed},
+	{KindWrongTypes, wrongTypes},
+	{KindOversized, oversized},
+	{KindNullValues, nullValues},
+	{KindShuffledKeys, shuffledKeys},
+}
+
+// Kinds - виды хаоса, которые делает New. KindDivergentDuplicate нужна история отправленного, его делает Diverge
+func Kinds() []string {
+	kinds := make([]string, len(makers))
+	for i, m := range makers {
+		kinds[i] = m.kind
+	}
+	return kinds
+}
+
+// New - случайная запись хаоса из генератора: один seed - одни и те же записи
+func New(g *generator.Generator) Record {
+	return makers[g.IntN(len(makers))].make(g)
+}
+
+// Make - запись хаоса конкретного вида из Kinds
+func Make(g *generator.Generator, kind string) (Record, bool) {
+	for _, m := range makers {
+		if m.kind == kind {
+			return m.make(g), true
+		}
+	}
+	return Record{}, false
+}
+
+// Expect - что консьюмер сделает с разобравшимся заказом: без uid и невалидный - в dlq, остальное сохранит
+func Expect(order *models.Order) (string, string) {
+	if order.OrderUId == "" {
+		return ExpectDeadLetter, kafka.ReasonMissingUID
+	}
+	if err := service.ValidateOrder(order); err != nil {
+		return ExpectDeadLetter, kafka.ReasonValidation
+	}
+	return ExpectPersisted, ""
+}
+
+// Diverge - другой валидный заказ под uid original. Ключевые поля те же, чтобы при любой стратегии ключа
+// запись попала в партицию оригинала после него
+func Diverge(g *generator.Generator, original *models.Order) *models.Order {
+	order := g.ValidOrder(original.OrderUId)
+	order.CustomerId = original.CustomerId
+	order.Shardkey = original.Shardkey
+	return order
+}
+
+func mustJSON(v any) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func deadJSON(kind string, order *models.Order, value []byte) Record {
+	return Record{Kind: kind, Order: order, Value: value, Expect: ExpectDeadLetter, Reason: kafka.ReasonInvalidJSON}
+}
+
+// truncated - json, оборванный посередине (упавший на полпути продюсер)
+func truncated(g *generator.Generator) Record {
+	order := g.ValidOrder(g.OrderUID())
+	data := mustJSON(order)
+	return deadJSON(KindTruncated, order, data[:1+g.IntN(len(data)-1)])
+}
+
+// malformed - синтаксически битый json
+func malformed(g *generator.Generator) Record {
+	order := g.ValidOrder(g.OrderUID())
+	data := mustJSON(order)
+	switch g.IntN(4) {
+	case 0:
+		// висячая запятая
+		data = append(data[:len(data)-1], ",}"...)
+	case 1:
+		data = bytes.Replace(data, []byte(`{"`), []byte(`{`), 1)
+	case 2:
+		data = bytes.ReplaceAll(data, []byte(`"`), []byte(`'`))
+	default:
+		junk := make([]byte, 16+g.IntN(240))
+		for i := range junk {
+			junk[i] = byte(g.IntN(256))
+		}
+		data = junk
+	}
+	return deadJSON(KindMalformed, order, data)
+}
+
+// wrongTypes - корректный json, но поле не того типа
+func wrongTypes(g *generator.Generator) Record {
+	order := g.ValidOrder(g.OrderUID())
+	m := toMap(order)
+	payment := m["payment"].(map[string]any)
+	switch g.IntN(5) {
+	case 0:
+		payment["amount"] = strconv.FormatInt(order.Payment.Amount, 10)
+	case 1:
+		m["sm_id"] = "sm-" + strconv.FormatInt(order.SmId, 10)
+	case 2:
+		m["items"] = m["items"].([]any)[0]
+	case 3:
+		m["date_created"] = order.DateCreated.Unix()
+	default:
+		m["delivery"] = []any{m["delivery"]}
+	}
+	return deadJSON(KindWrongTypes, order, mustJSON(m))
+}
+
+// oversized - валидный заказ на oversizedItems позиций с сошедшимися суммами
+func oversized(g *generator.Generator) Record {
+	order := g.ValidOrder(g.OrderUID())
+	n := len(order.Items)
+	for i := n; i < oversizedItems; i++ {
+		item := order.Items[i%n]
+		item.ChrtId += int64(i)
+		order.Items = append(order.Items, item)
+	}
+	var goodsTotal int64
+	for _, item := range order.Items {
+		goodsTotal += item.TotalPrice
+	}
+	order.Payment.GoodsTotal = goodsTotal
+	order.Payment.Amount = goodsTotal + order.Payment.DeliveryCost + order.Payment.CustomFee
+	expect, reason := Expect(order)
+	return Record{Kind: KindOversized, Order: order, Value: mustJSON(order), Expect: expect, Reason: reason}
+}
+
+// поля, которые nullValues заменяет на null
+var nullable = [][]string{
+	{"payment"}, {"delivery"}, {"items"}, {"order_uid"}, {"track_number"},
+	{"payment", "currency"}, {"delivery", "email"},
+}
+
+// nullValues - json с null вместо обязательных полей: разбирается, но не проходит валидацию
+func nullValues(g *generator.Generator) Record {
+	m := toMap(g.ValidOrder(g.OrderUID()))
+	path := nullable[g.IntN(len(nullable))]
+	parent := m
+	for _, key := range path[:len(path)-1] {
+		parent = parent[key].(map[string]any)
+	}
+	parent[path[len(path)-1]] = nil
+
+	value := mustJSON(m)
+	var order models.Order
+	if err := json.Unmarshal(value, &order); err != nil {
+		panic(err)
+	}
+	expect, reason := Expect(&order)
+	return Record{Kind: KindNullValues, Order: &order, Value: value, Expect: expect, Reason: reason}
+}
+
+// shuffledKeys - валидный заказ, но поля объектов в случайном порядке
+func shuffledKeys(g *generator.Generator) Record {
+	order := g.ValidOrder(g.OrderUID())
+	var b strings.Builder
+	writeShuffled(&b, toMap(order), g)
+	expect, reason := Expect(order)
+	return Record{Kind: KindShuffledKeys, Order: order, Value: []byte(b.String()), Expect: expect, Reason: reason}
+}
+
+func writeShuffled(b *strings.Builder, v any, g *generator.Generator) {
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		// из map ключи приходят в случайном порядке, который seed не воспроизводит
+		slices.Sort(keys)
+		for i := len(keys) - 1; i > 0; i-- {
+			j := g.IntN(i + 1)
+			keys[i], keys[j] = keys[j], keys[i]
+		}
+		b.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.Write(mustJSON(k))
+			b.WriteByte(':')
+			writeShuffled(b, v[k], g)
+		}
+		b.WriteByte('}')
+	case []any:
+		b.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeShuffled(b, e, g)
+		}
+		b.WriteByte(']')
+	default:
+		b.Write(mustJSON(v))
+	}
+}
+
+// toMap - заказ как дерево json. Числа остаются json.Number, чтобы int64 не терялись во float64
+func toMap(order *models.Order) map[string]any {
+	dec := json.NewDecoder(bytes.NewReader(mustJSON(order)))
+	dec.UseNumber()
+	var m map[string]any
+	if err := dec.Decode(&m); err != nil {
+		panic(err)
+	}
+	return m
+}
@@ -0,0 +1,100 @@
+package chaos
+
+import (
+	"encoding/json"
+	"github.com/GameXost/wbTestCase/internal/generator"
+	"github.com/GameXost/wbTestCase/internal/generator/generatortest"
+	"github.com/GameXost/wbTestCase/internal/kafka"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+// ожидание записи совпадает с тем, что сделает консьюмер: не разобралась - invalid_json,
+// разобралась - решает валидация, а ключ считается по тому же заказу, что разберет консьюмер
+func TestExpectationsMatchConsumer(t *testing.T) {
+	g := generatortest.New(t)
+	for _, kind := range Kinds() {
+		for range 30 {
+			rec, ok := Make(g, kind)
+			require.True(t, ok)
+			assert.Equal(t, kind, rec.Kind)
+			require.NotNil(t, rec.Order, kind)
+
+			var order models.Order
+			if err := json.Unmarshal(rec.Value, &order); err != nil {
+				assert.Equal(t, ExpectDeadLetter, rec.Expect, "%s: %s", kind, rec.Value)
+				assert.Equal(t, kafka.ReasonInvalidJSON, rec.Reason, kind)
+				continue
+			}
+			expect, reason := Expect(&order)
+			assert.Equal(t, expect, rec.Expect, "%s: %s", kind, rec.Value)
+			assert.Equal(t, reason, rec.Reason, kind)
+			assert.Equal(t, rec.Order.OrderUId, order.OrderUId, kind)
+			assert.Equal(t, rec.Order.CustomerId, order.CustomerId, kind)
+		}
+	}
+}
+
+func TestKindsBreakWhatTheyShould(t *testing.T) {
+	g := generatortest.New(t)
+	for range 30 {
+		for _, kind := range []string{KindTruncated, KindMalformed, KindWrongTypes} {
+			rec, _ := Make(g, kind)
+			assert.Equal(t, ExpectDeadLetter, rec.Expect, kind)
+		}
+		rec, _ := Make(g, KindNullValues)
+		assert.Equal(t, ExpectDeadLetter, rec.Expect, "null in a required field never passes")
+
+		for _, kind := range []string{KindOversized, KindShuffledKeys} {
+			rec, _ := Make(g, kind)
+			assert.Equal(t, ExpectPersisted, rec.Expect, kind)
+		}
+	}
+	rec, _ := Make(g, KindOversized)
+	assert.Len(t, rec.Order.Items, oversizedItems)
+	assert.Greater(t, len(rec.Value), 100_000)
+	assert.Less(t, len(rec.Value), 1_000_000)
+
+	_, ok := Make(g, "no_such_kind")
+	assert.False(t, ok)
+}
+
+func TestSameSeedSameChaos(t *testing.T) {
+	first, second := generator.New(5), generator.New(5)
+	for range 50 {
+		assert.Equal(t, New(first), New(second))
+	}
+}
+
+func TestDiverge(t *testing.T) {
+	g := generatortest.New(t)
+	original := g.ValidOrder("uid")
+	diverged := Diverge(g, original)
+	assert.Equal(t, original.OrderUId, diverged.OrderUId)
+	assert.Equal(t, original.CustomerId, diverged.CustomerId)
+	assert.Equal(t, original.Shardkey, diverged.Shardkey)
+	assert.NotEqual(t, original.Payment.Transaction, diverged.Payment.Transaction)
+	expect, _ := Expect(diverged)
+	assert.Equal(t, ExpectPersisted, expect, "on its own the divergent order is valid")
+}
+
+func TestManifestRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.ndjson")
+	m, err := CreateManifest(path)
+	require.NoError(t, err)
+	entries := []Entry{
+		{Kind: KindValid, Key: "a", OrderUID: "a", Topic: "orders", Partition: 1, Offset: 7, Expect: ExpectPersisted, Transaction: "tx"},
+		{Kind: KindTruncated, Key: "b", Topic: "orders", Offset: 8, Expect: ExpectDeadLetter, Reason: kafka.ReasonInvalidJSON},
+	}
+	for _, e := range entries {
+		m.Add(e)
+	}
+	require.NoError(t, m.Close())
+
+	got, err := ReadManifest(path)
+	require.NoError(t, err)
+	assert.Equal(t, entries, got)
+}
@@ -0,0 +1,87 @@
+package chaos
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// Entry - строка манифеста: что продюсер отправил, куда это легло и что консьюмер должен с этим сделать
+type Entry struct {
+	Kind     string `json:"kind"`
+	Mutation string `json:"mutation,omitempty"`
+	Key      string `json:"key"`
+	OrderUID string `json:"order_uid,omitempty"`
+
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+
+	Expect string `json:"expect"`
+	// причина в dlq для ExpectDeadLetter
+	Reason string `json:"reason,omitempty"`
+	// транзакция заказа, который должен оказаться в бд (у дублей - первой версии)
+	Transaction string `json:"transaction,omitempty"`
+	// запись не доехала до брокера, консьюмеру проверять нечего
+	Error string `json:"error,omitempty"`
+}
+
+// Manifest пишет Entry в NDJSON, безопасен для конкурентной записи из колбэков продюсера
+type Manifest struct {
+	mu  sync.Mutex
+	f   *os.File
+	buf *bufio.Writer
+	enc *json.Encoder
+	err error
+}
+
+func CreateManifest(path string) (*Manifest, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriter(f)
+	return &Manifest{f: f, buf: buf, enc: json.NewEncoder(buf)}, nil
+}
+
+// Add записывает строку. Первая ошибка записи запоминается и возвращается из Close
+func (m *Manifest) Add(e Entry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err == nil {
+		m.err = m.enc.Encode(e)
+	}
+}
+
+func (m *Manifest) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err == nil {
+		m.err = m.buf.Flush()
+	}
+	if err := m.f.Close(); m.err == nil {
+		m.err = err
+	}
+	return m.err
+}
+
+func ReadManifest(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	var entries []Entry
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var e Entry
+		if err = dec.Decode(&e); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
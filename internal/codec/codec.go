@@ -0,0 +1,241 @@
+// Package codec - форматы значения записи с заказом: json, protobuf и avro в confluent wire format
+package codec
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/codec/orderpb"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/hamba/avro/v2"
+	"github.com/twmb/franz-go/pkg/sr"
+	"google.golang.org/protobuf/proto"
+	"strings"
+	"sync"
+)
+
+// HeaderContentType - заголовок записи, по которому выбирается декодер
+const HeaderContentType = "content-type"
+
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeAvro     = "application/avro"
+)
+
+const (
+	FormatJSON     = "json"
+	FormatProtobuf = "protobuf"
+	FormatAvro     = "avro"
+)
+
+var (
+	// ErrRegistryUnavailable - registry не ответил или ответил 5xx, запись тут ни при чем и ее стоит повторить
+	ErrRegistryUnavailable = errors.New("schema registry is unavailable")
+	ErrNoRegistry          = errors.New("schema registry is not configured")
+)
+
+// AvroSchema - схема заказа, под которой продюсер регистрирует avro
+//
+//go:embed order.avsc
+var AvroSchema string
+
+// поля avro сопоставляются с моделью по json тегам, отдельные avro структуры не нужны
+var avroAPI = avro.Config{TagKey: "json"}.Freeze()
+
+var header sr.ConfluentHeader
+
+// Format - формат по content-type записи. Без заголовка или с незнакомым значением - json, как было до registry
+func Format(contentType string) string {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	switch strings.ToLower(strings.TrimSpace(mediaType)) {
+	case ContentTypeProtobuf:
+		return FormatProtobuf
+	case ContentTypeAvro:
+		return FormatAvro
+	default:
+		return FormatJSON
+	}
+}
+
+// Decoder разбирает записи, схемы по id берет из registry и кэширует навсегда: схема под id не меняется
+type Decoder struct {
+	registry *sr.Client
+
+	mu       sync.Mutex
+	schemas  map[int]sr.Schema
+	avroByID map[int]avro.Schema
+}
+
+// registry может быть nil, тогда принимается только json
+func NewDecoder(registry *sr.Client) *Decoder {
+	return &Decoder{
+		registry: registry,
+		schemas:  make(map[int]sr.Schema),
+		avroByID: make(map[int]avro.Schema),
+	}
+}
+
+func (d *Decoder) Decode(ctx context.Context, contentType string, value []byte) (*models.Order, error) {
+	switch Format(contentType) {
+	case FormatProtobuf:
+		return d.decodeProtobuf(ctx, value)
+	case FormatAvro:
+		return d.decodeAvro(ctx, value)
+	}
+	var order models.Order
+	if err := json.Unmarshal(value, &order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (d *Decoder) decodeProtobuf(ctx context.Context, value []byte) (*models.Order, error) {
+	id, payload, err := header.DecodeID(value)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = d.schema(ctx, id, sr.TypeProtobuf); err != nil {
+		return nil, err
+	}
+	index, payload, err := header.DecodeIndex(payload, 1)
+	if err != nil {
+		return nil, fmt.Errorf("bad message index: %w", err)
+	}
+	// Order - первое сообщение в order.proto
+	if index[0] != 0 {
+		return nil, fmt.Errorf("message index %v is not an order", index)
+	}
+	var msg orderpb.Order
+	if err = proto.Unmarshal(payload, &msg); err != nil {
+		return nil, err
+	}
+	return fromProto(&msg), nil
+}
+
+// decodeAvro читает запись схемой, которой ее писали: новые поля пропускаются, пропавшие остаются пустыми
+func (d *Decoder) decodeAvro(ctx context.Context, value []byte) (*models.Order, error) {
+	id, payload, err := header.DecodeID(value)
+	if err != nil {
+		return nil, err
+	}
+	d.mu.Lock()
+	schema, has := d.avroByID[id]
+	d.mu.Unlock()
+	if !has {
+		raw, err := d.schema(ctx, id, sr.TypeAvro)
+		if err != nil {
+			return nil, err
+		}
+		// свой кэш имен на каждую схему, иначе разные версии Order конфликтуют
+		schema, err = avro.ParseWithCache(raw.Schema, "", &avro.SchemaCache{})
+		if err != nil {
+			return nil, fmt.Errorf("parse avro schema %d: %w", id, err)
+		}
+		d.mu.Lock()
+		d.avroByID[id] = schema
+		d.mu.Unlock()
+	}
+	var order models.Order
+	if err = avroAPI.Unmarshal(schema, payload, &order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (d *Decoder) schema(ctx context.Context, id int, want sr.SchemaType) (sr.Schema, error) {
+	if d.registry == nil {
+		return sr.Schema{}, ErrNoRegistry
+	}
+	d.mu.Lock()
+	schema, has := d.schemas[id]
+	d.mu.Unlock()
+	if !has {
+		var err error
+		schema, err = d.registry.SchemaByID(ctx, id)
+		if err != nil {
+			return sr.Schema{}, registryError(err)
+		}
+		d.mu.Lock()
+		d.schemas[id] = schema
+		d.mu.Unlock()
+	}
+	if schema.Type != want {
+		return sr.Schema{}, fmt.Errorf("schema %d is %s, want %s", id, schema.Type, want)
+	}
+	return schema, nil
+}
+
+// registryError: 4xx (нет такой схемы) - проблема записи, все остальное - проблема registry
+func registryError(err error) error {
+	var respErr *sr.ResponseError
+	if errors.As(err, &respErr) && respErr.StatusCode < 500 {
+		return fmt.Errorf("schema registry: %w", err)
+	}
+	return fmt.Errorf("%w: %w", ErrRegistryUnavailable, err)
+}
+
+// Encoder кодирует заказы одним форматом, схема регистрируется один раз при создании
+type Encoder struct {
+	format string
+	id     int
+	avro   avro.Schema
+}
+
+// NewEncoder: для json registry не нужен и может быть nil
+func NewEncoder(ctx context.Context, registry *sr.Client, format, subject string) (*Encoder, error) {
+	e := &Encoder{format: format}
+	var schema sr.Schema
+	switch format {
+	case FormatJSON:
+		return e, nil
+	case FormatProtobuf:
+		schema = sr.Schema{Schema: orderpb.Schema, Type: sr.TypeProtobuf}
+	case FormatAvro:
+		parsed, err := avro.ParseWithCache(AvroSchema, "", &avro.SchemaCache{})
+		if err != nil {
+			return nil, err
+		}
+		e.avro = parsed
+		schema = sr.Schema{Schema: AvroSchema, Type: sr.TypeAvro}
+	default:
+		return nil, fmt.Errorf("unknown format %q, want %s, %s or %s", format, FormatJSON, FormatProtobuf, FormatAvro)
+	}
+	if registry == nil {
+		return nil, ErrNoRegistry
+	}
+	id, err := registry.RegisterSchema(ctx, subject, schema, -1, -1)
+	if err != nil {
+		return nil, fmt.Errorf("register %s schema under %s: %w", format, subject, err)
+	}
+	e.id = id
+	return e, nil
+}
+
+func (e *Encoder) ContentType() string {
+	switch e.format {
+	case FormatProtobuf:
+		return ContentTypeProtobuf
+	case FormatAvro:
+		return ContentTypeAvro
+	default:
+		return ContentTypeJSON
+	}
+}
+
+func (e *Encoder) Encode(order *models.Order) ([]byte, error) {
+	switch e.format {
+	case FormatProtobuf:
+		return sr.Encode(toProto(order), &header, e.id, []int{0}, func(v any) ([]byte, error) {
+			return proto.Marshal(v.(*orderpb.Order))
+		})
+	case FormatAvro:
+		return sr.Encode(order, &header, e.id, nil, func(v any) ([]byte, error) {
+			return avroAPI.Marshal(e.avro, v)
+		})
+	default:
+		return json.Marshal(order)
+	}
+}
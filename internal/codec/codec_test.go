@@ -0,0 +1,130 @@
+package codec
+
+import (
+	"context"
+	"github.com/GameXost/wbTestCase/internal/generator/generatortest"
+	"github.com/hamba/avro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/sr"
+	"github.com/twmb/franz-go/pkg/sr/srfake"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newRegistry(t *testing.T) (*srfake.Registry, *sr.Client) {
+	registry := srfake.New()
+	t.Cleanup(registry.Close)
+	client, err := sr.NewClient(sr.URLs(registry.URL()))
+	require.NoError(t, err)
+	return registry, client
+}
+
+func TestRoundTrip(t *testing.T) {
+	_, client := newRegistry(t)
+	decoder := NewDecoder(client)
+	order := generatortest.New(t).ValidOrder("round_trip")
+	order.DateCreated = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	// служебные поля в protobuf и avro не передаются
+	order.Payment.OrderId = ""
+	order.Delivery.OrderUId = ""
+	for i := range order.Items {
+		order.Items[i].OrderUId = ""
+	}
+
+	for _, format := range []string{FormatJSON, FormatProtobuf, FormatAvro} {
+		t.Run(format, func(t *testing.T) {
+			encoder, err := NewEncoder(context.Background(), client, format, "orders-value")
+			require.NoError(t, err)
+			value, err := encoder.Encode(order)
+			require.NoError(t, err)
+
+			got, err := decoder.Decode(context.Background(), encoder.ContentType(), value)
+			require.NoError(t, err)
+			assert.Equal(t, order, got)
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, FormatJSON, Format(""))
+	assert.Equal(t, FormatJSON, Format("text/plain"))
+	assert.Equal(t, FormatProtobuf, Format("application/x-protobuf"))
+	assert.Equal(t, FormatAvro, Format("Application/Avro; charset=binary"))
+}
+
+// запись, написанная старой схемой без части полей и с лишним полем, читается по схеме из registry
+func TestDecodeAvroWriterSchema(t *testing.T) {
+	registry, client := newRegistry(t)
+	writer := `{"type":"record","name":"Order","fields":[
+		{"name":"order_uid","type":"string"},
+		{"name":"legacy_note","type":"string"},
+		{"name":"sm_id","type":"long"}]}`
+	id, _, err := registry.RegisterSchema("orders-value", sr.Schema{Schema: writer, Type: sr.TypeAvro})
+	require.NoError(t, err)
+
+	payload, err := avro.Marshal(avro.MustParse(writer), map[string]any{"order_uid": "old", "legacy_note": "x", "sm_id": int64(7)})
+	require.NoError(t, err)
+	value, err := header.AppendEncode(nil, id, nil)
+	require.NoError(t, err)
+
+	got, err := NewDecoder(client).Decode(context.Background(), ContentTypeAvro, append(value, payload...))
+	require.NoError(t, err)
+	assert.Equal(t, "old", got.OrderUId)
+	assert.Equal(t, int64(7), got.SmId)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	registry, client := newRegistry(t)
+	avroID, _, err := registry.RegisterSchema("orders-value", sr.Schema{Schema: AvroSchema, Type: sr.TypeAvro})
+	require.NoError(t, err)
+	decoder := NewDecoder(client)
+	ctx := context.Background()
+
+	_, err = decoder.Decode(ctx, ContentTypeProtobuf, []byte("{}"))
+	assert.ErrorIs(t, err, sr.ErrBadHeader, "no magic byte")
+
+	unknown, _ := header.AppendEncode(nil, 404, []int{0})
+	_, err = decoder.Decode(ctx, ContentTypeProtobuf, unknown)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrRegistryUnavailable, "missing schema is a problem of the record")
+
+	wrongType, _ := header.AppendEncode(nil, avroID, []int{0})
+	_, err = decoder.Decode(ctx, ContentTypeProtobuf, wrongType)
+	assert.ErrorContains(t, err, "want PROTOBUF")
+
+	_, err = NewDecoder(nil).Decode(ctx, ContentTypeAvro, wrongType)
+	assert.ErrorIs(t, err, ErrNoRegistry)
+}
+
+func TestDecodeRegistryUnavailable(t *testing.T) {
+	registry, client := newRegistry(t)
+	id, _, err := registry.RegisterSchema("orders-value", sr.Schema{Schema: AvroSchema, Type: sr.TypeAvro})
+	require.NoError(t, err)
+	registry.Intercept(func(w http.ResponseWriter, r *http.Request) bool {
+		if strings.HasPrefix(r.URL.Path, "/schemas/ids/") {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return true
+		}
+		return false
+	})
+	encoded, err := header.AppendEncode(nil, id, nil)
+	require.NoError(t, err)
+
+	decoder := NewDecoder(client)
+	_, err = decoder.Decode(context.Background(), ContentTypeAvro, encoded)
+	assert.ErrorIs(t, err, ErrRegistryUnavailable)
+
+	// registry поднялся - та же запись декодируется, неудачный ответ не закэшировался
+	registry.ClearInterceptors()
+	order := generatortest.New(t).ValidOrder("after_outage")
+	encoder, err := NewEncoder(context.Background(), client, FormatAvro, "orders-value")
+	require.NoError(t, err)
+	value, err := encoder.Encode(order)
+	require.NoError(t, err)
+	got, err := decoder.Decode(context.Background(), ContentTypeAvro, value)
+	require.NoError(t, err)
+	assert.Equal(t, order.OrderUId, got.OrderUId)
+}
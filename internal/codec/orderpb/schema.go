@@ -0,0 +1,11 @@
+// Package orderpb - protobuf схема заказа, order.pb.go генерируется из order.proto
+package orderpb
+
+import _ "embed"
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative order.proto
+
+// Schema - текст order.proto, под ним продюсер регистрирует схему в schema registry
+//
+//go:embed order.proto
+var Schema string
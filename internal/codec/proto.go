@@ -0,0 +1,117 @@
+package codec
+
+import (
+	"github.com/GameXost/wbTestCase/internal/codec/orderpb"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"time"
+)
+
+func toProto(order *models.Order) *orderpb.Order {
+	items := make([]*orderpb.Item, 0, len(order.Items))
+	for _, item := range order.Items {
+		items = append(items, &orderpb.Item{
+			ChrtId:      item.ChrtId,
+			TrackNumber: item.TrackNumber,
+			Price:       item.Price,
+			Rid:         item.RID,
+			Name:        item.Name,
+			Sale:        item.Sale,
+			Size:        item.Size,
+			TotalPrice:  item.TotalPrice,
+			NmId:        item.NmId,
+			Brand:       item.Brand,
+			Status:      item.Status,
+		})
+	}
+	return &orderpb.Order{
+		OrderUid:    order.OrderUId,
+		TrackNumber: order.TrackNumber,
+		Entry:       order.Entry,
+		Delivery: &orderpb.Delivery{
+			Name:    order.Delivery.Name,
+			Phone:   order.Delivery.Phone,
+			Zip:     order.Delivery.Zip,
+			City:    order.Delivery.City,
+			Address: order.Delivery.Address,
+			Region:  order.Delivery.Region,
+			Email:   order.Delivery.Email,
+		},
+		Payment: &orderpb.Payment{
+			Transaction:  order.Payment.Transaction,
+			RequestId:    order.Payment.RequestId,
+			Currency:     order.Payment.Currency,
+			Provider:     order.Payment.Provider,
+			Amount:       order.Payment.Amount,
+			PaymentDt:    order.Payment.PaymentDt,
+			Bank:         order.Payment.Bank,
+			DeliveryCost: order.Payment.DeliveryCost,
+			GoodsTotal:   order.Payment.GoodsTotal,
+			CustomFee:    order.Payment.CustomFee,
+		},
+		Items:             items,
+		Locale:            order.Locale,
+		InternalSignature: order.InternalSignature,
+		CustomerId:        order.CustomerId,
+		DeliveryService:   order.DeliveryService,
+		Shardkey:          order.Shardkey,
+		SmId:              order.SmId,
+		DateCreated:       order.DateCreated.UnixMilli(),
+		OofShard:          order.OofShard,
+	}
+}
+
+// fromProto: геттеры protobuf отдают пустые значения вместо nil, дальше пустые поля ловит валидация
+func fromProto(msg *orderpb.Order) *models.Order {
+	items := make([]models.Item, 0, len(msg.GetItems()))
+	for _, item := range msg.GetItems() {
+		items = append(items, models.Item{
+			ChrtId:      item.GetChrtId(),
+			TrackNumber: item.GetTrackNumber(),
+			Price:       item.GetPrice(),
+			RID:         item.GetRid(),
+			Name:        item.GetName(),
+			Sale:        item.GetSale(),
+			Size:        item.GetSize(),
+			TotalPrice:  item.GetTotalPrice(),
+			NmId:        item.GetNmId(),
+			Brand:       item.GetBrand(),
+			Status:      item.GetStatus(),
+		})
+	}
+	delivery, payment := msg.GetDelivery(), msg.GetPayment()
+	return &models.Order{
+		OrderUId:    msg.GetOrderUid(),
+		TrackNumber: msg.GetTrackNumber(),
+		Entry:       msg.GetEntry(),
+		Delivery: models.Delivery{
+			Name:    delivery.GetName(),
+			Phone:   delivery.GetPhone(),
+			Zip:     delivery.GetZip(),
+			City:    delivery.GetCity(),
+			Address: delivery.GetAddress(),
+			Region:  delivery.GetRegion(),
+			Email:   delivery.GetEmail(),
+		},
+		Payment: models.Payment{
+			Transaction:  payment.GetTransaction(),
+			RequestId:    payment.GetRequestId(),
+			Currency:     payment.GetCurrency(),
+			Provider:     payment.GetProvider(),
+			Amount:       payment.GetAmount(),
+			PaymentDt:    payment.GetPaymentDt(),
+			Bank:         payment.GetBank(),
+			DeliveryCost: payment.GetDeliveryCost(),
+			GoodsTotal:   payment.GetGoodsTotal(),
+			CustomFee:    payment.GetCustomFee(),
+		},
+		Items:             items,
+		Locale:            msg.GetLocale(),
+		InternalSignature: msg.GetInternalSignature(),
+		CustomerId:        msg.GetCustomerId(),
+		DeliveryService:   msg.GetDeliveryService(),
+		Shardkey:          msg.GetShardkey(),
+		SmId:              msg.GetSmId(),
+		DateCreated:       time.UnixMilli(msg.GetDateCreated()).UTC(),
+		OofShard:          msg.GetOofShard(),
+	}
+}
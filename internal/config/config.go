@@ -2,8 +2,11 @@ package config
 
 import (
 	"fmt"
+	"github.com/GameXost/wbTestCase/internal/repository/cache"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -32,14 +35,89 @@ type KafkaConfig struct {
 	Topic    string
 	Group    string
 	DLQTopic string
+
+	// пустой - принимаются только json заказы, protobuf и avro требуют registry
+	SchemaRegistryURL string
+
+	// откуда читать партицию без закоммиченного оффсета: earliest, latest или timestamp - первая запись не раньше ResetTimestamp
+	ResetOffset    string
+	ResetTimestamp time.Time
+
+	// сколько записей обрабатывается одновременно (каждая партиция все равно идет по порядку)
+	Parallelism int
+
+	RetryMaxAttempts int
+	RetryBaseDelay   time.Duration
+	RetryMaxDelay    time.Duration
+
+	// сколько временных ошибок бд подряд ставят чтение на паузу и как долго ждать до пробы
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// сколько раз пробовать отправить запись в dlq, сколько ждать одну отправку
+	// и что делать, если dlq так и не принял: quarantine - сохранить в бд, stop - остановить партицию
+	DLQRetryAttempts  int
+	DLQProduceTimeout time.Duration
+	DLQFallback       string
+
+	// хранить оффсеты в бд в транзакции с заказом, а при назначении партиций брать их оттуда
+	OffsetsInDB bool
+
+	// как часто опрашивать лаг группы через admin api
+	LagInterval time.Duration
+
+	// чем продюсер ключует заказы (order_uid, customer_id, shardkey) и что делать с записью, ключ которой
+	// не совпал с заказом: dlq - в dlq, rekey - переотправить с правильным ключом, ignore - обработать как есть
+	KeyStrategy string
+	KeyPolicy   string
+
+	// запись без значения (tombstone) отменяет заказ с uid из ключа; выключено - такая запись уходит в dlq
+	Tombstones bool
 }
 
+const (
+	ResetOffsetEarliest  = "earliest"
+	ResetOffsetLatest    = "latest"
+	ResetOffsetTimestamp = "timestamp"
+)
+
+const (
+	KeyStrategyOrderUID   = "order_uid"
+	KeyStrategyCustomerID = "customer_id"
+	KeyStrategyShardKey   = "shardkey"
+)
+
+const (
+	KeyPolicyDLQ    = "dlq"
+	KeyPolicyRekey  = "rekey"
+	KeyPolicyIgnore = "ignore"
+)
+
+const (
+	DLQFallbackQuarantine = "quarantine"
+	DLQFallbackStop       = "stop"
+)
+
 type ServerConfig struct {
 	Port string
+	// токен для /admin/*, пустой - админские ручки не поднимаются
+	AdminToken string
 }
 
 type CacheConfig struct {
-	Size uint64
+	Size   uint64
+	Policy string
+
+	NegativeSize int
+	NegativeTTL  time.Duration
+
+	WarmupChunkSize   int
+	WarmupConcurrency int
+	WarmupAsync       bool
+
+	SnapshotPath     string
+	SnapshotInterval time.Duration
+	SnapshotMaxAge   time.Duration
 }
 
 // посморел, что хорошая практика писать отдельный пакет для загрузки конфига :3
@@ -61,12 +139,48 @@ func LoadConfig() (*Config, error) {
 			Topic:    getEnv("KAFKA_TOPIC", "orders"),
 			Group:    getEnv("KAFKA_GROUP", "order_consumers"),
 			DLQTopic: getEnv("KAFKA_TOPIC_DLQ", "orders.dlq"),
+
+			SchemaRegistryURL: getEnv("KAFKA_SCHEMA_REGISTRY_URL", ""),
+
+			ResetOffset:    getEnv("KAFKA_RESET_OFFSET", ResetOffsetEarliest),
+			ResetTimestamp: getTimeEnv("KAFKA_RESET_TIMESTAMP", time.Time{}),
+
+			Parallelism: getIntEnv("KAFKA_PARALLELISM", 10),
+
+			RetryMaxAttempts: getIntEnv("KAFKA_RETRY_MAX_ATTEMPTS", 5),
+			RetryBaseDelay:   getDurationEnv("KAFKA_RETRY_BASE_DELAY", 500*time.Millisecond),
+			RetryMaxDelay:    getDurationEnv("KAFKA_RETRY_MAX_DELAY", 30*time.Second),
+
+			BreakerThreshold: getIntEnv("KAFKA_BREAKER_THRESHOLD", 5),
+			BreakerCooldown:  getDurationEnv("KAFKA_BREAKER_COOLDOWN", 5*time.Second),
+
+			DLQRetryAttempts:  getIntEnv("KAFKA_DLQ_RETRY_ATTEMPTS", 5),
+			DLQProduceTimeout: getDurationEnv("KAFKA_DLQ_PRODUCE_TIMEOUT", 10*time.Second),
+			DLQFallback:       getEnv("KAFKA_DLQ_FALLBACK", DLQFallbackQuarantine),
+
+			OffsetsInDB: getBoolEnv("KAFKA_OFFSETS_IN_DB", false),
+			LagInterval: getDurationEnv("KAFKA_LAG_INTERVAL", 15*time.Second),
+			KeyStrategy: getEnv("KAFKA_KEY_STRATEGY", KeyStrategyOrderUID),
+			KeyPolicy:   getEnv("KAFKA_KEY_POLICY", KeyPolicyDLQ),
+			Tombstones:  getBoolEnv("KAFKA_TOMBSTONES", false),
 		},
 		Server: ServerConfig{
-			Port: getEnv("HTTP_PORT", "8080"),
+			Port:       getEnv("HTTP_PORT", "8080"),
+			AdminToken: getEnv("ADMIN_TOKEN", ""),
 		},
 		Cache: CacheConfig{
-			Size: uint64(getIntEnv("CACHE_SIZE", 10)),
+			Size:         uint64(getIntEnv("CACHE_SIZE", 10)),
+			Policy:       getEnv("CACHE_POLICY", cache.PolicyLRU),
+			NegativeSize: getIntEnv("CACHE_NEGATIVE_SIZE", 1000),
+			NegativeTTL:  getDurationEnv("CACHE_NEGATIVE_TTL", 30*time.Second),
+
+			WarmupChunkSize:   getIntEnv("CACHE_WARMUP_CHUNK_SIZE", 500),
+			WarmupConcurrency: getIntEnv("CACHE_WARMUP_CONCURRENCY", 4),
+			WarmupAsync:       getBoolEnv("CACHE_WARMUP_ASYNC", false),
+
+			SnapshotPath:     getEnv("CACHE_SNAPSHOT_PATH", ""),
+			SnapshotInterval: getDurationEnv("CACHE_SNAPSHOT_INTERVAL", 5*time.Minute),
+			SnapshotMaxAge:   getDurationEnv("CACHE_SNAPSHOT_MAX_AGE", time.Hour),
 		},
 	}
 	if err := cfg.Validate(); err != nil {
@@ -85,6 +199,65 @@ func (c *Config) Validate() error {
 	if c.Cache.Size <= 0 {
 		return fmt.Errorf("CACHE_SIZE is lower or is 0")
 	}
+	if !slices.Contains(cache.Policies, c.Cache.Policy) {
+		return fmt.Errorf("CACHE_POLICY must be one of %s", strings.Join(cache.Policies, ", "))
+	}
+	if c.Cache.NegativeSize > 0 && c.Cache.NegativeTTL <= 0 {
+		return fmt.Errorf("CACHE_NEGATIVE_TTL must be positive")
+	}
+	switch c.Kafka.ResetOffset {
+	case ResetOffsetEarliest, ResetOffsetLatest:
+	case ResetOffsetTimestamp:
+		if c.Kafka.ResetTimestamp.IsZero() {
+			return fmt.Errorf("KAFKA_RESET_TIMESTAMP must be an RFC3339 time when KAFKA_RESET_OFFSET is timestamp")
+		}
+	default:
+		return fmt.Errorf("KAFKA_RESET_OFFSET must be %s, %s or %s", ResetOffsetEarliest, ResetOffsetLatest, ResetOffsetTimestamp)
+	}
+	if c.Kafka.Parallelism <= 0 {
+		return fmt.Errorf("KAFKA_PARALLELISM must be positive")
+	}
+	if c.Kafka.RetryMaxAttempts <= 0 {
+		return fmt.Errorf("KAFKA_RETRY_MAX_ATTEMPTS must be positive")
+	}
+	if c.Kafka.RetryBaseDelay < 0 || c.Kafka.RetryMaxDelay < c.Kafka.RetryBaseDelay {
+		return fmt.Errorf("KAFKA_RETRY_BASE_DELAY must be non negative and not greater than KAFKA_RETRY_MAX_DELAY")
+	}
+	if c.Kafka.BreakerThreshold <= 0 || c.Kafka.BreakerCooldown <= 0 {
+		return fmt.Errorf("KAFKA_BREAKER_THRESHOLD and KAFKA_BREAKER_COOLDOWN must be positive")
+	}
+	if c.Kafka.DLQRetryAttempts <= 0 {
+		return fmt.Errorf("KAFKA_DLQ_RETRY_ATTEMPTS must be positive")
+	}
+	if c.Kafka.DLQProduceTimeout < time.Second {
+		return fmt.Errorf("KAFKA_DLQ_PRODUCE_TIMEOUT must be at least 1s")
+	}
+	if c.Kafka.DLQFallback != DLQFallbackQuarantine && c.Kafka.DLQFallback != DLQFallbackStop {
+		return fmt.Errorf("KAFKA_DLQ_FALLBACK must be %s or %s", DLQFallbackQuarantine, DLQFallbackStop)
+	}
+	switch c.Kafka.KeyStrategy {
+	case KeyStrategyOrderUID, KeyStrategyCustomerID, KeyStrategyShardKey:
+	default:
+		return fmt.Errorf("KAFKA_KEY_STRATEGY must be %s, %s or %s", KeyStrategyOrderUID, KeyStrategyCustomerID, KeyStrategyShardKey)
+	}
+	switch c.Kafka.KeyPolicy {
+	case KeyPolicyDLQ, KeyPolicyRekey, KeyPolicyIgnore:
+	default:
+		return fmt.Errorf("KAFKA_KEY_POLICY must be %s, %s or %s", KeyPolicyDLQ, KeyPolicyRekey, KeyPolicyIgnore)
+	}
+	// uid отменяемого заказа берется из ключа tombstone, при другом ключевании это не uid
+	if c.Kafka.Tombstones && c.Kafka.KeyStrategy != KeyStrategyOrderUID {
+		return fmt.Errorf("KAFKA_TOMBSTONES requires KAFKA_KEY_STRATEGY=%s", KeyStrategyOrderUID)
+	}
+	if c.Kafka.LagInterval <= 0 {
+		return fmt.Errorf("KAFKA_LAG_INTERVAL must be positive")
+	}
+	if c.Cache.WarmupChunkSize <= 0 || c.Cache.WarmupConcurrency <= 0 {
+		return fmt.Errorf("CACHE_WARMUP_CHUNK_SIZE and CACHE_WARMUP_CONCURRENCY must be positive")
+	}
+	if c.Cache.SnapshotPath != "" && c.Cache.SnapshotInterval <= 0 {
+		return fmt.Errorf("CACHE_SNAPSHOT_INTERVAL must be positive")
+	}
 	return nil
 }
 
@@ -107,6 +280,18 @@ func getIntEnv(key string, defaultVal int) int {
 	return val
 }
 
+func getBoolEnv(key string, defaultVal bool) bool {
+	valStr := os.Getenv(key)
+	if valStr == "" {
+		return defaultVal
+	}
+	val, err := strconv.ParseBool(valStr)
+	if err != nil {
+		return defaultVal
+	}
+	return val
+}
+
 func getDurationEnv(key string, defaultVal time.Duration) time.Duration {
 	valStr := os.Getenv(key)
 	if valStr == "" {
@@ -119,6 +304,18 @@ func getDurationEnv(key string, defaultVal time.Duration) time.Duration {
 	return val
 }
 
+func getTimeEnv(key string, defaultVal time.Time) time.Time {
+	valStr := os.Getenv(key)
+	if valStr == "" {
+		return defaultVal
+	}
+	val, err := time.Parse(time.RFC3339, valStr)
+	if err != nil {
+		return defaultVal
+	}
+	return val
+}
+
 func (d *DBConfig) DSN() string {
 	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", d.User, d.Password, d.Host, d.Port, d.Name)
 }
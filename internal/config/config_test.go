@@ -0,0 +1,56 @@
+package config
+
+import (
+	"github.com/GameXost/wbTestCase/internal/repository/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, err := LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, KeyStrategyOrderUID, cfg.Kafka.KeyStrategy)
+	assert.False(t, cfg.Kafka.Tombstones)
+	assert.Equal(t, cache.PolicyLRU, cfg.Cache.Policy)
+}
+
+func TestTombstonesNeedOrderUIDKeys(t *testing.T) {
+	tests := []struct {
+		strategy string
+		wantErr  bool
+	}{
+		{KeyStrategyOrderUID, false},
+		{KeyStrategyCustomerID, true},
+		{KeyStrategyShardKey, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			t.Setenv("KAFKA_TOMBSTONES", "true")
+			t.Setenv("KAFKA_KEY_STRATEGY", tt.strategy)
+			cfg, err := LoadConfig()
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "KAFKA_TOMBSTONES")
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, cfg.Kafka.Tombstones)
+		})
+	}
+
+	t.Setenv("KAFKA_TOMBSTONES", "false")
+	t.Setenv("KAFKA_KEY_STRATEGY", KeyStrategyCustomerID)
+	_, err := LoadConfig()
+	assert.NoError(t, err, "without tombstones any key strategy is fine")
+}
+
+func TestCachePolicyIsChecked(t *testing.T) {
+	t.Setenv("CACHE_POLICY", "lur")
+	_, err := LoadConfig()
+	assert.ErrorContains(t, err, "CACHE_POLICY")
+
+	t.Setenv("CACHE_POLICY", cache.PolicyTinyLFU)
+	cfg, err := LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, cache.PolicyTinyLFU, cfg.Cache.Policy)
+}
@@ -1,105 +1,156 @@
 package generator
 
 import (
+	"fmt"
 	"github.com/GameXost/wbTestCase/internal/models"
 	"github.com/brianvoe/gofakeit/v7"
+	"math/rand/v2"
+	"strconv"
+	"strings"
 	"time"
 )
 
-func ValidOrder(orderUID string) *models.Order {
+// Options - какие заказы генерировать
+type Options struct {
+	// сколько максимум позиций в заказе (от 1)
+	MaxItems int
+	// окно, в которое попадают даты создания заказов
+	From, To time.Time
+}
+
+// DefaultOptions - до 5 позиций, даты за 2025 год: окно фиксированное, чтобы seed давал те же заказы в любой день
+func DefaultOptions() Options {
+	return Options{
+		MaxItems: 5,
+		From:     time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// Generator - генератор заказов. Один seed, одни Options и одинаковая последовательность вызовов
+// дают побайтно одинаковые заказы.
+// Пользоваться из одной горутины: при параллельных вызовах порядок, а значит и заказы, не воспроизводятся
+type Generator struct {
+	seed  uint64
+	opts  Options
+	faker *gofakeit.Faker
+}
+
+// New - генератор с DefaultOptions и seed, 0 - выбрать случайный (узнать его можно через Seed)
+func New(seed uint64) *Generator {
+	return NewWithOptions(seed, DefaultOptions())
+}
+
+func NewWithOptions(seed uint64, opts Options) *Generator {
+	for seed == 0 {
+		seed = rand.Uint64()
+	}
+	opts.MaxItems = max(opts.MaxItems, 1)
+	if !opts.To.After(opts.From) {
+		opts.To = opts.From.Add(time.Second)
+	}
+	return &Generator{
+		seed:  seed,
+		opts:  opts,
+		faker: gofakeit.New(seed),
+	}
+}
+
+func (g *Generator) Seed() uint64 {
+	return g.seed
+}
+
+// OrderUID - случайный uid в духе настоящих (19 символов, латиница и цифры)
+func (g *Generator) OrderUID() string {
+	return g.faker.Lexify("???????????????????")
+}
+
+// Float64 - случайное число [0, 1) из того же источника, чтобы решения вызывающего тоже воспроизводились
+func (g *Generator) Float64() float64 {
+	return g.faker.Float64()
+}
+
+// IntN - случайное число [0, n) из того же источника
+func (g *Generator) IntN(n int) int {
+	return g.faker.IntN(n)
+}
+
+// ValidOrder - согласованный заказ: трек-номер один на заказ и позиции, total_price = price со скидкой sale (%),
+// goods_total - сумма total_price, amount = goods_total + delivery_cost + custom_fee,
+// оплата через несколько минут после создания, город, телефон, валюта и банк из одной страны
+func (g *Generator) ValidOrder(orderUID string) *models.Order {
+	f := g.faker
+	m := markets[f.IntN(len(markets))]
+	c := m.cities[f.IntN(len(m.cities))]
+	trackNumber := "WB" + strings.ToUpper(f.Lexify("??????????"))
+	created := f.DateRange(g.opts.From, g.opts.To).Truncate(time.Second).UTC()
+
+	items := make([]models.Item, 1+f.IntN(g.opts.MaxItems))
+	var goodsTotal int64
+	for i := range items {
+		price := int64(f.Number(100, 50_000))
+		sale := int64(f.Number(0, 70))
+		total := price * (100 - sale) / 100
+		goodsTotal += total
+		items[i] = models.Item{
+			OrderUId:    orderUID,
+			ChrtId:      int64(f.Number(1, 10_000_000)),
+			TrackNumber: trackNumber,
+			Price:       price,
+			RID:         fmt.Sprintf("%016x%s", f.Uint64(), f.Lexify("?????")),
+			Name:        f.ProductName(),
+			Sale:        sale,
+			Size:        sizes[f.IntN(len(sizes))],
+			TotalPrice:  total,
+			NmId:        int64(f.Number(1, 10_000_000)),
+			Brand:       f.Company(),
+			Status:      itemStatuses[f.IntN(len(itemStatuses))],
+		}
+	}
+	// доставка бесплатная от порога, пошлина - только с дорогих заказов
+	var deliveryCost, customFee int64
+	if goodsTotal < 3_000 {
+		deliveryCost = int64(f.Number(100, 1_500))
+	}
+	if goodsTotal > 100_000 {
+		customFee = goodsTotal / 100 * 15
+	}
+
 	return &models.Order{
 		OrderUId:          orderUID,
-		TrackNumber:       gofakeit.Noun(),
-		Entry:             gofakeit.Noun(),
-		Locale:            gofakeit.Language(),
-		InternalSignature: gofakeit.Noun(),
-		CustomerId:        gofakeit.ID(),
-		DeliveryService:   gofakeit.Dessert(),
-		Shardkey:          gofakeit.HackerNoun(),
-		SmId:              int64(gofakeit.Number(1, 100_000_000)),
-		DateCreated:       time.Time{}.UTC(),
-		OofShard:          gofakeit.Noun(),
+		TrackNumber:       trackNumber,
+		Entry:             "WBIL",
+		Locale:            m.locale,
+		InternalSignature: "",
+		CustomerId:        f.Username(),
+		DeliveryService:   deliveryServices[f.IntN(len(deliveryServices))],
+		Shardkey:          strconv.Itoa(f.IntN(10)),
+		SmId:              int64(f.Number(1, 100)),
+		DateCreated:       created,
+		OofShard:          strconv.Itoa(1 + f.IntN(2)),
 		Payment: models.Payment{
 			OrderId:      orderUID,
-			Transaction:  gofakeit.UUID(),
-			RequestId:    gofakeit.Noun(),
-			Currency:     gofakeit.Currency().Short,
-			Provider:     gofakeit.BeerName(),
-			Amount:       int64(gofakeit.Number(1, 100_000_000)),
-			PaymentDt:    int64(gofakeit.Number(1, 100_000_000)),
-			Bank:         gofakeit.BankName(),
-			DeliveryCost: int64(gofakeit.Number(1, 100_000_000)),
-			GoodsTotal:   int64(gofakeit.Number(1, 100_000_000)),
-			CustomFee:    int64(gofakeit.Number(1, 100_000_000)),
-		},
-		Items: []models.Item{
-			{
-				Id:          0,
-				OrderUId:    orderUID,
-				ChrtId:      int64(gofakeit.Number(1, 100_000_000)),
-				TrackNumber: gofakeit.Noun(),
-				Price:       int64(gofakeit.Number(1, 100_000_000)),
-				RID:         gofakeit.Noun(),
-				Name:        gofakeit.Name(),
-				Sale:        int64(gofakeit.Number(0, 100_000_000)),
-				Size:        gofakeit.RandomString([]string{"m", "l", "s"}),
-				TotalPrice:  int64(gofakeit.Number(1, 100_000_000)),
-				NmId:        int64(gofakeit.Number(1, 100_000_000)),
-				Brand:       gofakeit.BeerName(),
-				Status:      int64(gofakeit.Number(100, 600)),
-			},
+			Transaction:  f.UUID(),
+			RequestId:    f.DigitN(12),
+			Currency:     m.currency,
+			Provider:     providers[f.IntN(len(providers))],
+			Amount:       goodsTotal + deliveryCost + customFee,
+			PaymentDt:    created.Add(time.Duration(f.Number(5, 600)) * time.Second).Unix(),
+			Bank:         m.banks[f.IntN(len(m.banks))],
+			DeliveryCost: deliveryCost,
+			GoodsTotal:   goodsTotal,
+			CustomFee:    customFee,
 		},
+		Items: items,
 		Delivery: models.Delivery{
-			Id:       0,
 			OrderUId: orderUID,
-			Name:     gofakeit.Name(),
-			Phone:    gofakeit.Phone(),
-			Zip:      gofakeit.Zip(),
-			City:     gofakeit.City(),
-			Address:  gofakeit.Address().Address,
-			Region:   gofakeit.Country(),
-			Email:    gofakeit.Email(),
+			Name:     f.Name(),
+			Phone:    m.phoneCode + f.DigitN(m.phoneDigits),
+			Zip:      f.DigitN(m.zipDigits),
+			City:     c.name,
+			Address:  f.Street(),
+			Region:   c.region,
+			Email:    f.Email(),
 		},
 	}
 }
-
-func InvalidOrder(orderUID string) *models.Order {
-	order := ValidOrder(orderUID)
-	// слайс функций, из которого рандомно выбирается элемент, который портит модель заказа
-	mutations := []func(*models.Order){
-		func(o *models.Order) { o.OrderUId = "" },
-		func(o *models.Order) { o.TrackNumber = "" },
-		func(o *models.Order) { o.Entry = "" },
-		func(o *models.Order) { o.Locale = "" },
-		func(o *models.Order) { o.CustomerId = "" },
-		func(o *models.Order) { o.DeliveryService = "" },
-		func(o *models.Order) { o.Shardkey = "" },
-		func(o *models.Order) { o.SmId = 0 },
-		func(o *models.Order) { o.Items = []models.Item{} },
-		func(o *models.Order) { o.Payment.Amount = 0 },
-		func(o *models.Order) { o.Payment.Transaction = "" },
-		func(o *models.Order) { o.Payment.Currency = "" },
-		func(o *models.Order) { o.Payment.GoodsTotal = 0 },
-		func(o *models.Order) { o.Payment.DeliveryCost = -1 },
-		func(o *models.Order) { o.Items[0].Price = -1 },
-		func(o *models.Order) { o.Items[0].TotalPrice = -1 },
-		func(o *models.Order) { o.Items[0].Sale = -1 },
-		func(o *models.Order) { o.Items[0].Status = -1 },
-		func(o *models.Order) { o.Items[0].Name = "" },
-		func(o *models.Order) { o.Items[0].ChrtId = 0 },
-		func(o *models.Order) { o.Delivery.Name = "" },
-		func(o *models.Order) { o.Delivery.Phone = "" },
-		func(o *models.Order) { o.Delivery.Email = "" },
-		func(o *models.Order) { o.Delivery.City = "" },
-		func(o *models.Order) { o.Delivery.Address = "" },
-		func(o *models.Order) { o.Delivery.Zip = "" },
-		func(o *models.Order) { o.Delivery.Region = "" },
-	}
-	ind := gofakeit.Number(0, len(mutations)-1)
-	if len(order.Items) == 0 && ind >= 14 && ind <= 19 {
-		ind = 0
-	}
-	mutations[ind](order)
-
-	return order
-}
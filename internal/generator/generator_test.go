@@ -0,0 +1,98 @@
+package generator
+
+import (
+	"encoding/json"
+	"github.com/GameXost/wbTestCase/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func marshalOrders(t *testing.T, g *Generator) []byte {
+	var out []byte
+	for range 50 {
+		uid := g.OrderUID()
+		invalid, mutation := g.InvalidOrder(uid)
+		for _, order := range []any{g.ValidOrder(uid), invalid, mutation} {
+			data, err := json.Marshal(order)
+			require.NoError(t, err)
+			out = append(out, data...)
+		}
+	}
+	return out
+}
+
+func TestSameSeedSameOrders(t *testing.T) {
+	assert.Equal(t, marshalOrders(t, New(7)), marshalOrders(t, New(7)))
+	assert.NotEqual(t, marshalOrders(t, New(7)), marshalOrders(t, New(8)))
+}
+
+func TestZeroSeedIsRandom(t *testing.T) {
+	g := New(0)
+	assert.NotZero(t, g.Seed())
+	assert.Equal(t, marshalOrders(t, New(g.Seed())), marshalOrders(t, g))
+}
+
+// generatortest отсюда не импортировать (цикл), поэтому seed случайный и пишется в лог, если тест упал
+func testGenerator(t *testing.T) *Generator {
+	g := New(0)
+	t.Cleanup(func() {
+		if t.Failed() {
+			t.Logf("generator seed: %d", g.Seed())
+		}
+	})
+	return g
+}
+
+func TestValidOrderIsConsistent(t *testing.T) {
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(48 * time.Hour)
+	g := NewWithOptions(testGenerator(t).Seed(), Options{MaxItems: 3, From: from, To: to})
+	for range 200 {
+		order := g.ValidOrder(g.OrderUID())
+		require.NoError(t, service.ValidateOrder(order))
+
+		require.NotEmpty(t, order.Items)
+		assert.LessOrEqual(t, len(order.Items), 3)
+		var goodsTotal int64
+		for _, item := range order.Items {
+			assert.Equal(t, order.TrackNumber, item.TrackNumber)
+			assert.Equal(t, item.Price*(100-item.Sale)/100, item.TotalPrice)
+			goodsTotal += item.TotalPrice
+		}
+		assert.Equal(t, goodsTotal, order.Payment.GoodsTotal)
+		assert.Equal(t, goodsTotal+order.Payment.DeliveryCost+order.Payment.CustomFee, order.Payment.Amount)
+
+		assert.False(t, order.DateCreated.Before(from) || order.DateCreated.After(to), "date %s out of window", order.DateCreated)
+		assert.GreaterOrEqual(t, order.Payment.PaymentDt, order.DateCreated.Unix())
+
+		i := slices.IndexFunc(markets, func(m market) bool { return m.currency == order.Payment.Currency })
+		require.NotEqual(t, -1, i, "unknown currency %s", order.Payment.Currency)
+		m := markets[i]
+		assert.Equal(t, m.locale, order.Locale)
+		assert.Contains(t, m.banks, order.Payment.Bank)
+		assert.Contains(t, m.cities, city{order.Delivery.City, order.Delivery.Region})
+		assert.True(t, strings.HasPrefix(order.Delivery.Phone, m.phoneCode))
+		assert.Len(t, order.Delivery.Zip, int(m.zipDigits))
+	}
+}
+
+func TestEveryMutationBreaksValidation(t *testing.T) {
+	g := testGenerator(t)
+	names := Mutations()
+	assert.Len(t, names, len(slices.Compact(slices.Sorted(slices.Values(names)))), "mutation names are unique")
+	for _, name := range names {
+		order, err := g.MutatedOrder(g.OrderUID(), name)
+		require.NoError(t, err)
+		assert.Error(t, service.ValidateOrder(order), name)
+	}
+	_, err := g.MutatedOrder("uid", "no_such_mutation")
+	assert.Error(t, err)
+
+	order, name := g.InvalidOrder(g.OrderUID())
+	assert.Contains(t, names, name)
+	assert.Error(t, service.ValidateOrder(order), name)
+}
@@ -0,0 +1,45 @@
+// Package generatortest - генераторы заказов для тестов, отдельно от generator, чтобы он не тянул testing
+package generatortest
+
+import (
+	"github.com/GameXost/wbTestCase/internal/generator"
+	"hash/fnv"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// SeedEnv - чем задать seed тестовых генераторов, чтобы повторить упавший тест
+const SeedEnv = "GENERATOR_SEED"
+
+// генераторы идущих тестов: хелперы и сам тест берут заказы из одного и того же
+var perTest sync.Map
+
+// New - генератор теста (один на тест). Seed теста - GENERATOR_SEED (или случайный), смешанный с именем теста,
+// чтобы разные тесты не генерировали одинаковые заказы. Если тест упал, GENERATOR_SEED пишется в лог
+func New(t testing.TB) *generator.Generator {
+	t.Helper()
+	if g, has := perTest.Load(t); has {
+		return g.(*generator.Generator)
+	}
+	base := rand.Uint64()
+	if env := os.Getenv(SeedEnv); env != "" {
+		var err error
+		if base, err = strconv.ParseUint(env, 10, 64); err != nil {
+			t.Fatalf("bad %s: %v", SeedEnv, err)
+		}
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(t.Name()))
+	g := generator.New(base ^ h.Sum64())
+	perTest.Store(t, g)
+	t.Cleanup(func() {
+		perTest.Delete(t)
+		if t.Failed() {
+			t.Logf("generator: reproduce with %s=%d go test -run '^%s$'", SeedEnv, base, t.Name())
+		}
+	})
+	return g
+}
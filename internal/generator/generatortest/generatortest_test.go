@@ -0,0 +1,22 @@
+package generatortest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"hash/fnv"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	t.Setenv(SeedEnv, "99")
+	g := New(t)
+	assert.Same(t, g, New(t), "one generator per test")
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(t.Name()))
+	assert.Equal(t, 99^h.Sum64(), g.Seed(), "seed depends only on GENERATOR_SEED and test name")
+
+	var sub [2]uint64
+	for i := range sub {
+		t.Run("sub", func(t *testing.T) { sub[i] = New(t).Seed() })
+	}
+	assert.NotEqual(t, sub[0], sub[1], "tests with different names get different seeds")
+}
@@ -0,0 +1,83 @@
+package generator
+
+// market - согласованные между собой локаль, валюта, страна, телефоны, индексы и банки
+type market struct {
+	locale   string
+	currency string
+	// код страны и сколько цифр номера после него
+	phoneCode   string
+	phoneDigits uint
+	zipDigits   uint
+	banks       []string
+	cities      []city
+}
+
+type city struct {
+	name   string
+	region string
+}
+
+var markets = []market{
+	{
+		locale:      "ru",
+		currency:    "RUB",
+		phoneCode:   "+7",
+		phoneDigits: 10,
+		zipDigits:   6,
+		banks:       []string{"sber", "alpha", "tinkoff", "vtb"},
+		cities: []city{
+			{"Moscow", "Moscow"},
+			{"Saint Petersburg", "Leningrad Oblast"},
+			{"Kazan", "Tatarstan"},
+			{"Novosibirsk", "Novosibirsk Oblast"},
+			{"Yekaterinburg", "Sverdlovsk Oblast"},
+		},
+	},
+	{
+		locale:      "kk",
+		currency:    "KZT",
+		phoneCode:   "+7",
+		phoneDigits: 10,
+		zipDigits:   6,
+		banks:       []string{"kaspi", "halyk", "forte"},
+		cities: []city{
+			{"Almaty", "Almaty Region"},
+			{"Astana", "Akmola Region"},
+			{"Shymkent", "Turkistan Region"},
+		},
+	},
+	{
+		locale:      "be",
+		currency:    "BYN",
+		phoneCode:   "+375",
+		phoneDigits: 9,
+		zipDigits:   6,
+		banks:       []string{"belarusbank", "priorbank", "belagroprombank"},
+		cities: []city{
+			{"Minsk", "Minsk Region"},
+			{"Gomel", "Gomel Region"},
+			{"Brest", "Brest Region"},
+		},
+	},
+	{
+		locale:      "en",
+		currency:    "USD",
+		phoneCode:   "+1",
+		phoneDigits: 10,
+		zipDigits:   5,
+		banks:       []string{"chase", "citi", "wells fargo"},
+		cities: []city{
+			{"New York", "New York"},
+			{"Austin", "Texas"},
+			{"Seattle", "Washington"},
+		},
+	},
+}
+
+var (
+	deliveryServices = []string{"meest", "cdek", "boxberry", "wb"}
+	providers        = []string{"wbpay", "sbp", "card"}
+	sizes            = []string{"0", "XS", "S", "M", "L", "XL"}
+	// 202 - доставлен, остальные - промежуточные статусы
+	itemStatuses = []int64{202, 202, 202, 200, 201, 203}
+)
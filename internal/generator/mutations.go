@@ -0,0 +1,86 @@
+package generator
+
+import (
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"strings"
+)
+
+// HeaderMutation - заголовок записи с именем порчи: по dlq видно, что именно ломали
+const HeaderMutation = "generator.mutation"
+
+// mutation - именованный способ испортить заказ так, чтобы его отбраковал консьюмер
+type mutation struct {
+	name  string
+	apply func(o *models.Order)
+}
+
+// каталог порчи: сначала пустые и отрицательные поля, потом смысловые ошибки, которые тегами не видны
+var mutations = []mutation{
+	{"order.uid_empty", func(o *models.Order) { o.OrderUId = "" }},
+	{"order.track_number_empty", func(o *models.Order) { o.TrackNumber = "" }},
+	{"order.entry_empty", func(o *models.Order) { o.Entry = "" }},
+	{"order.locale_empty", func(o *models.Order) { o.Locale = "" }},
+	{"order.customer_id_empty", func(o *models.Order) { o.CustomerId = "" }},
+	{"order.delivery_service_empty", func(o *models.Order) { o.DeliveryService = "" }},
+	{"order.shardkey_empty", func(o *models.Order) { o.Shardkey = "" }},
+	{"order.sm_id_zero", func(o *models.Order) { o.SmId = 0 }},
+	{"items.empty", func(o *models.Order) { o.Items = []models.Item{} }},
+	{"item.price_negative", func(o *models.Order) { o.Items[0].Price = -1 }},
+	{"item.total_price_negative", func(o *models.Order) { o.Items[0].TotalPrice = -1 }},
+	{"item.sale_negative", func(o *models.Order) { o.Items[0].Sale = -1 }},
+	{"item.status_negative", func(o *models.Order) { o.Items[0].Status = -1 }},
+	{"item.name_empty", func(o *models.Order) { o.Items[0].Name = "" }},
+	{"item.chrt_id_zero", func(o *models.Order) { o.Items[0].ChrtId = 0 }},
+	{"payment.amount_zero", func(o *models.Order) { o.Payment.Amount = 0 }},
+	{"payment.transaction_empty", func(o *models.Order) { o.Payment.Transaction = "" }},
+	{"payment.currency_empty", func(o *models.Order) { o.Payment.Currency = "" }},
+	{"payment.goods_total_zero", func(o *models.Order) { o.Payment.GoodsTotal = 0 }},
+	{"payment.delivery_cost_negative", func(o *models.Order) { o.Payment.DeliveryCost = -1 }},
+	{"delivery.name_empty", func(o *models.Order) { o.Delivery.Name = "" }},
+	{"delivery.phone_empty", func(o *models.Order) { o.Delivery.Phone = "" }},
+	{"delivery.email_empty", func(o *models.Order) { o.Delivery.Email = "" }},
+	{"delivery.city_empty", func(o *models.Order) { o.Delivery.City = "" }},
+	{"delivery.address_empty", func(o *models.Order) { o.Delivery.Address = "" }},
+	{"delivery.zip_empty", func(o *models.Order) { o.Delivery.Zip = "" }},
+	{"delivery.region_empty", func(o *models.Order) { o.Delivery.Region = "" }},
+	// amount не сходится с goods_total + delivery_cost + custom_fee
+	{"totals_mismatch", func(o *models.Order) { o.Payment.Amount += 100 }},
+	{"bad_email", func(o *models.Order) { o.Delivery.Email = strings.Replace(o.Delivery.Email, "@", " at ", 1) }},
+	// старый код рубля, в ISO 4217 его уже нет
+	{"unknown_currency", func(o *models.Order) { o.Payment.Currency = "RUR" }},
+	// сдвиг, а не time.Now(), чтобы seed давал те же заказы
+	{"future_date", func(o *models.Order) {
+		o.DateCreated = o.DateCreated.AddDate(100, 0, 0)
+		o.Payment.PaymentDt = o.DateCreated.Unix()
+	}},
+}
+
+// Mutations - имена всей порчи из каталога в порядке каталога
+func Mutations() []string {
+	names := make([]string, len(mutations))
+	for i, m := range mutations {
+		names[i] = m.name
+	}
+	return names
+}
+
+// InvalidOrder - валидный заказ со случайной порчей из каталога, вторым значением - ее имя
+func (g *Generator) InvalidOrder(orderUID string) (*models.Order, string) {
+	order := g.ValidOrder(orderUID)
+	m := mutations[g.faker.IntN(len(mutations))]
+	m.apply(order)
+	return order, m.name
+}
+
+// MutatedOrder - валидный заказ с конкретной порчей из Mutations
+func (g *Generator) MutatedOrder(orderUID, name string) (*models.Order, error) {
+	for _, m := range mutations {
+		if m.name == name {
+			order := g.ValidOrder(orderUID)
+			m.apply(order)
+			return order, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown mutation %q", name)
+}
@@ -0,0 +1,126 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	// после паузы один воркер пробует сохранить свою запись, остальные ждут результата
+	breakerHalfOpen
+)
+
+// breaker - circuit breaker вокруг бд: после threshold временных ошибок подряд
+// перестает пускать запросы на cooldown, потом пропускает одну пробу.
+// Проба прошла - закрывается, нет - снова ждет cooldown
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	onOpen    func()
+	onClose   func()
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	// закрывается при каждой смене состояния, чтобы разбудить ждущих
+	changed chan struct{}
+}
+
+func newBreaker(threshold int, cooldown time.Duration, onOpen, onClose func()) *breaker {
+	return &breaker{
+		threshold: max(threshold, 1),
+		cooldown:  cooldown,
+		onOpen:    onOpen,
+		onClose:   onClose,
+		changed:   make(chan struct{}),
+	}
+}
+
+// wait блокируется, пока breaker не разрешит обратиться к бд. Ошибка - только отмена контекста
+func (b *breaker) wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		if b.state == breakerClosed {
+			b.mu.Unlock()
+			return nil
+		}
+		remaining := b.cooldown - time.Since(b.openedAt)
+		if b.state == breakerOpen && remaining <= 0 {
+			b.state = breakerHalfOpen
+			b.mu.Unlock()
+			return nil
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		// в half-open ждем только результата пробы
+		var timeout <-chan time.Time
+		var timer *time.Timer
+		if remaining > 0 {
+			timer = time.NewTimer(remaining)
+			timeout = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// success - бд ответила (даже если отказала самой записи)
+func (b *breaker) success() {
+	b.mu.Lock()
+	b.failures = 0
+	if b.state == breakerClosed {
+		b.mu.Unlock()
+		return
+	}
+	b.setState(breakerClosed)
+	b.mu.Unlock()
+	b.onClose()
+}
+
+// failure - бд недоступна
+func (b *breaker) failure() {
+	b.mu.Lock()
+	b.failures++
+	switch {
+	case b.state == breakerHalfOpen:
+		// уже на паузе, просто начинаем cooldown заново
+		b.openedAt = time.Now()
+		b.setState(breakerOpen)
+		b.mu.Unlock()
+	case b.state == breakerClosed && b.failures >= b.threshold:
+		b.openedAt = time.Now()
+		b.setState(breakerOpen)
+		b.mu.Unlock()
+		b.onOpen()
+	default:
+		b.mu.Unlock()
+	}
+}
+
+func (b *breaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state != breakerClosed
+}
+
+func (b *breaker) setState(state breakerState) {
+	b.state = state
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
@@ -0,0 +1,97 @@
+package kafka
+
+import (
+	"context"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	var opened, closed atomic.Int32
+	b := newBreaker(2, time.Hour, func() { opened.Add(1) }, func() { closed.Add(1) })
+
+	b.failure()
+	assert.False(t, b.isOpen())
+	b.success()
+	b.failure()
+	assert.False(t, b.isOpen(), "success resets the counter")
+	b.failure()
+	assert.True(t, b.isOpen())
+	assert.Equal(t, int32(1), opened.Load())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, b.wait(ctx), context.DeadlineExceeded)
+	assert.Equal(t, int32(0), closed.Load())
+}
+
+func TestBreakerSingleProbeAfterCooldown(t *testing.T) {
+	var closed atomic.Int32
+	b := newBreaker(1, 20*time.Millisecond, func() {}, func() { closed.Add(1) })
+	b.failure()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, b.wait(ctx), "probe is allowed after cooldown")
+
+	waiting := make(chan error, 1)
+	go func() { waiting <- b.wait(ctx) }()
+	select {
+	case <-waiting:
+		t.Fatal("only one probe at a time")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// проба упала - ждем еще cooldown и пускаем новую
+	b.failure()
+	require.NoError(t, <-waiting)
+	assert.True(t, b.isOpen())
+
+	b.success()
+	assert.False(t, b.isOpen())
+	assert.Equal(t, int32(1), closed.Load())
+	require.NoError(t, b.wait(ctx))
+}
+
+func TestDatabaseOutageDoesNotDeadLetter(t *testing.T) {
+	cluster := newTestCluster(t, 2)
+	var down atomic.Bool
+	down.Store(true)
+	var attempts atomic.Int32
+	srv := &fakeService{create: func(ctx context.Context, order *models.Order) error {
+		attempts.Add(1)
+		if down.Load() {
+			return &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+		}
+		return nil
+	}}
+
+	produce(t, cluster, 0, "a1", "a2")
+	produce(t, cluster, 1, "b1")
+	cfg := testConfig(cluster)
+	consumer := startConsumer(t, cfg, srv, nil)
+
+	require.Eventually(t, consumer.breaker.isOpen, 10*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		return len(consumer.client.PauseFetchPartitions(nil)[testTopic]) > 0
+	}, 10*time.Second, 10*time.Millisecond)
+
+	// на паузе бд опрашивается только пробами раз в cooldown, а не всеми воркерами
+	before := attempts.Load()
+	time.Sleep(10 * cfg.BreakerCooldown)
+	assert.LessOrEqual(t, attempts.Load()-before, int32(12))
+
+	down.Store(false)
+	require.Eventually(t, func() bool {
+		return srv.has("a1") && srv.has("a2") && srv.has("b1")
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.False(t, consumer.breaker.isOpen())
+	assert.Empty(t, consumer.client.PauseFetchPartitions(nil))
+	assert.Equal(t, 0, dlqLen(t, cluster))
+}
@@ -0,0 +1,89 @@
+package kafka
+
+import (
+	"context"
+	"github.com/GameXost/wbTestCase/internal/codec"
+	"github.com/GameXost/wbTestCase/internal/generator/generatortest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sr"
+	"github.com/twmb/franz-go/pkg/sr/srfake"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func produceEncoded(t *testing.T, cluster *kfake.Cluster, client *sr.Client, format, uid string) {
+	encoder, err := codec.NewEncoder(context.Background(), client, format, testTopic+"-value")
+	require.NoError(t, err)
+	value, err := encoder.Encode(generatortest.New(t).ValidOrder(uid))
+	require.NoError(t, err)
+	produceRaw(t, cluster, &kgo.Record{
+		Key:     []byte(uid),
+		Value:   value,
+		Headers: []kgo.RecordHeader{{Key: codec.HeaderContentType, Value: []byte(encoder.ContentType())}},
+	})
+}
+
+func TestSchemaRegistryPayloads(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	registry := srfake.New()
+	t.Cleanup(registry.Close)
+	client, err := sr.NewClient(sr.URLs(registry.URL()))
+	require.NoError(t, err)
+
+	produceEncoded(t, cluster, client, codec.FormatProtobuf, "proto")
+	produceEncoded(t, cluster, client, codec.FormatAvro, "avro")
+	produce(t, cluster, 0, "plain") // json без заголовка, как раньше
+	produceRaw(t, cluster, &kgo.Record{
+		Key:     []byte("unknown_schema"),
+		Value:   []byte{0, 0, 0, 0x10, 0, 0},
+		Headers: []kgo.RecordHeader{{Key: codec.HeaderContentType, Value: []byte(codec.ContentTypeProtobuf)}},
+	})
+
+	srv := &fakeService{}
+	cfg := testConfig(cluster)
+	cfg.SchemaRegistryURL = registry.URL()
+	startConsumer(t, cfg, srv, nil)
+
+	require.Eventually(t, func() bool {
+		return srv.has("proto") && srv.has("avro") && srv.has("plain")
+	}, 10*time.Second, 10*time.Millisecond)
+	dlq := readDLQ(t, cluster, 1)
+	assert.Equal(t, "unknown_schema", string(dlq[0].Key))
+	assert.Equal(t, ReasonInvalidPayload, headerValue(dlq[0], HeaderReason))
+}
+
+// пока registry лежит, запись ждет, а не уходит в dlq
+func TestSchemaRegistryOutageIsRetried(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	registry := srfake.New()
+	t.Cleanup(registry.Close)
+	client, err := sr.NewClient(sr.URLs(registry.URL()))
+	require.NoError(t, err)
+	produceEncoded(t, cluster, client, codec.FormatAvro, "waits")
+
+	var failed atomic.Int32
+	registry.Intercept(func(w http.ResponseWriter, r *http.Request) bool {
+		if strings.HasPrefix(r.URL.Path, "/schemas/ids/") && failed.Add(1) <= 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return true
+		}
+		return false
+	})
+
+	srv := &fakeService{}
+	cfg := testConfig(cluster)
+	cfg.SchemaRegistryURL = registry.URL()
+	startConsumer(t, cfg, srv, nil)
+
+	require.Eventually(t, func() bool {
+		return srv.has("waits")
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.Greater(t, failed.Load(), int32(3))
+	assert.Equal(t, 0, dlqLen(t, cluster))
+}
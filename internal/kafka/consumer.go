@@ -2,43 +2,181 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/GameXost/wbTestCase/internal/apperror"
+	"github.com/GameXost/wbTestCase/internal/codec"
+	"github.com/GameXost/wbTestCase/internal/config"
 	"github.com/GameXost/wbTestCase/internal/models"
-	"github.com/GameXost/wbTestCase/internal/service"
+	"github.com/GameXost/wbTestCase/metrics"
 	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sr"
 	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
+// как часто коммитить обработанные оффсеты
+const commitInterval = time.Second
+
+type OrderService interface {
+	CreateOrder(ctx context.Context, order *models.Order, raw *models.RawOrder) error
+	CreateOrderAt(ctx context.Context, order *models.Order, raw *models.RawOrder, offset models.PartitionOffset) error
+	CancelOrder(ctx context.Context, orderUID, source string) error
+}
+
+// QuarantineStore - куда складывать записи, которые не приняла dlq
+type QuarantineStore interface {
+	Quarantine(ctx context.Context, record *models.QuarantinedRecord) error
+	ListQuarantined(ctx context.Context, limit int) ([]models.QuarantinedRecord, error)
+	// ClaimQuarantined помечает запись отпущенной и отдает ее, ErrNotFound - нет или уже забрана
+	ClaimQuarantined(ctx context.Context, id int64) (*models.QuarantinedRecord, error)
+	// UnclaimQuarantined возвращает забранную запись в карантин, если отпустить не вышло
+	UnclaimQuarantined(ctx context.Context, id int64) error
+}
+
 type Consumer struct {
 	client   *kgo.Client
-	service  *service.Service
+	service  OrderService
+	decoder  *codec.Decoder
 	dlqTopic string
+	group    string
+	host     string
+	retry    RetryPolicy
+	breaker  *breaker
+
+	dlqAttempts int
+	dlqFallback string
+	quarantine  QuarantineStore
+	// не nil - оффсеты живут в бд (KAFKA_OFFSETS_IN_DB)
+	offsets OffsetStore
+	// tombstone отменяет заказ (KAFKA_TOMBSTONES)
+	tombstones bool
+	// каким должен быть ключ записи и что делать, если он другой
+	keyStrategy string
+	keyPolicy   string
+
+	lagInterval time.Duration
+	monitorMu   sync.Mutex
+	assigned    map[topicPartition]struct{}
+	lag         map[topicPartition]int64
+
+	// ограничение на число записей, которые обрабатываются одновременно во всех партициях
+	sem chan struct{}
+
+	workersMu sync.Mutex
+	workers   map[topicPartition]*partitionWorker
+	workersWG sync.WaitGroup
 }
 
-func NewConsumer(brokers []string, topic, group string, srv *service.Service, dlqTopic string) (*Consumer, error) {
+// NewConsumer: quarantine может быть nil, тогда при недоступной dlq партиция останавливается.
+// offsets используется, только если включен cfg.OffsetsInDB
+func NewConsumer(cfg config.KafkaConfig, srv OrderService, quarantine QuarantineStore, offsets OffsetStore) (*Consumer, error) {
+	if _, err := OrderKey(cfg.KeyStrategy, &models.Order{}); err != nil {
+		return nil, err
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	c := &Consumer{
+		service:  srv,
+		dlqTopic: cfg.DLQTopic,
+		group:    cfg.Group,
+		host:     host,
+		retry: RetryPolicy{
+			MaxAttempts: cfg.RetryMaxAttempts,
+			BaseDelay:   cfg.RetryBaseDelay,
+			MaxDelay:    cfg.RetryMaxDelay,
+		},
+		dlqAttempts: max(cfg.DLQRetryAttempts, 1),
+		dlqFallback: cfg.DLQFallback,
+		quarantine:  quarantine,
+		tombstones:  cfg.Tombstones,
+		keyStrategy: cfg.KeyStrategy,
+		keyPolicy:   cfg.KeyPolicy,
+		lagInterval: cfg.LagInterval,
+		assigned:    make(map[topicPartition]struct{}),
+		lag:         make(map[topicPartition]int64),
+		sem:         make(chan struct{}, max(cfg.Parallelism, 1)),
+		workers:     make(map[topicPartition]*partitionWorker),
+	}
+	// без registry консьюмер понимает только json
+	var registry *sr.Client
+	if cfg.SchemaRegistryURL != "" {
+		registry, err = sr.NewClient(sr.URLs(cfg.SchemaRegistryURL))
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.decoder = codec.NewDecoder(registry)
+	c.breaker = newBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown, c.pauseFetch, c.resumeFetch)
+
 	options := []kgo.Opt{
-		kgo.SeedBrokers(brokers...),
-		kgo.ConsumerGroup(group),
-		kgo.ConsumeTopics(topic),
+		kgo.SeedBrokers(cfg.Brokers...),
+		kgo.ConsumerGroup(cfg.Group),
+		kgo.ConsumeTopics(cfg.Topic),
 		kgo.DisableAutoCommit(),
-		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()), // в бд защита от дублей, не пропустим необработанные
+		kgo.ConsumeResetOffset(resetOffset(cfg)),
+		kgo.RecordDeliveryTimeout(cfg.DLQProduceTimeout), // иначе отправка в лежащую dlq висит вечно
+		kgo.OnPartitionsAssigned(c.onAssigned),
+		kgo.OnPartitionsRevoked(c.onRevoked),
+		kgo.OnPartitionsLost(c.onLost),
+	}
+	if cfg.OffsetsInDB && offsets != nil {
+		c.offsets = offsets
+		// позиция в бд главнее закоммиченной в кафке
+		options = append(options, kgo.AdjustFetchOffsetsFn(c.seedOffsets))
 	}
-	client, err := kgo.NewClient(options...)
+	c.client, err = kgo.NewClient(options...)
 	if err != nil {
 		return nil, err
 	}
+	return c, nil
+}
 
-	return &Consumer{
-		client:   client,
-		service:  srv,
-		dlqTopic: dlqTopic,
-	}, nil
+// resetOffset - откуда читать партицию, у которой нет закоммиченного оффсета
+func resetOffset(cfg config.KafkaConfig) kgo.Offset {
+	switch cfg.ResetOffset {
+	case config.ResetOffsetLatest:
+		return kgo.NewOffset().AtEnd()
+	case config.ResetOffsetTimestamp:
+		return kgo.NewOffset().AfterMilli(cfg.ResetTimestamp.UnixMilli())
+	default:
+		// в бд защита от дублей, не пропустим необработанные
+		return kgo.NewOffset().AtStart()
+	}
 }
 
+// Start раздает записи воркерам партиций: внутри партиции порядок сохраняется,
+// а медленный заказ тормозит только свою партицию
 func (c *Consumer) Start(ctx context.Context) error {
+	commitCtx, stopCommits := context.WithCancel(context.Background())
+	commitsDone := make(chan struct{})
+	go func() {
+		defer close(commitsDone)
+		c.commitLoop(commitCtx)
+	}()
+	lagDone := make(chan struct{})
+	go func() {
+		defer close(lagDone)
+		c.lagLoop(commitCtx)
+	}()
+	defer func() {
+		c.stopWorkers()
+		stopCommits()
+		<-commitsDone
+		<-lagDone
+		finalCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		c.commit(finalCtx)
+	}()
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -48,85 +186,231 @@ func (c *Consumer) Start(ctx context.Context) error {
 		}
 
 		fetches := c.client.PollFetches(ctx)
-		if err := fetches.Err(); err != nil {
-			if errors.Is(err, context.Canceled) || errors.Is(err, kgo.ErrClientClosed) {
-
-				return nil
-			}
-			log.Printf("kafka error: %v", err)
-			time.Sleep(time.Second)
-			continue
-		}
-		iter := fetches.RecordIter()
-		for !iter.Done() {
-			record := iter.Next()
-			for i := 0; i < 5; i++ {
-				err := c.handleMessage(ctx, record)
-				if err == nil {
-					break
-				}
-				log.Printf("critical error handling message (topic: %s, partition: %d, offset: %d): %v",
-					record.Topic, record.Partition, record.Offset, err)
-
-				if ctx.Err() != nil {
-					return ctx.Err()
-				}
-				if i == 4 {
-					c.sendToDLQ(ctx, record)
-					break
-				}
-				time.Sleep(3 * time.Second)
+		if fetches.IsClientClosed() || ctx.Err() != nil {
+			return nil
+		}
+		if !c.dispatch(ctx, fetches) {
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
 			}
 		}
+	}
+}
 
-		if err := c.client.CommitUncommittedOffsets(ctx); err != nil {
-			log.Printf("commit offset error: %v", err)
+// dispatch раздает записи воркерам партиций, false - какие-то партиции вернули ошибку.
+// Ошибка одной партиции не повод выкидывать записи остальных: клиент их уже отдал и второй раз не пришлет,
+// а коммит по следующим записям тихо их перескочит
+func (c *Consumer) dispatch(ctx context.Context, fetches kgo.Fetches) bool {
+	ok := true
+	fetches.EachError(func(topic string, partition int32, err error) {
+		if errors.Is(err, context.Canceled) {
+			return
+		}
+		log.Printf("kafka fetch error %s/%d: %v", topic, partition, err)
+		ok = false
+	})
+	fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+		if len(p.Records) == 0 {
+			return
+		}
+		if c.breaker.isOpen() {
+			// партиция пришла уже после паузы (например, после ребаланса)
+			c.client.PauseFetchPartitions(map[string][]int32{p.Topic: {p.Partition}})
+		}
+		if w := c.worker(ctx, topicPartition{topic: p.Topic, partition: p.Partition}); w != nil {
+			w.enqueue(ctx, p.Records)
 		}
+	})
+	return ok
+}
 
+func (c *Consumer) commitLoop(ctx context.Context) {
+	ticker := time.NewTicker(commitInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.commit(ctx)
+		}
 	}
-
 }
 
+// handleMessage доводит запись до конца: сохраняет заказ или отправляет в dlq.
+// Ошибка - отменили контекст или запись некуда деть (dlq и карантин недоступны)
 func (c *Consumer) handleMessage(ctx context.Context, record *kgo.Record) error {
-	var order models.Order
+	defer observeStage(stageTotal, time.Now())
+	metrics.ConsumerRecordsConsumed.WithLabelValues(record.Topic, strconv.Itoa(int(record.Partition))).Inc()
+	if record.Value == nil && c.tombstones {
+		return c.cancelOrder(ctx, record)
+	}
+	contentType := headerValue(record, codec.HeaderContentType)
 
-	err := json.Unmarshal(record.Value, &order)
+	decodeStart := time.Now()
+	order, err := c.decode(ctx, record, contentType)
+	observeStage(stageDecode, decodeStart)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 	if err != nil {
-		log.Printf("invalid json error: %v", err)
-		c.sendToDLQ(ctx, record)
-		return nil
+		log.Printf("invalid payload error (content-type: %q): %v", contentType, err)
+		reason := ReasonInvalidPayload
+		if codec.Format(contentType) == codec.FormatJSON {
+			reason = ReasonInvalidJSON
+		}
+		return c.sendToDLQ(ctx, record, failure{reason: reason, err: err, attempts: 1})
 	}
 
 	if order.OrderUId == "" {
 		log.Println("order without UID")
-		c.sendToDLQ(ctx, record)
-		return nil
+		return c.sendToDLQ(ctx, record, failure{reason: ReasonMissingUID, err: apperror.ErrOrderUIDMissing, attempts: 1})
 	}
 
-	err = c.service.CreateOrder(ctx, &order)
-	if err != nil {
-		if errors.Is(err, apperror.ErrValidation) {
-			c.sendToDLQ(ctx, record)
+	// стратегию проверил NewConsumer
+	key, _ := OrderKey(c.keyStrategy, order)
+	if string(record.Key) != key {
+		return c.wrongKey(ctx, record, order, key)
+	}
+
+	return c.createOrder(ctx, record, order)
+}
+
+// decode разбирает значение по content-type. Недоступный registry повторяем, пока не ответит:
+// запись тут ни при чем, в dlq ей не место
+func (c *Consumer) decode(ctx context.Context, record *kgo.Record, contentType string) (*models.Order, error) {
+	for attempt := 1; ; attempt++ {
+		order, err := c.decoder.Decode(ctx, contentType, record.Value)
+		if !errors.Is(err, codec.ErrRegistryUnavailable) || ctx.Err() != nil {
+			return order, err
+		}
+		log.Printf("decode (topic: %s, partition: %d, offset: %d, attempt: %d): %v",
+			record.Topic, record.Partition, record.Offset, attempt, err)
+		if err = sleepCtx(ctx, c.retry.backoff(attempt)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func headerValue(record *kgo.Record, key string) string {
+	for _, h := range record.Headers {
+		if strings.EqualFold(h.Key, key) {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c *Consumer) createOrder(ctx context.Context, record *kgo.Record, order *models.Order) error {
+	return c.persist(ctx, record, func() error {
+		err := c.saveOrder(ctx, record, order)
+		switch {
+		case err == nil:
+			metrics.ConsumerRecordsPersisted.Inc()
+		// заказ уже сохранен раньше (повтор после рестарта или дубль от продюсера) - запись обработана
+		case errors.Is(err, apperror.ErrDuplicate):
+			metrics.ConsumerRecordsDuplicated.Inc()
+			return nil
+		}
+		return err
+	})
+}
+
+// cancelOrder обрабатывает tombstone: ключ записи - uid заказа, который надо отменить.
+// Отмена идемпотентна, поэтому оффсет в бд двигаем уже после нее, как за dlq
+func (c *Consumer) cancelOrder(ctx context.Context, record *kgo.Record) error {
+	orderUID := string(record.Key)
+	if orderUID == "" {
+		log.Println("tombstone without key")
+		return c.sendToDLQ(ctx, record, failure{reason: ReasonMissingUID, err: apperror.ErrOrderUIDMissing, attempts: 1})
+	}
+	source := fmt.Sprintf("%s/%d@%d", record.Topic, record.Partition, record.Offset)
+	err := c.persist(ctx, record, func() error {
+		err := c.service.CancelOrder(ctx, orderUID, source)
+		switch {
+		case err == nil:
+			metrics.ConsumerTombstones.WithLabelValues("cancelled").Inc()
+		// заказа нет или его уже отменили (повтор записи) - делать нечего
+		case errors.Is(err, apperror.ErrNotFound):
+			log.Printf("tombstone for unknown or cancelled order %q (%s)", orderUID, source)
+			metrics.ConsumerTombstones.WithLabelValues("not_found").Inc()
 			return nil
 		}
 		return err
+	})
+	if err != nil {
+		return err
 	}
+	c.skipOffset(ctx, record)
 	return nil
 }
 
-func (c *Consumer) Close() {
-	if c.client != nil {
-		c.client.Close()
+// persist пишет в бд с повторами. Временные ошибки (бд недоступна) повторяются, пока не получится:
+// такие записи валидные и в dlq им не место, а чтобы не долбить лежащую бд, есть breaker
+func (c *Consumer) persist(ctx context.Context, record *kgo.Record, save func() error) error {
+	for attempt := 1; ; attempt++ {
+		if err := c.breaker.wait(ctx); err != nil {
+			return err
+		}
+		persistStart := time.Now()
+		err := save()
+		observeStage(stagePersist, persistStart)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		class := classify(err)
+		if err != nil && class == classTransient {
+			c.breaker.failure()
+		} else {
+			c.breaker.success()
+		}
+		if err == nil {
+			return nil
+		}
+
+		log.Printf("error handling message (topic: %s, partition: %d, offset: %d, attempt: %d, class: %s): %v",
+			record.Topic, record.Partition, record.Offset, attempt, class, err)
+		if class == classPermanent || class == classUnknown && attempt >= c.retry.MaxAttempts {
+			return c.sendToDLQ(ctx, record, newFailure(err, attempt))
+		}
+		if err = sleepCtx(ctx, c.retry.backoff(attempt)); err != nil {
+			return err
+		}
 	}
 }
 
-func (c *Consumer) sendToDLQ(ctx context.Context, record *kgo.Record) {
-	dlqRec := &kgo.Record{
-		Topic: c.dlqTopic,
-		Key:   record.Key,
-		Value: record.Value,
+// pauseFetch останавливает чтение всех известных партиций, пока бд лежит
+func (c *Consumer) pauseFetch() {
+	partitions := make(map[string][]int32)
+	c.workersMu.Lock()
+	for tp := range c.workers {
+		partitions[tp.topic] = append(partitions[tp.topic], tp.partition)
+	}
+	c.workersMu.Unlock()
+	c.client.PauseFetchPartitions(partitions)
+	metrics.ConsumerCircuitOpen.Set(1)
+	log.Println("kafka cons: database is unavailable, fetching paused")
+}
+
+// resumeFetch продолжает чтение всех партиций, кроме остановленных stopPartition. Воркеры, вышедшие штатно
+// (отзыв, остановка), тоже stopped, но их партиции держать на паузе незачем
+func (c *Consumer) resumeFetch() {
+	paused := c.client.PauseFetchPartitions(nil)
+	c.workersMu.Lock()
+	for tp, w := range c.workers {
+		if w.failed.Load() {
+			paused[tp.topic] = slices.DeleteFunc(paused[tp.topic], func(p int32) bool { return p == tp.partition })
+		}
 	}
-	if err := c.client.ProduceSync(ctx, dlqRec).FirstErr(); err != nil {
-		log.Printf("fauked to send to dlq: %v", err)
+	c.workersMu.Unlock()
+	c.client.ResumeFetchPartitions(paused)
+	metrics.ConsumerCircuitOpen.Set(0)
+	log.Println("kafka cons: database is back, fetching resumed")
+}
+
+func (c *Consumer) Close() {
+	if c.client != nil {
+		c.client.Close()
 	}
 }
@@ -0,0 +1,410 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/apperror"
+	"github.com/GameXost/wbTestCase/internal/config"
+	"github.com/GameXost/wbTestCase/internal/generator/generatortest"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testTopic = "orders"
+	testDLQ   = "orders.dlq"
+	testGroup = "test_consumers"
+)
+
+// fakeService заодно притворяется бд с оффсетами: CreateOrderAt пишет заказ и оффсет "в одной транзакции"
+type fakeService struct {
+	create func(ctx context.Context, order *models.Order) error
+
+	mu        sync.Mutex
+	created   []string
+	raws      map[string]*models.RawOrder
+	cancelled map[string]string
+	offsets   map[int32]int64
+}
+
+func (s *fakeService) CreateOrder(ctx context.Context, order *models.Order, raw *models.RawOrder) error {
+	return s.CreateOrderAt(ctx, order, raw, models.PartitionOffset{Offset: -1})
+}
+
+func (s *fakeService) CreateOrderAt(ctx context.Context, order *models.Order, raw *models.RawOrder, offset models.PartitionOffset) error {
+	if s.create != nil {
+		if err := s.create(ctx, order); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.created = append(s.created, order.OrderUId)
+	if s.raws == nil {
+		s.raws = make(map[string]*models.RawOrder)
+	}
+	s.raws[order.OrderUId] = raw
+	if offset.Offset >= 0 {
+		s.saveOffsetLocked(offset)
+	}
+	return nil
+}
+
+// CancelOrder запоминает источник отмены, ErrNotFound - заказа не было или его уже отменили
+func (s *fakeService) CancelOrder(ctx context.Context, orderUID, source string) error {
+	if !s.has(orderUID) {
+		return apperror.ErrNotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, has := s.cancelled[orderUID]; has {
+		return apperror.ErrNotFound
+	}
+	if s.cancelled == nil {
+		s.cancelled = make(map[string]string)
+	}
+	s.cancelled[orderUID] = source
+	return nil
+}
+
+func (s *fakeService) LoadOffsets(ctx context.Context, group, topic string) (map[int32]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := make(map[int32]int64)
+	for p, o := range s.offsets {
+		res[p] = o
+	}
+	return res, nil
+}
+
+func (s *fakeService) SaveOffset(ctx context.Context, offset models.PartitionOffset) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveOffsetLocked(offset)
+	return nil
+}
+
+func (s *fakeService) saveOffsetLocked(offset models.PartitionOffset) {
+	if s.offsets == nil {
+		s.offsets = make(map[int32]int64)
+	}
+	s.offsets[offset.Partition] = offset.Offset
+}
+
+func (s *fakeService) offset(partition int32) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, has := s.offsets[partition]
+	return o, has
+}
+
+func (s *fakeService) has(uid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, created := range s.created {
+		if created == uid {
+			return true
+		}
+	}
+	return false
+}
+
+func newTestCluster(t *testing.T, partitions int32) *kfake.Cluster {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(partitions, testTopic, testDLQ))
+	require.NoError(t, err)
+	t.Cleanup(cluster.Close)
+	return cluster
+}
+
+func testConfig(cluster *kfake.Cluster) config.KafkaConfig {
+	return config.KafkaConfig{
+		Brokers:     cluster.ListenAddrs(),
+		Topic:       testTopic,
+		Group:       testGroup,
+		DLQTopic:    testDLQ,
+		Parallelism: 10,
+
+		RetryMaxAttempts: 3,
+		RetryBaseDelay:   time.Millisecond,
+		RetryMaxDelay:    10 * time.Millisecond,
+
+		BreakerThreshold: 3,
+		BreakerCooldown:  50 * time.Millisecond,
+
+		DLQRetryAttempts:  2,
+		DLQProduceTimeout: time.Second,
+		DLQFallback:       config.DLQFallbackQuarantine,
+
+		KeyStrategy: config.KeyStrategyOrderUID,
+		KeyPolicy:   config.KeyPolicyDLQ,
+		LagInterval: 50 * time.Millisecond,
+	}
+}
+
+// produce кладет валидные заказы в указанные партиции
+func produce(t *testing.T, cluster *kfake.Cluster, partition int32, uids ...string) {
+	for _, uid := range uids {
+		data, err := json.Marshal(generatortest.New(t).ValidOrder(uid))
+		require.NoError(t, err)
+		produceRaw(t, cluster, &kgo.Record{Partition: partition, Key: []byte(uid), Value: data})
+	}
+}
+
+func produceOrder(t *testing.T, cluster *kfake.Cluster, order *models.Order) {
+	data, err := json.Marshal(order)
+	require.NoError(t, err)
+	produceRaw(t, cluster, &kgo.Record{Key: []byte(order.OrderUId), Value: data})
+}
+
+// produceRaw пишет запись как есть в партицию record.Partition топика заказов
+func produceRaw(t *testing.T, cluster *kfake.Cluster, record *kgo.Record) {
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(cluster.ListenAddrs()...),
+		kgo.RecordPartitioner(kgo.ManualPartitioner()),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+	record.Topic = testTopic
+	require.NoError(t, client.ProduceSync(context.Background(), record).FirstErr())
+}
+
+func startConsumer(t *testing.T, cfg config.KafkaConfig, srv *fakeService, quarantine QuarantineStore) *Consumer {
+	consumer, err := NewConsumer(cfg, srv, quarantine, srv)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- consumer.Start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-errs
+		consumer.Close()
+	})
+	return consumer
+}
+
+func committedOffsets(t *testing.T, cluster *kfake.Cluster) map[int32]int64 {
+	client, err := kgo.NewClient(kgo.SeedBrokers(cluster.ListenAddrs()...))
+	require.NoError(t, err)
+	defer client.Close()
+	res := make(map[int32]int64)
+	offsets, err := kadm.NewClient(client).FetchOffsets(context.Background(), testGroup)
+	if errors.Is(err, kerr.GroupIDNotFound) {
+		return res
+	}
+	require.NoError(t, err)
+	offsets.Each(func(o kadm.OffsetResponse) {
+		if o.Topic == testTopic {
+			res[o.Partition] = o.At
+		}
+	})
+	return res
+}
+
+func TestSlowPartitionDoesNotBlockOthers(t *testing.T) {
+	cluster := newTestCluster(t, 3)
+	release := make(chan struct{})
+	srv := &fakeService{create: func(ctx context.Context, order *models.Order) error {
+		if order.OrderUId == "slow" {
+			select {
+			case <-release:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	}}
+
+	produce(t, cluster, 0, "slow", "after-slow")
+	produce(t, cluster, 1, "p1-a", "p1-b")
+	produce(t, cluster, 2, "p2-a")
+	startConsumer(t, testConfig(cluster), srv, nil)
+
+	require.Eventually(t, func() bool {
+		return srv.has("p1-b") && srv.has("p2-a")
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.False(t, srv.has("after-slow"), "order in the same partition must wait for the slow one")
+
+	require.Eventually(t, func() bool {
+		offsets := committedOffsets(t, cluster)
+		return offsets[1] == 2 && offsets[2] == 1
+	}, 10*time.Second, 50*time.Millisecond)
+	_, committed := committedOffsets(t, cluster)[0]
+	assert.False(t, committed, "nothing in partition 0 is done yet")
+
+	close(release)
+	require.Eventually(t, func() bool {
+		return committedOffsets(t, cluster)[0] == 2
+	}, 10*time.Second, 50*time.Millisecond)
+	assert.True(t, srv.has("after-slow"))
+}
+
+// ошибка fetch одной партиции не выкидывает записи соседних из того же poll
+func TestFetchErrorKeepsOtherPartitions(t *testing.T) {
+	cluster := newTestCluster(t, 2)
+	srv := &fakeService{}
+	produce(t, cluster, 1, "before")
+	consumer := startConsumer(t, testConfig(cluster), srv, nil)
+	require.Eventually(t, func() bool { return srv.has("before") }, 10*time.Second, 10*time.Millisecond)
+
+	data, err := json.Marshal(generatortest.New(t).ValidOrder("after-error"))
+	require.NoError(t, err)
+	fetches := kgo.Fetches{{Topics: []kgo.FetchTopic{{
+		Topic: testTopic,
+		Partitions: []kgo.FetchPartition{
+			{Partition: 0, Err: kerr.TopicAuthorizationFailed},
+			{Partition: 1, Records: []*kgo.Record{{
+				Topic: testTopic, Partition: 1, Offset: 1, Key: []byte("after-error"), Value: data,
+			}}},
+		},
+	}}}}
+	assert.False(t, consumer.dispatch(context.Background(), fetches), "the error is reported")
+	require.Eventually(t, func() bool { return srv.has("after-error") }, 10*time.Second, 10*time.Millisecond)
+}
+
+func TestCommitStopsAtFirstUnfinishedRecord(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	release := make(chan struct{})
+	srv := &fakeService{create: func(ctx context.Context, order *models.Order) error {
+		if order.OrderUId == "stuck" {
+			select {
+			case <-release:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	}}
+
+	produce(t, cluster, 0, "first", "second", "stuck", "last")
+	startConsumer(t, testConfig(cluster), srv, nil)
+
+	require.Eventually(t, func() bool {
+		return committedOffsets(t, cluster)[0] == 2
+	}, 10*time.Second, 50*time.Millisecond)
+	time.Sleep(2 * commitInterval)
+	assert.Equal(t, int64(2), committedOffsets(t, cluster)[0])
+	close(release)
+}
+
+func TestParallelismLimit(t *testing.T) {
+	cluster := newTestCluster(t, 4)
+	var inFlight, peak atomic.Int32
+	srv := &fakeService{create: func(ctx context.Context, order *models.Order) error {
+		cur := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			old := peak.Load()
+			if cur <= old || peak.CompareAndSwap(old, cur) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}}
+
+	for p := int32(0); p < 4; p++ {
+		produce(t, cluster, p, fmt.Sprintf("a%d", p), fmt.Sprintf("b%d", p))
+	}
+	cfg := testConfig(cluster)
+	cfg.Parallelism = 2
+	startConsumer(t, cfg, srv, nil)
+
+	require.Eventually(t, func() bool {
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		return len(srv.created) == 8
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.LessOrEqual(t, peak.Load(), int32(2))
+}
+
+// readDLQ ждет n записей в dlq топике
+func readDLQ(t *testing.T, cluster *kfake.Cluster, n int) []*kgo.Record {
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(cluster.ListenAddrs()...),
+		kgo.ConsumeTopics(testDLQ),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var records []*kgo.Record
+	for len(records) < n {
+		fetches := client.PollFetches(ctx)
+		require.NoError(t, ctx.Err(), "got %d of %d dlq records", len(records), n)
+		records = append(records, fetches.Records()...)
+	}
+	return records
+}
+
+// dlqLen - сколько записей сейчас лежит в dlq
+func dlqLen(t *testing.T, cluster *kfake.Cluster) int {
+	client, err := kgo.NewClient(kgo.SeedBrokers(cluster.ListenAddrs()...))
+	require.NoError(t, err)
+	defer client.Close()
+	ends, err := kadm.NewClient(client).ListEndOffsets(context.Background(), testDLQ)
+	require.NoError(t, err)
+	total := 0
+	ends.Each(func(o kadm.ListedOffset) {
+		total += int(o.Offset)
+	})
+	return total
+}
+
+func TestRawRecordIsSavedWithOrder(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	srv := &fakeService{}
+	produce(t, cluster, 0, "skip")
+	data, err := json.Marshal(generatortest.New(t).ValidOrder("raw"))
+	require.NoError(t, err)
+	// значения заголовков - произвольные байты, в архиве они не должны портиться
+	headers := []kgo.RecordHeader{{Key: "source", Value: []byte("test")}, {Key: "trace", Value: []byte{0, 0xff, 0xfe}}}
+	produceRaw(t, cluster, &kgo.Record{Key: []byte("raw"), Value: data, Headers: headers})
+	startConsumer(t, testConfig(cluster), srv, nil)
+
+	require.Eventually(t, func() bool { return srv.has("raw") }, 10*time.Second, 50*time.Millisecond)
+	srv.mu.Lock()
+	raw := srv.raws["raw"]
+	srv.mu.Unlock()
+	require.NotNil(t, raw)
+	assert.Equal(t, data, raw.Value)
+	assert.Equal(t, []models.Header{{Key: "source", Value: []byte("test")}, {Key: "trace", Value: []byte{0, 0xff, 0xfe}}}, raw.Headers)
+	assert.Equal(t, testTopic, raw.Topic)
+	assert.EqualValues(t, 1, raw.Offset)
+	assert.False(t, raw.ReceivedAt.IsZero())
+}
+
+// после открытого breaker на паузе остаются только партиции, остановленные stopPartition
+func TestResumeFetchKeepsOnlyFailedPartitions(t *testing.T) {
+	cluster := newTestCluster(t, 3)
+	consumer, err := NewConsumer(testConfig(cluster), &fakeService{}, nil, nil)
+	require.NoError(t, err)
+	t.Cleanup(consumer.Close)
+
+	failed := newPartitionWorker(topicPartition{topic: testTopic, partition: 0})
+	failed.failed.Store(true)
+	close(failed.stopped)
+	finished := newPartitionWorker(topicPartition{topic: testTopic, partition: 1})
+	close(finished.stopped)
+	running := newPartitionWorker(topicPartition{topic: testTopic, partition: 2})
+	consumer.workers = map[topicPartition]*partitionWorker{failed.tp: failed, finished.tp: finished, running.tp: running}
+
+	consumer.pauseFetch()
+	assert.ElementsMatch(t, []int32{0, 1, 2}, consumer.client.PauseFetchPartitions(nil)[testTopic])
+	consumer.resumeFetch()
+	assert.Equal(t, map[string][]int32{testTopic: {0}}, consumer.client.PauseFetchPartitions(nil))
+}
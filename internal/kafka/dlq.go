@@ -0,0 +1,198 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/apperror"
+	"github.com/GameXost/wbTestCase/internal/config"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/GameXost/wbTestCase/internal/service"
+	"github.com/GameXost/wbTestCase/metrics"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// заголовки, которые консьюмер вешает на запись в dlq
+const (
+	HeaderOriginalTopic     = "dlq.original.topic"
+	HeaderOriginalPartition = "dlq.original.partition"
+	HeaderOriginalOffset    = "dlq.original.offset"
+	HeaderOriginalTimestamp = "dlq.original.timestamp"
+	HeaderReason            = "dlq.reason"
+	HeaderError             = "dlq.error"
+	HeaderViolations        = "dlq.violations"
+	HeaderAttempts          = "dlq.attempts"
+	HeaderConsumerGroup     = "dlq.consumer.group"
+	HeaderConsumerHost      = "dlq.consumer.host"
+	HeaderFailedAt          = "dlq.failed.at"
+	// ставит cmd/dlq при переотправке: откуда запись вернулась
+	HeaderReplayedFrom = "dlq.replayed.from"
+	// ставит консьюмер на переотправленную с правильным ключом запись (KAFKA_KEY_POLICY=rekey)
+	HeaderRekeyedFrom = "rekeyed.from"
+)
+
+// причины попадания в dlq, они же значения label reason у dlq_messages_total
+const (
+	ReasonInvalidJSON    = "invalid_json"
+	ReasonInvalidPayload = "invalid_payload" // protobuf/avro не разобрался или схемы нет в registry
+	ReasonMissingUID     = "missing_uid"
+	ReasonKeyMismatch    = "key_mismatch" // ключ пустой или не совпадает с заказом (KAFKA_KEY_POLICY=dlq)
+	ReasonValidation     = "validation"
+	ReasonPersistence    = "persistence"
+)
+
+// failure - почему запись не удалось обработать
+type failure struct {
+	reason   string
+	err      error
+	attempts int
+}
+
+func newFailure(err error, attempts int) failure {
+	reason := ReasonPersistence
+	if errors.Is(err, apperror.ErrValidation) {
+		reason = ReasonValidation
+	}
+	return failure{reason: reason, err: err, attempts: attempts}
+}
+
+// errDeadLetter - запись не удалось положить ни в dlq, ни в карантин
+var errDeadLetter = errors.New("record can not be dead-lettered")
+
+// sendToDLQ кладет запись в dlq с повторами. Если dlq так и не приняла запись - в карантин,
+// а если и это не вышло (или карантин выключен), возвращает ошибку, и партиция останавливается
+func (c *Consumer) sendToDLQ(ctx context.Context, record *kgo.Record, f failure) error {
+	defer observeStage(stageDeadLetter, time.Now())
+	dlqRec := &kgo.Record{
+		Topic:   c.dlqTopic,
+		Key:     record.Key,
+		Value:   record.Value,
+		Headers: c.dlqHeaders(record, f),
+	}
+	err := c.produceRetry(ctx, dlqRec)
+	if err == nil {
+		metrics.DLQMessages.WithLabelValues(f.reason).Inc()
+		c.skipOffset(ctx, record)
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	log.Printf("failed to send to dlq after %d attempts (topic: %s, partition: %d, offset: %d): %v",
+		c.dlqAttempts, record.Topic, record.Partition, record.Offset, err)
+
+	if c.dlqFallback != config.DLQFallbackQuarantine || c.quarantine == nil {
+		return fmt.Errorf("%w: %w", errDeadLetter, err)
+	}
+	quarantined := &models.QuarantinedRecord{
+		Topic:     record.Topic,
+		Partition: record.Partition,
+		Offset:    record.Offset,
+		Key:       dlqRec.Key,
+		Value:     dlqRec.Value,
+		Headers:   toModelHeaders(dlqRec.Headers),
+		Reason:    f.reason,
+		Error:     err.Error(),
+	}
+	if qErr := c.quarantine.Quarantine(ctx, quarantined); qErr != nil {
+		return fmt.Errorf("%w: dlq: %w, quarantine: %w", errDeadLetter, err, qErr)
+	}
+	metrics.QuarantinedMessages.WithLabelValues(f.reason).Inc()
+	log.Printf("record quarantined (topic: %s, partition: %d, offset: %d)", record.Topic, record.Partition, record.Offset)
+	c.skipOffset(ctx, record)
+	return nil
+}
+
+// produceRetry пишет запись с повторами, сколько разрешено для dlq
+func (c *Consumer) produceRetry(ctx context.Context, record *kgo.Record) error {
+	for attempt := 1; ; attempt++ {
+		err := c.client.ProduceSync(ctx, record).FirstErr()
+		if err == nil || ctx.Err() != nil || attempt >= c.dlqAttempts {
+			return err
+		}
+		log.Printf("produce to %s attempt %d failed: %v", record.Topic, attempt, err)
+		if err = sleepCtx(ctx, c.retry.backoff(attempt)); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Consumer) ListQuarantined(ctx context.Context, limit int) ([]models.QuarantinedRecord, error) {
+	if c.quarantine == nil {
+		return nil, nil
+	}
+	return c.quarantine.ListQuarantined(ctx, limit)
+}
+
+// ReleaseQuarantined отправляет запись из карантина в dlq, куда она и шла. Запись сначала забирается
+// (помечается отпущенной), поэтому два одновременных release не отправят ее дважды; не отправилась - возвращается
+func (c *Consumer) ReleaseQuarantined(ctx context.Context, id int64) error {
+	if c.quarantine == nil {
+		return apperror.ErrNotFound
+	}
+	quarantined, err := c.quarantine.ClaimQuarantined(ctx, id)
+	if err != nil {
+		return err
+	}
+	record := &kgo.Record{
+		Topic:   c.dlqTopic,
+		Key:     quarantined.Key,
+		Value:   quarantined.Value,
+		Headers: toRecordHeaders(quarantined.Headers),
+	}
+	if err = c.produceRetry(ctx, record); err != nil {
+		// отменой запроса возврат отменять нельзя, иначе запись застрянет забранной
+		if uErr := c.quarantine.UnclaimQuarantined(context.WithoutCancel(ctx), id); uErr != nil {
+			return fmt.Errorf("failed to send quarantined record to dlq: %w, and to return it: %w", err, uErr)
+		}
+		return fmt.Errorf("failed to send quarantined record to dlq: %w", err)
+	}
+	metrics.DLQMessages.WithLabelValues(quarantined.Reason).Inc()
+	return nil
+}
+
+func toModelHeaders(headers []kgo.RecordHeader) []models.Header {
+	result := make([]models.Header, 0, len(headers))
+	for _, h := range headers {
+		result = append(result, models.Header{Key: h.Key, Value: slices.Clone(h.Value)})
+	}
+	return result
+}
+
+func toRecordHeaders(headers []models.Header) []kgo.RecordHeader {
+	result := make([]kgo.RecordHeader, 0, len(headers))
+	for _, h := range headers {
+		result = append(result, kgo.RecordHeader{Key: h.Key, Value: h.Value})
+	}
+	return result
+}
+
+// dlqHeaders - исходные заголовки записи плюс все, что нужно для разбора в kafka ui
+func (c *Consumer) dlqHeaders(record *kgo.Record, f failure) []kgo.RecordHeader {
+	headers := make([]kgo.RecordHeader, 0, len(record.Headers)+11)
+	headers = append(headers, record.Headers...)
+	add := func(key, value string) {
+		headers = append(headers, kgo.RecordHeader{Key: key, Value: []byte(value)})
+	}
+	add(HeaderOriginalTopic, record.Topic)
+	add(HeaderOriginalPartition, strconv.Itoa(int(record.Partition)))
+	add(HeaderOriginalOffset, strconv.FormatInt(record.Offset, 10))
+	add(HeaderOriginalTimestamp, record.Timestamp.UTC().Format(time.RFC3339Nano))
+	add(HeaderReason, f.reason)
+	if f.err != nil {
+		add(HeaderError, f.err.Error())
+	}
+	if violations := strings.Join(service.Violations(f.err), "; "); violations != "" {
+		add(HeaderViolations, violations)
+	}
+	add(HeaderAttempts, strconv.Itoa(f.attempts))
+	add(HeaderConsumerGroup, c.group)
+	add(HeaderConsumerHost, c.host)
+	add(HeaderFailedAt, time.Now().UTC().Format(time.RFC3339Nano))
+	return headers
+}
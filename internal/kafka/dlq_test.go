@@ -0,0 +1,66 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/apperror"
+	"github.com/GameXost/wbTestCase/internal/generator/generatortest"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/GameXost/wbTestCase/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"testing"
+)
+
+func TestDLQHeaders(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	srv := &fakeService{create: func(ctx context.Context, order *models.Order) error {
+		if err := service.ValidateOrder(order); err != nil {
+			return fmt.Errorf("%w: %w", apperror.ErrValidation, err)
+		}
+		return nil
+	}}
+
+	produce(t, cluster, 0, "ok")
+	produceRaw(t, cluster, &kgo.Record{
+		Key:     []byte("broken"),
+		Value:   []byte("{not json"),
+		Headers: []kgo.RecordHeader{{Key: "source", Value: []byte("test")}},
+	})
+	invalid := generatortest.New(t).ValidOrder("invalid")
+	invalid.Payment.Amount = -1
+	invalid.TrackNumber = ""
+	produceOrder(t, cluster, invalid)
+	noUID := generatortest.New(t).ValidOrder("")
+	produceOrder(t, cluster, noUID)
+	startConsumer(t, testConfig(cluster), srv, nil)
+
+	dlq := readDLQ(t, cluster, 3)
+	byKey := make(map[string]*kgo.Record)
+	for _, record := range dlq {
+		byKey[string(record.Key)] = record
+	}
+
+	broken := byKey["broken"]
+	require.NotNil(t, broken)
+	assert.Equal(t, ReasonInvalidJSON, headerValue(broken, HeaderReason))
+	assert.Equal(t, testTopic, headerValue(broken, HeaderOriginalTopic))
+	assert.Equal(t, "0", headerValue(broken, HeaderOriginalPartition))
+	assert.Equal(t, "1", headerValue(broken, HeaderOriginalOffset))
+	assert.NotEmpty(t, headerValue(broken, HeaderOriginalTimestamp))
+	assert.Equal(t, testGroup, headerValue(broken, HeaderConsumerGroup))
+	assert.NotEmpty(t, headerValue(broken, HeaderConsumerHost))
+	assert.Equal(t, "test", headerValue(broken, "source"), "original headers are kept")
+
+	validation := byKey["invalid"]
+	require.NotNil(t, validation)
+	assert.Equal(t, ReasonValidation, headerValue(validation, HeaderReason))
+	assert.Equal(t, "1", headerValue(validation, HeaderAttempts))
+	assert.Contains(t, headerValue(validation, HeaderViolations), "Order.Payment.Amount")
+	assert.Contains(t, headerValue(validation, HeaderViolations), "Order.TrackNumber: required")
+
+	missing := byKey[""]
+	require.NotNil(t, missing)
+	assert.Equal(t, ReasonMissingUID, headerValue(missing, HeaderReason))
+}
@@ -0,0 +1,70 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/config"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/GameXost/wbTestCase/metrics"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"log"
+	"slices"
+)
+
+var errKeyMismatch = errors.New("record key does not match the order")
+
+// OrderKey - ключ записи заказа по стратегии: заказы с одним ключом попадают в одну партицию и читаются по порядку
+func OrderKey(strategy string, order *models.Order) (string, error) {
+	switch strategy {
+	case config.KeyStrategyOrderUID:
+		return order.OrderUId, nil
+	case config.KeyStrategyCustomerID:
+		return order.CustomerId, nil
+	case config.KeyStrategyShardKey:
+		return order.Shardkey, nil
+	}
+	return "", fmt.Errorf("unknown key strategy %q", strategy)
+}
+
+// wrongKey разбирается с записью, ключ которой не совпал с ожидаемым key, по KAFKA_KEY_POLICY.
+// Переотправленная копия встает в свою партицию и обрабатывается там, оригинал считается обработанным
+func (c *Consumer) wrongKey(ctx context.Context, record *kgo.Record, order *models.Order, key string) error {
+	log.Printf("record key %q does not match order %s, want %q (topic: %s, partition: %d, offset: %d)",
+		record.Key, order.OrderUId, key, record.Topic, record.Partition, record.Offset)
+	switch c.keyPolicy {
+	case config.KeyPolicyIgnore:
+		metrics.ConsumerKeyMismatches.WithLabelValues("ignored").Inc()
+		return c.createOrder(ctx, record, order)
+	case config.KeyPolicyRekey:
+		// пустой ключ по стратегии (например, заказ без customer_id) правильнее не станет
+		if key == "" {
+			break
+		}
+		rekeyed := &kgo.Record{
+			Topic: record.Topic,
+			Key:   []byte(key),
+			Value: record.Value,
+			Headers: append(slices.Clone(record.Headers), kgo.RecordHeader{
+				Key:   HeaderRekeyedFrom,
+				Value: fmt.Appendf(nil, "%s/%d@%d", record.Topic, record.Partition, record.Offset),
+			}),
+		}
+		err := c.produceRetry(ctx, rekeyed)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			metrics.ConsumerKeyMismatches.WithLabelValues("rekeyed").Inc()
+			c.skipOffset(ctx, record)
+			return nil
+		}
+		log.Printf("failed to rekey record, sending to dlq: %v", err)
+	}
+	metrics.ConsumerKeyMismatches.WithLabelValues("dead_letter").Inc()
+	return c.sendToDLQ(ctx, record, failure{
+		reason:   ReasonKeyMismatch,
+		err:      fmt.Errorf("%w: key %q, want %q", errKeyMismatch, record.Key, key),
+		attempts: 1,
+	})
+}
@@ -0,0 +1,112 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/GameXost/wbTestCase/internal/config"
+	"github.com/GameXost/wbTestCase/internal/generator/generatortest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"testing"
+	"time"
+)
+
+func TestOrderKey(t *testing.T) {
+	order := generatortest.New(t).ValidOrder("uid")
+	order.CustomerId = "customer"
+	order.Shardkey = "7"
+
+	for strategy, want := range map[string]string{
+		config.KeyStrategyOrderUID:   "uid",
+		config.KeyStrategyCustomerID: "customer",
+		config.KeyStrategyShardKey:   "7",
+	} {
+		key, err := OrderKey(strategy, order)
+		require.NoError(t, err)
+		assert.Equal(t, want, key, strategy)
+	}
+	_, err := OrderKey("nope", order)
+	assert.Error(t, err)
+}
+
+func produceKeyed(t *testing.T, cluster *kfake.Cluster, uid, key string) {
+	data, err := json.Marshal(generatortest.New(t).ValidOrder(uid))
+	require.NoError(t, err)
+	produceRaw(t, cluster, &kgo.Record{Key: []byte(key), Value: data})
+}
+
+func TestWrongKeyIsDeadLettered(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	srv := &fakeService{}
+	produceKeyed(t, cluster, "mismatched", "other")
+	produceKeyed(t, cluster, "empty_key", "")
+	produce(t, cluster, 0, "right")
+	startConsumer(t, testConfig(cluster), srv, nil)
+
+	records := readDLQ(t, cluster, 2)
+	for _, record := range records {
+		assert.Equal(t, ReasonKeyMismatch, headerValue(record, HeaderReason))
+	}
+	require.Eventually(t, func() bool { return srv.has("right") }, 10*time.Second, 50*time.Millisecond)
+	assert.False(t, srv.has("mismatched"))
+	assert.False(t, srv.has("empty_key"))
+}
+
+func TestWrongKeyIsRekeyed(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	srv := &fakeService{}
+	cfg := testConfig(cluster)
+	cfg.KeyPolicy = config.KeyPolicyRekey
+	produceKeyed(t, cluster, "rekey_me", "other")
+	startConsumer(t, cfg, srv, nil)
+
+	require.Eventually(t, func() bool { return srv.has("rekey_me") }, 10*time.Second, 50*time.Millisecond)
+	assert.Equal(t, 0, dlqLen(t, cluster))
+
+	client, err := kgo.NewClient(kgo.SeedBrokers(cluster.ListenAddrs()...), kgo.ConsumeTopics(testTopic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()))
+	require.NoError(t, err)
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var rekeyed *kgo.Record
+	for rekeyed == nil && ctx.Err() == nil {
+		client.PollFetches(ctx).EachRecord(func(r *kgo.Record) {
+			if r.Offset == 1 {
+				rekeyed = r
+			}
+		})
+	}
+	require.NotNil(t, rekeyed)
+	assert.Equal(t, "rekey_me", string(rekeyed.Key))
+	assert.Equal(t, "orders/0@0", headerValue(rekeyed, HeaderRekeyedFrom))
+}
+
+func TestWrongKeyIgnored(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	srv := &fakeService{}
+	cfg := testConfig(cluster)
+	cfg.KeyPolicy = config.KeyPolicyIgnore
+	produceKeyed(t, cluster, "ignored", "other")
+	startConsumer(t, cfg, srv, nil)
+
+	require.Eventually(t, func() bool { return srv.has("ignored") }, 10*time.Second, 50*time.Millisecond)
+	assert.Equal(t, 0, dlqLen(t, cluster))
+}
+
+func TestCustomerKeyStrategy(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	srv := &fakeService{}
+	cfg := testConfig(cluster)
+	cfg.KeyStrategy = config.KeyStrategyCustomerID
+	order := generatortest.New(t).ValidOrder("by_customer")
+	data, err := json.Marshal(order)
+	require.NoError(t, err)
+	produceRaw(t, cluster, &kgo.Record{Key: []byte(order.CustomerId), Value: data})
+	startConsumer(t, cfg, srv, nil)
+
+	require.Eventually(t, func() bool { return srv.has("by_customer") }, 10*time.Second, 50*time.Millisecond)
+	assert.Equal(t, 0, dlqLen(t, cluster))
+}
@@ -0,0 +1,154 @@
+package kafka
+
+import (
+	"context"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/GameXost/wbTestCase/metrics"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// этапы обработки записи для kafka_consumer_stage_duration_seconds
+const (
+	stageDecode     = "decode"
+	stagePersist    = "persist"
+	stageDeadLetter = "dead_letter"
+	stageTotal      = "total"
+)
+
+func observeStage(stage string, start time.Time) {
+	metrics.ConsumerStageDuration.WithLabelValues(stage).Observe(time.Since(start).Seconds())
+}
+
+func (c *Consumer) onAssigned(_ context.Context, _ *kgo.Client, assigned map[string][]int32) {
+	metrics.ConsumerRebalances.WithLabelValues("assigned").Inc()
+	c.monitorMu.Lock()
+	defer c.monitorMu.Unlock()
+	for topic, partitions := range assigned {
+		for _, partition := range partitions {
+			c.assigned[topicPartition{topic: topic, partition: partition}] = struct{}{}
+		}
+	}
+	log.Printf("kafka cons: partitions assigned: %v", assigned)
+}
+
+// onRevoked: партиции уходят другому участнику, обработанное успеваем закоммитить
+func (c *Consumer) onRevoked(ctx context.Context, _ *kgo.Client, revoked map[string][]int32) {
+	metrics.ConsumerRebalances.WithLabelValues("revoked").Inc()
+	c.unassign(revoked)
+	c.releaseWorkers(ctx, revoked, true)
+	log.Printf("kafka cons: partitions revoked: %v", revoked)
+}
+
+// onLost: участника уже выкинули из группы (сессия истекла), коммит не пройдет - работа просто бросается
+func (c *Consumer) onLost(ctx context.Context, _ *kgo.Client, lost map[string][]int32) {
+	metrics.ConsumerRebalances.WithLabelValues("lost").Inc()
+	c.unassign(lost)
+	c.releaseWorkers(ctx, lost, false)
+	log.Printf("kafka cons: partitions lost: %v", lost)
+}
+
+func (c *Consumer) isAssigned(tp topicPartition) bool {
+	c.monitorMu.Lock()
+	defer c.monitorMu.Unlock()
+	_, has := c.assigned[tp]
+	return has
+}
+
+func (c *Consumer) unassign(partitions map[string][]int32) {
+	c.monitorMu.Lock()
+	defer c.monitorMu.Unlock()
+	for topic, ps := range partitions {
+		for _, partition := range ps {
+			delete(c.assigned, topicPartition{topic: topic, partition: partition})
+		}
+	}
+}
+
+func (c *Consumer) lagLoop(ctx context.Context) {
+	ticker := time.NewTicker(c.lagInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.pollLag(ctx)
+		}
+	}
+}
+
+// pollLag считает лаг группы по всем партициям: закоммиченный оффсет против конца партиции
+func (c *Consumer) pollLag(ctx context.Context) {
+	lags, err := kadm.NewClient(c.client).Lag(ctx, c.group)
+	if err != nil {
+		log.Printf("kafka cons: failed to get lag: %v", err)
+		return
+	}
+	groupLag, has := lags[c.group]
+	if !has {
+		return
+	}
+	if err = groupLag.Error(); err != nil {
+		log.Printf("kafka cons: failed to get lag: %v", err)
+		return
+	}
+
+	lag := make(map[topicPartition]int64)
+	for _, l := range groupLag.Lag.Sorted() {
+		if l.Err != nil {
+			continue
+		}
+		lag[topicPartition{topic: l.Topic, partition: l.Partition}] = l.Lag
+		metrics.ConsumerLag.WithLabelValues(l.Topic, strconv.Itoa(int(l.Partition))).Set(float64(l.Lag))
+	}
+	c.monitorMu.Lock()
+	c.lag = lag
+	c.monitorMu.Unlock()
+}
+
+// Status - назначенные партиции с закоммиченными и обработанными оффсетами
+func (c *Consumer) Status() models.ConsumerStatus {
+	committed := c.client.CommittedOffsets()
+
+	c.monitorMu.Lock()
+	partitions := make([]models.PartitionStatus, 0, len(c.assigned))
+	for tp := range c.assigned {
+		status := models.PartitionStatus{Topic: tp.topic, Partition: tp.partition, Committed: -1, Processed: -1, Lag: -1}
+		if offset, has := committed[tp.topic][tp.partition]; has {
+			status.Committed = offset.Offset
+		}
+		if lag, has := c.lag[tp]; has {
+			status.Lag = lag
+		}
+		partitions = append(partitions, status)
+	}
+	c.monitorMu.Unlock()
+
+	c.workersMu.Lock()
+	for i, status := range partitions {
+		if w, has := c.workers[topicPartition{topic: status.Topic, partition: status.Partition}]; has {
+			done, _ := w.committable()
+			partitions[i].Processed = done.Offset
+			partitions[i].Stopped = w.isStopped()
+		}
+	}
+	c.workersMu.Unlock()
+
+	sort.Slice(partitions, func(i, j int) bool {
+		if partitions[i].Topic != partitions[j].Topic {
+			return partitions[i].Topic < partitions[j].Topic
+		}
+		return partitions[i].Partition < partitions[j].Partition
+	})
+	return models.ConsumerStatus{
+		Group:       c.group,
+		Host:        c.host,
+		CircuitOpen: c.breaker.isOpen(),
+		Partitions:  partitions,
+	}
+}
@@ -0,0 +1,52 @@
+package kafka
+
+import (
+	"context"
+	"github.com/GameXost/wbTestCase/internal/apperror"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/GameXost/wbTestCase/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestStatus(t *testing.T) {
+	cluster := newTestCluster(t, 2)
+	srv := &fakeService{}
+	produce(t, cluster, 0, "s1", "s2", "s3")
+	produce(t, cluster, 1, "s4")
+	consumer := startConsumer(t, testConfig(cluster), srv, nil)
+
+	want := []models.PartitionStatus{
+		{Topic: testTopic, Partition: 0, Committed: 3, Processed: 3, Lag: 0},
+		{Topic: testTopic, Partition: 1, Committed: 1, Processed: 1, Lag: 0},
+	}
+	require.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual(want, consumer.Status().Partitions)
+	}, 10*time.Second, 50*time.Millisecond)
+
+	status := consumer.Status()
+	assert.Equal(t, testGroup, status.Group)
+	assert.False(t, status.CircuitOpen)
+}
+
+func TestDuplicateIsProcessed(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	srv := &fakeService{create: func(ctx context.Context, order *models.Order) error {
+		if order.OrderUId == "dup" {
+			return apperror.ErrDuplicate
+		}
+		return nil
+	}}
+	before := testutil.ToFloat64(metrics.ConsumerRecordsDuplicated)
+	produce(t, cluster, 0, "dup", "fresh")
+	startConsumer(t, testConfig(cluster), srv, nil)
+
+	require.Eventually(t, func() bool {
+		return committedOffsets(t, cluster)[0] == 2
+	}, 10*time.Second, 50*time.Millisecond)
+	assert.Equal(t, 0, dlqLen(t, cluster), "duplicate is not a failure")
+	assert.Equal(t, before+1, testutil.ToFloat64(metrics.ConsumerRecordsDuplicated))
+}
@@ -0,0 +1,101 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/apperror"
+	"github.com/GameXost/wbTestCase/internal/generator"
+	"github.com/GameXost/wbTestCase/internal/generator/generatortest"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/GameXost/wbTestCase/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"testing"
+)
+
+// что консьюмер должен сказать про каждую порчу из каталога генератора: причину и нарушение в dlq.violations
+var mutationVerdicts = map[string]struct {
+	reason    string
+	violation string
+}{
+	"order.uid_empty":                {ReasonMissingUID, ""},
+	"order.track_number_empty":       {ReasonValidation, "Order.TrackNumber: required"},
+	"order.entry_empty":              {ReasonValidation, "Order.Entry: required"},
+	"order.locale_empty":             {ReasonValidation, "Order.Locale: required"},
+	"order.customer_id_empty":        {ReasonValidation, "Order.CustomerId: required"},
+	"order.delivery_service_empty":   {ReasonValidation, "Order.DeliveryService: required"},
+	"order.shardkey_empty":           {ReasonValidation, "Order.Shardkey: required"},
+	"order.sm_id_zero":               {ReasonValidation, "Order.SmId: gt=0"},
+	"items.empty":                    {ReasonValidation, "Order.Items: min=1"},
+	"item.price_negative":            {ReasonValidation, "Order.Items[0].Price: gte=0"},
+	"item.total_price_negative":      {ReasonValidation, "Order.Items[0].TotalPrice: gte=0"},
+	"item.sale_negative":             {ReasonValidation, "Order.Items[0].Sale: gte=0"},
+	"item.status_negative":           {ReasonValidation, "Order.Items[0].Status: gte=0"},
+	"item.name_empty":                {ReasonValidation, "Order.Items[0].Name: required"},
+	"item.chrt_id_zero":              {ReasonValidation, "Order.Items[0].ChrtId: gt=0"},
+	"payment.amount_zero":            {ReasonValidation, "Order.Payment.Amount: gt=0"},
+	"payment.transaction_empty":      {ReasonValidation, "Order.Payment.Transaction: required"},
+	"payment.currency_empty":         {ReasonValidation, "Order.Payment.Currency: required"},
+	"payment.goods_total_zero":       {ReasonValidation, "Order.Payment.GoodsTotal: gt=0"},
+	"payment.delivery_cost_negative": {ReasonValidation, "Order.Payment.DeliveryCost: gte=0"},
+	"delivery.name_empty":            {ReasonValidation, "Order.Delivery.Name: required"},
+	"delivery.phone_empty":           {ReasonValidation, "Order.Delivery.Phone: required"},
+	"delivery.email_empty":           {ReasonValidation, "Order.Delivery.Email: required"},
+	"delivery.city_empty":            {ReasonValidation, "Order.Delivery.City: required"},
+	"delivery.address_empty":         {ReasonValidation, "Order.Delivery.Address: required"},
+	"delivery.zip_empty":             {ReasonValidation, "Order.Delivery.Zip: required"},
+	"delivery.region_empty":          {ReasonValidation, "Order.Delivery.Region: required"},
+	"totals_mismatch":                {ReasonValidation, "Order.Payment.Amount: payment_total="},
+	"bad_email":                      {ReasonValidation, "Order.Delivery.Email: email"},
+	"unknown_currency":               {ReasonValidation, "Order.Payment.Currency: iso4217"},
+	"future_date":                    {ReasonValidation, "Order.DateCreated: not_future"},
+}
+
+// каждая порча из каталога проходит весь путь продюсер - консьюмер - сервис и оседает в dlq с нужной причиной
+func TestEveryMutationLandsInDLQ(t *testing.T) {
+	names := generator.Mutations()
+	for _, name := range names {
+		require.Contains(t, mutationVerdicts, name, "add the expected dlq reason for the new mutation")
+	}
+
+	cluster := newTestCluster(t, 3)
+	srv := &fakeService{create: func(ctx context.Context, order *models.Order) error {
+		if err := service.ValidateOrder(order); err != nil {
+			return fmt.Errorf("%w: %w", apperror.ErrValidation, err)
+		}
+		return nil
+	}}
+	g := generatortest.New(t)
+	for _, name := range names {
+		order, err := g.MutatedOrder(g.OrderUID(), name)
+		require.NoError(t, err)
+		data, err := json.Marshal(order)
+		require.NoError(t, err)
+		produceRaw(t, cluster, &kgo.Record{
+			Partition: int32(g.IntN(3)),
+			Key:       []byte(order.OrderUId),
+			Value:     data,
+			Headers:   []kgo.RecordHeader{{Key: generator.HeaderMutation, Value: []byte(name)}},
+		})
+	}
+	startConsumer(t, testConfig(cluster), srv, nil)
+
+	byMutation := make(map[string]*kgo.Record)
+	for _, record := range readDLQ(t, cluster, len(names)) {
+		byMutation[headerValue(record, generator.HeaderMutation)] = record
+	}
+	for _, name := range names {
+		record := byMutation[name]
+		if !assert.NotNil(t, record, "%s is not in dlq", name) {
+			continue
+		}
+		want := mutationVerdicts[name]
+		assert.Equal(t, want.reason, headerValue(record, HeaderReason), name)
+		assert.Contains(t, headerValue(record, HeaderViolations), want.violation, name)
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	assert.Empty(t, srv.created, "no broken order is saved")
+}
@@ -0,0 +1,66 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"log"
+	"time"
+)
+
+// OffsetStore - оффсеты консьюмера в бд. Для заказов они пишутся в транзакции заказа через
+// OrderService.CreateOrderAt, так что упавший посреди пачки консьюмер не обработает запись второй раз
+type OffsetStore interface {
+	LoadOffsets(ctx context.Context, group, topic string) (map[int32]int64, error)
+	SaveOffset(ctx context.Context, offset models.PartitionOffset) error
+}
+
+// seedOffsets вызывается при назначении партиций: позиции из бд заменяют закоммиченные в кафке
+func (c *Consumer) seedOffsets(ctx context.Context, assigned map[string]map[int32]kgo.Offset) (map[string]map[int32]kgo.Offset, error) {
+	for topic, partitions := range assigned {
+		stored, err := c.offsets.LoadOffsets(ctx, c.group, topic)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load offsets from db: %w", err)
+		}
+		for partition := range partitions {
+			if offset, has := stored[partition]; has {
+				partitions[partition] = kgo.NewOffset().At(offset).WithEpoch(-1)
+				log.Printf("kafka cons: partition %s/%d starts from db offset %d", topic, partition, offset)
+			}
+		}
+	}
+	return assigned, nil
+}
+
+func (c *Consumer) offsetAfter(record *kgo.Record) models.PartitionOffset {
+	return models.PartitionOffset{Group: c.group, Topic: record.Topic, Partition: record.Partition, Offset: record.Offset + 1}
+}
+
+func (c *Consumer) saveOrder(ctx context.Context, record *kgo.Record, order *models.Order) error {
+	raw := &models.RawOrder{
+		OrderUId:   order.OrderUId,
+		Topic:      record.Topic,
+		Partition:  record.Partition,
+		Offset:     record.Offset,
+		Headers:    toModelHeaders(record.Headers),
+		Value:      record.Value,
+		ReceivedAt: time.Now(),
+	}
+	if c.offsets == nil {
+		return c.service.CreateOrder(ctx, order, raw)
+	}
+	return c.service.CreateOrderAt(ctx, order, raw, c.offsetAfter(record))
+}
+
+// skipOffset сдвигает позицию в бд за записью, которая ушла в dlq или карантин.
+// Не вышло - после рестарта запись попадет в dlq еще раз, это не страшно
+func (c *Consumer) skipOffset(ctx context.Context, record *kgo.Record) {
+	if c.offsets == nil {
+		return
+	}
+	if err := c.offsets.SaveOffset(ctx, c.offsetAfter(record)); err != nil {
+		log.Printf("failed to save offset of dead-lettered record (topic: %s, partition: %d, offset: %d): %v",
+			record.Topic, record.Partition, record.Offset, err)
+	}
+}
@@ -0,0 +1,62 @@
+package kafka
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"testing"
+	"time"
+)
+
+func TestOffsetsInDBSeedPosition(t *testing.T) {
+	cluster := newTestCluster(t, 2)
+	// "бд" уже знает, что первые две записи партиции 0 сохранены, а в кафке коммита нет
+	srv := &fakeService{offsets: map[int32]int64{0: 2}}
+
+	produce(t, cluster, 0, "done-1", "done-2", "new-0")
+	produce(t, cluster, 1, "new-1")
+	cfg := testConfig(cluster)
+	cfg.OffsetsInDB = true
+	startConsumer(t, cfg, srv, nil)
+
+	require.Eventually(t, func() bool {
+		return srv.has("new-0") && srv.has("new-1")
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.False(t, srv.has("done-1"))
+	assert.False(t, srv.has("done-2"))
+
+	offset, _ := srv.offset(0)
+	assert.Equal(t, int64(3), offset)
+	offset, _ = srv.offset(1)
+	assert.Equal(t, int64(1), offset)
+}
+
+func TestOffsetsInDBMovePastDeadLetters(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	srv := &fakeService{}
+
+	produceRaw(t, cluster, &kgo.Record{Key: []byte("broken"), Value: []byte("{not json")})
+	cfg := testConfig(cluster)
+	cfg.OffsetsInDB = true
+	startConsumer(t, cfg, srv, nil)
+
+	readDLQ(t, cluster, 1)
+	require.Eventually(t, func() bool {
+		offset, has := srv.offset(0)
+		return has && offset == 1
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+func TestOffsetsNotStoredByDefault(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	srv := &fakeService{offsets: map[int32]int64{0: 1}}
+
+	produce(t, cluster, 0, "first", "second")
+	startConsumer(t, testConfig(cluster), srv, nil)
+
+	require.Eventually(t, func() bool {
+		return srv.has("first") && srv.has("second")
+	}, 10*time.Second, 10*time.Millisecond)
+	offset, _ := srv.offset(0)
+	assert.Equal(t, int64(1), offset, "db offsets are ignored without KAFKA_OFFSETS_IN_DB")
+}
@@ -0,0 +1,273 @@
+package kafka
+
+import (
+	"context"
+	"github.com/GameXost/wbTestCase/metrics"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// сколько записей одной партиции может ждать обработки, дальше poll цикл ждет воркера
+const partitionBuffer = 256
+
+// сколько при отзыве партиции ждать текущую запись, прежде чем бросить ее (например, бд лежит):
+// ребаланс не должен ждать дольше, чем группа готова ждать участника
+const revokeDrainTimeout = 10 * time.Second
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// partitionWorker обрабатывает записи своей партиции строго по порядку, разные партиции идут параллельно.
+// Раз обработка последовательная, последняя завершенная запись и есть граница непрерывно обработанных оффсетов
+type partitionWorker struct {
+	tp      topicPartition
+	records chan *kgo.Record
+	stopped chan struct{}
+	// отзыв партиции: воркер доделывает текущую запись, остальные из очереди бросает
+	revoked    chan struct{}
+	revokeOnce sync.Once
+	cancel     context.CancelFunc
+	// партиция остановлена на записи, которую некуда деть (stopPartition)
+	failed atomic.Bool
+
+	mu        sync.Mutex
+	done      kgo.EpochOffset
+	committed int64
+}
+
+func newPartitionWorker(tp topicPartition) *partitionWorker {
+	return &partitionWorker{
+		tp:        tp,
+		records:   make(chan *kgo.Record, partitionBuffer),
+		stopped:   make(chan struct{}),
+		revoked:   make(chan struct{}),
+		done:      kgo.EpochOffset{Epoch: -1, Offset: -1},
+		committed: -1,
+	}
+}
+
+// enqueue отдает записи воркеру. Остановленной партиции записи не нужны: оффсет за ними не закоммитится,
+// после рестарта они придут снова
+func (w *partitionWorker) enqueue(ctx context.Context, records []*kgo.Record) bool {
+	for _, record := range records {
+		select {
+		case w.records <- record:
+		case <-w.stopped:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+func (w *partitionWorker) isStopped() bool {
+	select {
+	case <-w.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *partitionWorker) revoke() {
+	w.revokeOnce.Do(func() { close(w.revoked) })
+}
+
+func (w *partitionWorker) isRevoked() bool {
+	select {
+	case <-w.revoked:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *partitionWorker) markDone(record *kgo.Record) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.done = kgo.EpochOffset{Epoch: record.LeaderEpoch, Offset: record.Offset + 1}
+}
+
+// committable - оффсет, который еще не закоммичен, но уже можно
+func (w *partitionWorker) committable() (kgo.EpochOffset, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.done, w.done.Offset > w.committed
+}
+
+func (w *partitionWorker) markCommitted(offset int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.committed = max(w.committed, offset)
+}
+
+// worker возвращает воркера партиции, nil - партицию уже отозвали, а записи пришли из старого fetch.
+// Проверка назначения под workersMu, чтобы не создать воркера после releaseWorkers
+func (c *Consumer) worker(ctx context.Context, tp topicPartition) *partitionWorker {
+	c.workersMu.Lock()
+	defer c.workersMu.Unlock()
+	if w, has := c.workers[tp]; has {
+		return w
+	}
+	if !c.isAssigned(tp) {
+		return nil
+	}
+	w := newPartitionWorker(tp)
+	ctx, w.cancel = context.WithCancel(ctx)
+	c.workers[tp] = w
+	c.workersWG.Add(1)
+	go c.runWorker(ctx, w)
+	return w
+}
+
+func (c *Consumer) runWorker(ctx context.Context, w *partitionWorker) {
+	defer c.workersWG.Done()
+	defer w.cancel()
+	defer close(w.stopped)
+	for record := range w.records {
+		if w.isRevoked() {
+			return
+		}
+		select {
+		case c.sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		err := c.handleMessage(ctx, record)
+		<-c.sem
+		if err != nil {
+			if ctx.Err() == nil {
+				c.stopPartition(w, record, err)
+			}
+			return
+		}
+		w.markDone(record)
+	}
+}
+
+// stopPartition останавливает партицию на записи, которую нельзя ни сохранить, ни положить в dlq:
+// оффсет дальше нее не коммитится, остальные партиции работают
+func (c *Consumer) stopPartition(w *partitionWorker, record *kgo.Record, err error) {
+	log.Printf("kafka cons: partition stopped (topic: %s, partition: %d, offset: %d), restart after fixing dlq: %v",
+		record.Topic, record.Partition, record.Offset, err)
+	w.failed.Store(true)
+	c.client.PauseFetchPartitions(map[string][]int32{w.tp.topic: {w.tp.partition}})
+	metrics.ConsumerStoppedPartitions.Inc()
+}
+
+// releaseWorkers убирает воркеров отозванных партиций. commit - партиция отозвана штатно: текущая запись
+// доделывается и обработанное коммитится, пока партиция еще наша. Потерянную партицию коммитить уже нельзя,
+// работа бросается сразу: новый владелец начнет с последнего коммита, дубли отсечет бд
+func (c *Consumer) releaseWorkers(ctx context.Context, partitions map[string][]int32, commit bool) {
+	released := make(map[topicPartition]*partitionWorker)
+	c.workersMu.Lock()
+	for topic, ps := range partitions {
+		for _, partition := range ps {
+			tp := topicPartition{topic: topic, partition: partition}
+			if w, has := c.workers[tp]; has {
+				released[tp] = w
+				delete(c.workers, tp)
+			}
+		}
+	}
+	c.workersMu.Unlock()
+
+	for _, w := range released {
+		if commit {
+			w.revoke()
+		} else {
+			w.cancel()
+		}
+	}
+	timeout := time.NewTimer(revokeDrainTimeout)
+	defer timeout.Stop()
+	for _, w := range released {
+		select {
+		case <-w.stopped:
+		case <-timeout.C:
+			log.Printf("kafka cons: partition %s/%d did not finish the current record in %s, abandoning it",
+				w.tp.topic, w.tp.partition, revokeDrainTimeout)
+			for _, other := range released {
+				other.cancel()
+			}
+			<-w.stopped
+		}
+		// остановленная партиция на паузе, а пауза переживает ребаланс
+		if w.failed.Load() {
+			metrics.ConsumerStoppedPartitions.Dec()
+			if !c.breaker.isOpen() {
+				c.client.ResumeFetchPartitions(map[string][]int32{w.tp.topic: {w.tp.partition}})
+			}
+		}
+	}
+	if commit {
+		c.commitWorkers(ctx, released)
+	}
+}
+
+// stopWorkers закрывает очереди и ждет, пока воркеры доделают текущие записи
+func (c *Consumer) stopWorkers() {
+	c.workersMu.Lock()
+	for _, w := range c.workers {
+		close(w.records)
+	}
+	c.workersMu.Unlock()
+	c.workersWG.Wait()
+}
+
+// commit коммитит по каждой партиции оффсет после последней обработанной записи
+func (c *Consumer) commit(ctx context.Context) {
+	c.workersMu.Lock()
+	workers := make(map[topicPartition]*partitionWorker, len(c.workers))
+	for tp, w := range c.workers {
+		workers[tp] = w
+	}
+	c.workersMu.Unlock()
+	c.commitWorkers(ctx, workers)
+}
+
+func (c *Consumer) commitWorkers(ctx context.Context, workers map[topicPartition]*partitionWorker) {
+	offsets := make(map[string]map[int32]kgo.EpochOffset)
+	for tp, w := range workers {
+		offset, ok := w.committable()
+		if !ok {
+			continue
+		}
+		if offsets[tp.topic] == nil {
+			offsets[tp.topic] = make(map[int32]kgo.EpochOffset)
+		}
+		offsets[tp.topic][tp.partition] = offset
+	}
+	if len(offsets) == 0 {
+		return
+	}
+
+	c.client.CommitOffsetsSync(ctx, offsets, func(_ *kgo.Client, _ *kmsg.OffsetCommitRequest, resp *kmsg.OffsetCommitResponse, err error) {
+		if err != nil {
+			log.Printf("commit offset error: %v", err)
+			metrics.ConsumerCommitFailures.Inc()
+			return
+		}
+		for _, topic := range resp.Topics {
+			for _, partition := range topic.Partitions {
+				if err := kerr.ErrorForCode(partition.ErrorCode); err != nil {
+					log.Printf("commit offset error (topic: %s, partition: %d): %v", topic.Topic, partition.Partition, err)
+					metrics.ConsumerCommitFailures.Inc()
+					continue
+				}
+				tp := topicPartition{topic: topic.Topic, partition: partition.Partition}
+				if w, has := workers[tp]; has {
+					w.markCommitted(offsets[tp.topic][tp.partition].Offset)
+				}
+			}
+		}
+	})
+}
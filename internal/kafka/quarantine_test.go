@@ -0,0 +1,171 @@
+package kafka
+
+import (
+	"context"
+	"github.com/GameXost/wbTestCase/internal/apperror"
+	"github.com/GameXost/wbTestCase/internal/config"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type memQuarantine struct {
+	mu      sync.Mutex
+	records []models.QuarantinedRecord
+}
+
+func (q *memQuarantine) Quarantine(ctx context.Context, record *models.QuarantinedRecord) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	record.Id = int64(len(q.records) + 1)
+	q.records = append(q.records, *record)
+	return nil
+}
+
+func (q *memQuarantine) ListQuarantined(ctx context.Context, limit int) ([]models.QuarantinedRecord, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var result []models.QuarantinedRecord
+	for _, record := range q.records {
+		if record.ReleasedAt == nil && len(result) < limit {
+			result = append(result, record)
+		}
+	}
+	return result, nil
+}
+
+func (q *memQuarantine) ClaimQuarantined(ctx context.Context, id int64) (*models.QuarantinedRecord, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if id < 1 || int(id) > len(q.records) || q.records[id-1].ReleasedAt != nil {
+		return nil, apperror.ErrNotFound
+	}
+	now := time.Now()
+	q.records[id-1].ReleasedAt = &now
+	record := q.records[id-1]
+	return &record, nil
+}
+
+func (q *memQuarantine) UnclaimQuarantined(ctx context.Context, id int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.records[id-1].ReleasedAt = nil
+	return nil
+}
+
+// кластер без dlq топика: отправка туда не проходит
+func newClusterWithoutDLQ(t *testing.T, partitions int32) *kfake.Cluster {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(partitions, testTopic))
+	require.NoError(t, err)
+	t.Cleanup(cluster.Close)
+	return cluster
+}
+
+func TestQuarantineWhenDLQUnavailable(t *testing.T) {
+	cluster := newClusterWithoutDLQ(t, 1)
+	quarantine := &memQuarantine{}
+	srv := &fakeService{}
+
+	// бинарный заголовок должен доехать до dlq байт в байт
+	trace := []byte{0, 0xff, 0xfe, 'x'}
+	produceRaw(t, cluster, &kgo.Record{Key: []byte("broken"), Value: []byte("{not json\xff"),
+		Headers: []kgo.RecordHeader{{Key: "trace", Value: trace}}})
+	produce(t, cluster, 0, "after")
+	consumer := startConsumer(t, testConfig(cluster), srv, quarantine)
+
+	require.Eventually(t, func() bool {
+		return committedOffsets(t, cluster)[0] == 2
+	}, 10*time.Second, 50*time.Millisecond)
+	assert.True(t, srv.has("after"))
+
+	list, err := consumer.ListQuarantined(context.Background(), 10)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, []byte("broken"), list[0].Key)
+	assert.Equal(t, []byte("{not json\xff"), list[0].Value)
+	assert.Equal(t, ReasonInvalidJSON, list[0].Reason)
+	assert.Contains(t, list[0].Headers, models.Header{Key: HeaderReason, Value: []byte(ReasonInvalidJSON)})
+	assert.Contains(t, list[0].Headers, models.Header{Key: "trace", Value: trace})
+
+	// dlq вернулась - отпускаем запись туда
+	client, err := kgo.NewClient(kgo.SeedBrokers(cluster.ListenAddrs()...))
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = kadm.NewClient(client).CreateTopic(context.Background(), 1, 1, nil, testDLQ)
+	require.NoError(t, err)
+
+	// клиент не сразу узнает о новом топике из метаданных
+	require.Eventually(t, func() bool {
+		return consumer.ReleaseQuarantined(context.Background(), list[0].Id) == nil
+	}, 20*time.Second, 100*time.Millisecond)
+	dlq := readDLQ(t, cluster, 1)
+	assert.Equal(t, "broken", string(dlq[0].Key))
+	assert.Equal(t, []byte("{not json\xff"), dlq[0].Value)
+	assert.Equal(t, ReasonInvalidJSON, headerValue(dlq[0], HeaderReason))
+	assert.Equal(t, string(trace), headerValue(dlq[0], "trace"))
+
+	list, err = consumer.ListQuarantined(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+	assert.ErrorIs(t, consumer.ReleaseQuarantined(context.Background(), 1), apperror.ErrNotFound)
+}
+
+func TestStopPartitionWhenRecordCanNotBeDeadLettered(t *testing.T) {
+	cluster := newClusterWithoutDLQ(t, 2)
+	srv := &fakeService{}
+
+	produceRaw(t, cluster, &kgo.Record{Partition: 0, Key: []byte("broken"), Value: []byte("{not json")})
+	produce(t, cluster, 0, "after-broken")
+	produce(t, cluster, 1, "p1")
+	cfg := testConfig(cluster)
+	cfg.DLQFallback = config.DLQFallbackStop
+	consumer := startConsumer(t, cfg, srv, &memQuarantine{})
+
+	require.Eventually(t, func() bool {
+		return committedOffsets(t, cluster)[1] == 1
+	}, 10*time.Second, 50*time.Millisecond)
+	require.Eventually(t, func() bool {
+		return len(consumer.client.PauseFetchPartitions(nil)[testTopic]) == 1
+	}, 10*time.Second, 10*time.Millisecond)
+
+	time.Sleep(2 * commitInterval)
+	_, committed := committedOffsets(t, cluster)[0]
+	assert.False(t, committed, "offset must not move past the record that was not dead-lettered")
+	assert.False(t, srv.has("after-broken"))
+	assert.True(t, srv.has("p1"))
+}
+
+// одновременные release одной записи отправляют ее в dlq один раз
+func TestConcurrentReleaseSendsOnce(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	quarantine := &memQuarantine{}
+	require.NoError(t, quarantine.Quarantine(context.Background(), &models.QuarantinedRecord{
+		Topic: testTopic, Key: []byte("k"), Value: []byte("v"), Reason: ReasonInvalidJSON,
+	}))
+	consumer, err := NewConsumer(testConfig(cluster), &fakeService{}, quarantine, nil)
+	require.NoError(t, err)
+	defer consumer.Close()
+
+	var released atomic.Int32
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if consumer.ReleaseQuarantined(context.Background(), 1) == nil {
+				released.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, released.Load())
+	readDLQ(t, cluster, 1)
+	assert.Equal(t, 1, dlqLen(t, cluster))
+}
@@ -0,0 +1,122 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/GameXost/wbTestCase/internal/config"
+	"github.com/GameXost/wbTestCase/internal/generator/generatortest"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"testing"
+	"time"
+)
+
+// blockingService держит запись "slow", пока не закроют release или не отменят контекст
+func blockingService(started chan<- struct{}, release <-chan struct{}) *fakeService {
+	return &fakeService{create: func(ctx context.Context, order *models.Order) error {
+		if order.OrderUId != "slow" {
+			return nil
+		}
+		close(started)
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}}
+}
+
+func TestRevokeFinishesCurrentRecordAndCommits(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	started, release := make(chan struct{}), make(chan struct{})
+	srv := blockingService(started, release)
+	produce(t, cluster, 0, "first", "slow", "queued")
+	consumer := startConsumer(t, testConfig(cluster), srv, nil)
+
+	<-started
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+	consumer.onRevoked(context.Background(), consumer.client, map[string][]int32{testTopic: {0}})
+
+	assert.True(t, srv.has("slow"), "record in progress is finished")
+	assert.Equal(t, int64(2), committedOffsets(t, cluster)[0], "finished work is committed before the partition goes away")
+	time.Sleep(2 * commitInterval)
+	assert.False(t, srv.has("queued"), "queued records are left to the new owner")
+	assert.Empty(t, consumer.Status().Partitions)
+}
+
+func TestLostPartitionIsAbandoned(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	started := make(chan struct{})
+	srv := blockingService(started, nil)
+	produce(t, cluster, 0, "first", "slow")
+	consumer := startConsumer(t, testConfig(cluster), srv, nil)
+
+	<-started
+	lostAt := time.Now()
+	consumer.onLost(context.Background(), consumer.client, map[string][]int32{testTopic: {0}})
+
+	assert.Less(t, time.Since(lostAt), revokeDrainTimeout, "lost partition does not wait for the current record")
+	assert.False(t, srv.has("slow"))
+	assert.Less(t, committedOffsets(t, cluster)[0], int64(2))
+}
+
+func produceAt(t *testing.T, cluster *kfake.Cluster, uid string, at time.Time) {
+	data, err := json.Marshal(generatortest.New(t).ValidOrder(uid))
+	require.NoError(t, err)
+	produceRaw(t, cluster, &kgo.Record{Key: []byte(uid), Value: data, Timestamp: at})
+}
+
+func TestResetOffsetTimestamp(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	start := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	produceAt(t, cluster, "old", start)
+	produceAt(t, cluster, "new", start.Add(time.Minute))
+
+	srv := &fakeService{}
+	cfg := testConfig(cluster)
+	cfg.ResetOffset = config.ResetOffsetTimestamp
+	cfg.ResetTimestamp = start.Add(time.Second)
+	startConsumer(t, cfg, srv, nil)
+
+	require.Eventually(t, func() bool {
+		return srv.has("new")
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.False(t, srv.has("old"))
+}
+
+func TestRewindGroup(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	start := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	for i, uid := range []string{"a", "b", "c"} {
+		produceAt(t, cluster, uid, start.Add(time.Duration(i)*time.Minute))
+	}
+	client, err := kgo.NewClient(kgo.SeedBrokers(cluster.ListenAddrs()...))
+	require.NoError(t, err)
+	defer client.Close()
+	adm := kadm.NewClient(client)
+
+	consumer, err := NewConsumer(testConfig(cluster), &fakeService{}, nil, nil)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- consumer.Start(ctx) }()
+	require.Eventually(t, func() bool {
+		return committedOffsets(t, cluster)[0] == 3
+	}, 10*time.Second, 50*time.Millisecond)
+
+	_, err = RewindGroup(context.Background(), adm, testGroup, testTopic, start)
+	assert.ErrorIs(t, err, ErrGroupActive)
+
+	cancel()
+	<-done
+	consumer.Close()
+	offsets, err := RewindGroup(context.Background(), adm, testGroup, testTopic, start.Add(30*time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, map[int32]int64{0: 1}, offsets)
+	assert.Equal(t, int64(1), committedOffsets(t, cluster)[0])
+}
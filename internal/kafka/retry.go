@@ -0,0 +1,102 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"github.com/GameXost/wbTestCase/internal/apperror"
+	"github.com/GameXost/wbTestCase/internal/repository"
+	"github.com/jackc/pgx/v5/pgconn"
+	"io"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy - сколько раз и с какими паузами повторять временные ошибки.
+// Пауза растет экспоненциально от BaseDelay до MaxDelay, из нее берется случайное значение в [d/2, d]
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.MaxDelay
+	if shift := attempt - 1; shift < 32 {
+		delay = min(p.BaseDelay<<shift, p.MaxDelay)
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+// sleepCtx - time.Sleep, который прерывается отменой контекста
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type errorClass int
+
+const (
+	// неизвестная ошибка: повторяем по политике, потом в dlq
+	classUnknown errorClass = iota
+	// временная: бд недоступна, таймаут - повтор поможет
+	classTransient
+	// постоянная: запись никогда не сохранится, сразу в dlq
+	classPermanent
+)
+
+func (c errorClass) String() string {
+	switch c {
+	case classTransient:
+		return "transient"
+	case classPermanent:
+		return "permanent"
+	default:
+		return "unknown"
+	}
+}
+
+func classify(err error) errorClass {
+	if errors.Is(err, apperror.ErrValidation) || repository.IsDataError(err) {
+		return classPermanent
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		// connection exception, нехватка ресурсов, рестарт/выключение сервера, конфликт сериализации
+		case strings.HasPrefix(pgErr.Code, "08"), strings.HasPrefix(pgErr.Code, "53"),
+			strings.HasPrefix(pgErr.Code, "57P"), strings.HasPrefix(pgErr.Code, "40"):
+			return classTransient
+		default:
+			return classUnknown
+		}
+	}
+
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &connectErr),
+		errors.As(err, &netErr),
+		pgconn.Timeout(err),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNRESET):
+		return classTransient
+	}
+	return classUnknown
+}
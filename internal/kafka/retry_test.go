@@ -0,0 +1,102 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/apperror"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want errorClass
+	}{
+		{"validation", fmt.Errorf("wrap: %w", apperror.ErrValidation), classPermanent},
+		{"unique violation", fmt.Errorf("repo: %w", &pgconn.PgError{Code: "23505"}), classPermanent},
+		{"foreign key violation", &pgconn.PgError{Code: "23503"}, classPermanent},
+		{"check violation", &pgconn.PgError{Code: "23514"}, classPermanent},
+		{"value too long", &pgconn.PgError{Code: "22001"}, classPermanent},
+		{"admin shutdown", &pgconn.PgError{Code: "57P01"}, classTransient},
+		{"connection failure", &pgconn.PgError{Code: "08006"}, classTransient},
+		{"too many connections", &pgconn.PgError{Code: "53300"}, classTransient},
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, classTransient},
+		{"undefined table", &pgconn.PgError{Code: "42P01"}, classUnknown},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), classTransient},
+		{"connection refused", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, classTransient},
+		{"plain", errors.New("something odd"), classUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, classify(tt.err))
+		})
+	}
+}
+
+func TestBackoffGrowsWithJitterAndCap(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for i := 0; i < 100; i++ {
+		first := policy.backoff(1)
+		assert.GreaterOrEqual(t, first, 50*time.Millisecond)
+		assert.LessOrEqual(t, first, 100*time.Millisecond)
+
+		third := policy.backoff(3)
+		assert.GreaterOrEqual(t, third, 200*time.Millisecond)
+		assert.LessOrEqual(t, third, 400*time.Millisecond)
+
+		capped := policy.backoff(60)
+		assert.GreaterOrEqual(t, capped, 500*time.Millisecond)
+		assert.LessOrEqual(t, capped, time.Second)
+	}
+}
+
+func TestSleepCtxCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	assert.ErrorIs(t, sleepCtx(ctx, time.Hour), context.Canceled)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestPermanentErrorGoesStraightToDLQ(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	var attempts atomic.Int32
+	srv := &fakeService{create: func(ctx context.Context, order *models.Order) error {
+		attempts.Add(1)
+		return fmt.Errorf("error while creating payment in repository: %w", &pgconn.PgError{Code: "23505"})
+	}}
+
+	produce(t, cluster, 0, "duplicate-transaction")
+	startConsumer(t, testConfig(cluster), srv, nil)
+
+	dlq := readDLQ(t, cluster, 1)
+	assert.Equal(t, "duplicate-transaction", string(dlq[0].Key))
+	assert.Equal(t, int32(1), attempts.Load())
+}
+
+func TestTransientErrorRetried(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	var attempts atomic.Int32
+	srv := &fakeService{create: func(ctx context.Context, order *models.Order) error {
+		if attempts.Add(1) < 3 {
+			return &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+		}
+		return nil
+	}}
+
+	produce(t, cluster, 0, "flaky")
+	startConsumer(t, testConfig(cluster), srv, nil)
+
+	require.Eventually(t, func() bool { return srv.has("flaky") }, 10*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(3), attempts.Load())
+}
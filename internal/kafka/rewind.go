@@ -0,0 +1,50 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"time"
+)
+
+// ErrGroupActive - у группы есть участники, они коммитят свои оффсеты и перетрут переписанные снаружи
+var ErrGroupActive = errors.New("consumer group has active members, stop the consumers first")
+
+// RewindGroup переводит оффсеты группы на первые записи не раньше to, чтобы заново обработать все после этого момента.
+// Партиции без записей после to встают в конец. Возвращает новые оффсеты по партициям
+func RewindGroup(ctx context.Context, adm *kadm.Client, group, topic string, to time.Time) (map[int32]int64, error) {
+	described, err := adm.DescribeGroups(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	if g, has := described[group]; has {
+		if g.Err != nil {
+			return nil, g.Err
+		}
+		if len(g.Members) > 0 {
+			return nil, fmt.Errorf("%w: %s is %s with %d members", ErrGroupActive, group, g.State, len(g.Members))
+		}
+	}
+
+	listed, err := adm.ListOffsetsAfterMilli(ctx, to.UnixMilli(), topic)
+	if err != nil {
+		return nil, err
+	}
+	if err = listed.Error(); err != nil {
+		return nil, fmt.Errorf("list offsets of %s: %w", topic, err)
+	}
+	offsets := listed.Offsets()
+	if len(offsets[topic]) == 0 {
+		return nil, fmt.Errorf("topic %s has no partitions", topic)
+	}
+	if err = adm.CommitAllOffsets(ctx, group, offsets); err != nil {
+		return nil, fmt.Errorf("commit offsets of %s: %w", group, err)
+	}
+
+	res := make(map[int32]int64, len(offsets[topic]))
+	offsets.Each(func(o kadm.Offset) {
+		res[o.Partition] = o.At
+	})
+	return res, nil
+}
@@ -0,0 +1,61 @@
+package kafka
+
+import (
+	"github.com/GameXost/wbTestCase/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"testing"
+	"time"
+)
+
+func TestTombstoneCancelsOrder(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	srv := &fakeService{}
+	cfg := testConfig(cluster)
+	cfg.Tombstones = true
+	cfg.OffsetsInDB = true
+	notFound := testutil.ToFloat64(metrics.ConsumerTombstones.WithLabelValues("not_found"))
+
+	produce(t, cluster, 0, "to_cancel")
+	produceRaw(t, cluster, &kgo.Record{Key: []byte("to_cancel")})
+	produceRaw(t, cluster, &kgo.Record{Key: []byte("to_cancel")})  // повтор отмены
+	produceRaw(t, cluster, &kgo.Record{Key: []byte("never_seen")}) // отменять нечего
+	startConsumer(t, cfg, srv, nil)
+
+	require.Eventually(t, func() bool {
+		o, _ := srv.offset(0)
+		return o == 4
+	}, 10*time.Second, 50*time.Millisecond)
+	srv.mu.Lock()
+	assert.Equal(t, map[string]string{"to_cancel": "orders/0@1"}, srv.cancelled)
+	srv.mu.Unlock()
+	assert.Equal(t, notFound+2, testutil.ToFloat64(metrics.ConsumerTombstones.WithLabelValues("not_found")))
+	assert.Equal(t, 0, dlqLen(t, cluster))
+}
+
+func TestTombstoneWithoutKeyIsDeadLettered(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	cfg := testConfig(cluster)
+	cfg.Tombstones = true
+	produceRaw(t, cluster, &kgo.Record{})
+	startConsumer(t, cfg, &fakeService{}, nil)
+
+	records := readDLQ(t, cluster, 1)
+	assert.Equal(t, ReasonMissingUID, headerValue(records[0], HeaderReason))
+}
+
+func TestTombstonesDisabledByDefault(t *testing.T) {
+	cluster := newTestCluster(t, 1)
+	srv := &fakeService{}
+	produce(t, cluster, 0, "kept")
+	produceRaw(t, cluster, &kgo.Record{Key: []byte("kept")})
+	startConsumer(t, testConfig(cluster), srv, nil)
+
+	records := readDLQ(t, cluster, 1)
+	assert.Equal(t, ReasonInvalidJSON, headerValue(records[0], HeaderReason))
+	srv.mu.Lock()
+	assert.Empty(t, srv.cancelled)
+	srv.mu.Unlock()
+}
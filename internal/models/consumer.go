@@ -0,0 +1,19 @@
+package models
+
+// ConsumerStatus - состояние консьюмера для GET /admin/consumer
+type ConsumerStatus struct {
+	Group       string            `json:"group"`
+	Host        string            `json:"host"`
+	CircuitOpen bool              `json:"circuit_open"`
+	Partitions  []PartitionStatus `json:"partitions"`
+}
+
+// PartitionStatus: Committed и Processed - следующий оффсет к чтению, -1 если еще ничего нет; Lag -1 - еще не опрашивали
+type PartitionStatus struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Committed int64  `json:"committed"`
+	Processed int64  `json:"processed"`
+	Lag       int64  `json:"lag"`
+	Stopped   bool   `json:"stopped"`
+}
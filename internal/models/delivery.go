@@ -9,5 +9,5 @@ type Delivery struct {
 	City     string `json:"city" validate:"required"`
 	Address  string `json:"address" validate:"required"`
 	Region   string `json:"region" validate:"required"`
-	Email    string `json:"email" validate:"required"`
+	Email    string `json:"email" validate:"required,email"`
 }
@@ -0,0 +1,9 @@
+package models
+
+// PartitionOffset - позиция группы в партиции, Offset - следующая запись к чтению
+type PartitionOffset struct {
+	Group     string
+	Topic     string
+	Partition int32
+	Offset    int64
+}
@@ -18,3 +18,16 @@ type Order struct {
 	DateCreated       time.Time `json:"date_created"`
 	OofShard          string    `json:"oof_shard"`
 }
+
+// Clone возвращает глубокую копию заказа: остальные поля значимые, копировать отдельно надо только items
+func (o *Order) Clone() *Order {
+	if o == nil {
+		return nil
+	}
+	clone := *o
+	if o.Items != nil {
+		clone.Items = make([]Item, len(o.Items))
+		copy(clone.Items, o.Items)
+	}
+	return &clone
+}
@@ -4,7 +4,7 @@ type Payment struct {
 	OrderId      string `json:"order_id,omitempty"`
 	Transaction  string `json:"transaction" validate:"required"`
 	RequestId    string `json:"request_id" validate:"required"`
-	Currency     string `json:"currency" validate:"required"`
+	Currency     string `json:"currency" validate:"required,iso4217"`
 	Provider     string `json:"provider" validate:"required"`
 	Amount       int64  `json:"amount" validate:"gt=0"`
 	PaymentDt    int64  `json:"payment_dt"`
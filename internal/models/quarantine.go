@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// QuarantinedRecord - запись кафки, которую не удалось отправить в dlq. Key и Value - байты как есть,
+// в json - base64: protobuf и avro в строку не влезают
+type QuarantinedRecord struct {
+	Id         int64      `json:"id"`
+	Topic      string     `json:"topic"`
+	Partition  int32      `json:"partition"`
+	Offset     int64      `json:"offset"`
+	Key        []byte     `json:"key"`
+	Value      []byte     `json:"value"`
+	Headers    []Header   `json:"headers"`
+	Reason     string     `json:"reason"`
+	Error      string     `json:"error"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ReleasedAt *time.Time `json:"released_at,omitempty"`
+}
+
+// Header - заголовок записи кафки. Значение - произвольные байты, в json (и jsonb) уходит base64,
+// иначе невалидный utf-8 заменится, а \u0000 jsonb не примет
+type Header struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
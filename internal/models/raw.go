@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// RawOrder - запись кафки, из которой собран заказ, байты значения как есть
+type RawOrder struct {
+	OrderUId   string    `json:"order_uid"`
+	Topic      string    `json:"topic"`
+	Partition  int32     `json:"partition"`
+	Offset     int64     `json:"offset"`
+	Headers    []Header  `json:"headers"`
+	Value      []byte    `json:"value"`
+	ReceivedAt time.Time `json:"received_at"`
+}
@@ -0,0 +1,141 @@
+package cache
+
+import "container/list"
+
+// arc - Adaptive Replacement Cache (Megiddo, Modha).
+// t1 - ключи, которые видели один раз, t2 - хотя бы дважды, b1/b2 - "призраки" недавно вытесненных из t1/t2.
+// Попадания в призраков двигают target p между recency и frequency
+type arc struct {
+	t1, t2, b1, b2 *list.List
+	entries        map[string]*arcEntry
+	capacity       int
+	p              int
+}
+
+type arcEntry struct {
+	key  string
+	list *list.List
+	elem *list.Element
+}
+
+func newARC(capacity uint64) *arc {
+	return &arc{
+		t1:       list.New(),
+		t2:       list.New(),
+		b1:       list.New(),
+		b2:       list.New(),
+		entries:  make(map[string]*arcEntry, 2*capacity),
+		capacity: int(capacity),
+	}
+}
+
+func (a *arc) Hit(key string) {
+	entry, has := a.entries[key]
+	if !has || !a.resident(entry) {
+		return
+	}
+	a.move(entry, a.t2)
+}
+
+func (a *arc) Miss(string) {}
+
+func (a *arc) Add(key string) []string {
+	var evicted []string
+	if entry, has := a.entries[key]; has {
+		switch entry.list {
+		case a.b1:
+			a.p = min(a.capacity, a.p+max(a.b2.Len()/a.b1.Len(), 1))
+			evicted = a.replace(false)
+			a.move(entry, a.t2)
+			return evicted
+		case a.b2:
+			a.p = max(0, a.p-max(a.b1.Len()/a.b2.Len(), 1))
+			evicted = a.replace(true)
+			a.move(entry, a.t2)
+			return evicted
+		default:
+			a.move(entry, a.t2)
+			return nil
+		}
+	}
+
+	l1 := a.t1.Len() + a.b1.Len()
+	total := l1 + a.t2.Len() + a.b2.Len()
+	switch {
+	case l1 >= a.capacity:
+		if a.t1.Len() < a.capacity {
+			a.dropLRU(a.b1)
+			evicted = a.replace(false)
+		} else {
+			evicted = append(evicted, a.dropLRU(a.t1))
+		}
+	case total >= a.capacity:
+		if total >= 2*a.capacity {
+			a.dropLRU(a.b2)
+		}
+		evicted = a.replace(false)
+	}
+
+	entry := &arcEntry{key: key, list: a.t1}
+	entry.elem = a.t1.PushFront(entry)
+	a.entries[key] = entry
+	return evicted
+}
+
+// Remove убирает ключ совсем, без призрака: его не вытеснили, он больше не нужен
+func (a *arc) Remove(key string) {
+	entry, has := a.entries[key]
+	if !has || !a.resident(entry) {
+		return
+	}
+	entry.list.Remove(entry.elem)
+	delete(a.entries, key)
+}
+
+func (a *arc) Keys() []string {
+	keys := make([]string, 0, a.t1.Len()+a.t2.Len())
+	for _, l := range []*list.List{a.t2, a.t1} {
+		for elem := l.Front(); elem != nil; elem = elem.Next() {
+			keys = append(keys, elem.Value.(*arcEntry).key)
+		}
+	}
+	return keys
+}
+
+// replace освобождает место в кэше, переводя LRU ключ из t1 или t2 в соответствующий список призраков
+func (a *arc) replace(inB2 bool) []string {
+	if a.t1.Len()+a.t2.Len() < a.capacity {
+		return nil
+	}
+	if a.t1.Len() > 0 && (a.t1.Len() > a.p || (inB2 && a.t1.Len() == a.p)) {
+		entry := a.t1.Back().Value.(*arcEntry)
+		a.move(entry, a.b1)
+		return []string{entry.key}
+	}
+	if a.t2.Len() > 0 {
+		entry := a.t2.Back().Value.(*arcEntry)
+		a.move(entry, a.b2)
+		return []string{entry.key}
+	}
+	return nil
+}
+
+func (a *arc) dropLRU(l *list.List) string {
+	back := l.Back()
+	if back == nil {
+		return ""
+	}
+	entry := l.Remove(back).(*arcEntry)
+	delete(a.entries, entry.key)
+	return entry.key
+}
+
+func (a *arc) move(entry *arcEntry, to *list.List) {
+	entry.list.Remove(entry.elem)
+	entry.list = to
+	entry.elem = to.PushFront(entry)
+}
+
+func (a *arc) resident(entry *arcEntry) bool {
+	return entry.list == a.t1 || entry.list == a.t2
+}
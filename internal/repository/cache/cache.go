@@ -6,127 +6,85 @@ import (
 	"sync"
 )
 
+// Cache хранит свои копии заказов: Set и LoadFull копируют входящие, Get отдает копию,
+// так что изменения заказа у вызывающего не портят закэшированное значение
 type Cache struct {
 	mu       sync.Mutex
-	data     map[string]*Node
+	data     map[string]*models.Order
 	capacity uint64
-	size     uint64
-	head     *Node
-	tail     *Node
+	policy   Policy
 }
 
-type Node struct {
-	order *models.Order
-	prev  *Node
-	next  *Node
-	key   string
+func NewCache(capacity uint64) *Cache {
+	return NewCacheWithPolicy(capacity, newLRU(capacity))
 }
 
-func NewCache(capacity uint64) *Cache {
+// NewCacheWithPolicy - кэш с произвольной политикой вытеснения, политика должна быть создана на ту же емкость
+func NewCacheWithPolicy(capacity uint64, policy Policy) *Cache {
 	return &Cache{
-		data:     make(map[string]*Node, capacity),
+		data:     make(map[string]*models.Order, capacity),
 		capacity: capacity,
+		policy:   policy,
 	}
 }
 
 func (c *Cache) Get(key string) (*models.Order, bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	node, has := c.data[key]
+	order, has := c.data[key]
 	if !has {
 		//log.Println("cache miss")
 		metrics.CacheMisses.Inc()
+		c.policy.Miss(key)
 		return nil, false
 	}
 	//log.Println("cache hit")
 	metrics.CacheHits.Inc()
-	c.moveToTop(node)
-	return node.order, true
+	c.policy.Hit(key)
+	return order.Clone(), true
 }
 
 func (c *Cache) Set(order *models.Order) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	node, has := c.data[order.OrderUId]
-	if has {
-		node.order = order
-		c.moveToTop(node)
+	order = order.Clone()
+	if _, has := c.data[order.OrderUId]; has {
+		c.data[order.OrderUId] = order
+		c.policy.Hit(order.OrderUId)
 		return
 	}
-
-	if c.size >= c.capacity {
-		c.deleteBottom()
-	}
-
-	node = &Node{key: order.OrderUId, order: order}
-	c.addToFront(node)
+	c.add(order)
 }
 
-func (c *Cache) LoadFull(ids []*models.Order) {
+// Remove выкидывает заказ из кэша
+func (c *Cache) Remove(key string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	for _, v := range ids {
-		if c.size >= c.capacity {
-			break
-		}
-		node := &Node{order: v, key: v.OrderUId}
-		c.addToFront(node)
-	}
-}
-
-func (c *Cache) moveToTop(node *Node) {
-	//если у нас элемент вверху - скип
-	if node == c.head {
+	if _, has := c.data[key]; !has {
 		return
 	}
-	//предыдущего элемента нет только у первого элемента
-	if node.prev != nil {
-		node.prev.next = node.next
-	}
-	// если элемент - хвост, то нужно сдвинуть указатель хвоста
-	if node.next != nil {
-		node.next.prev = node.prev
-	} else {
-		c.tail = c.tail.prev
-	}
-	//текущий элемент становится головой, т.е предыдущего нет, следующий - бывшая голова
-	node.prev = nil
-	node.next = c.head
-	if c.head != nil {
-		c.head.prev = node
-	}
-	c.head = node
-
+	delete(c.data, key)
+	c.policy.Remove(key)
 }
 
-func (c *Cache) deleteBottom() {
-	if c.tail == nil {
-		return
-	}
-	removed := c.tail
-	if c.head == c.tail {
-		c.tail = nil
-		c.head = nil
-	} else {
-		c.tail = c.tail.prev
-		c.tail.next = nil
+// LoadFull ждет заказы от самого свежего к самому старому: кладем с конца, чтобы самый свежий оказался наверху.
+// Берется не больше capacity первых, уже лежащие в кэше (например, пришедшие из кафки во время прогрева) не трогаются
+func (c *Cache) LoadFull(ids []*models.Order) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ids = ids[:min(uint64(len(ids)), c.capacity)]
+	for i := len(ids) - 1; i >= 0; i-- {
+		if _, has := c.data[ids[i].OrderUId]; has {
+			continue
+		}
+		c.add(ids[i].Clone())
 	}
-	delete(c.data, removed.key)
-	c.size--
-
 }
 
-func (c *Cache) addToFront(node *Node) {
-	node.next = c.head
-	node.prev = nil
-	if c.head != nil {
-		c.head.prev = node
-	}
-	c.head = node
-
-	if c.tail == nil {
-		c.tail = node
+// add кладет новый заказ и выкидывает то, что решила вытеснить политика (это может быть и сам заказ)
+func (c *Cache) add(order *models.Order) {
+	c.data[order.OrderUId] = order
+	for _, key := range c.policy.Add(order.OrderUId) {
+		delete(c.data, key)
 	}
-	c.size++
-	c.data[node.key] = node
 }
@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+// тесты имеют смысл под go test -race: любая запись в общий заказ будет гонкой
+
+func immutableOrder(uid string, version int) *models.Order {
+	return &models.Order{
+		OrderUId:    uid,
+		TrackNumber: fmt.Sprintf("track-%d", version),
+		Payment:     models.Payment{Amount: int64(version)},
+		Items: []models.Item{
+			{Name: fmt.Sprintf("item-%d", version), Price: int64(version)},
+			{Name: fmt.Sprintf("item-%d", version), Price: int64(version)},
+		},
+	}
+}
+
+func TestCacheGetReturnsCopy(t *testing.T) {
+	c := NewCache(1)
+	c.Set(immutableOrder("a", 1))
+
+	got, has := c.Get("a")
+	require.True(t, has)
+	got.TrackNumber = "masked"
+	got.Items[0].Name = "masked"
+	got.Items = got.Items[:1]
+
+	again, _ := c.Get("a")
+	assert.Equal(t, immutableOrder("a", 1), again)
+}
+
+func TestCacheSetCopiesInput(t *testing.T) {
+	c := NewCache(1)
+	order := immutableOrder("a", 1)
+	c.Set(order)
+	order.Items[1].Price = -1
+	order.Payment.Amount = -1
+
+	got, _ := c.Get("a")
+	assert.Equal(t, immutableOrder("a", 1), got)
+}
+
+func TestCacheLoadFullCopiesInput(t *testing.T) {
+	c := NewCache(1)
+	order := immutableOrder("a", 1)
+	c.LoadFull([]*models.Order{order})
+	order.Items[0].Name = "changed"
+
+	got, _ := c.Get("a")
+	assert.Equal(t, immutableOrder("a", 1), got)
+}
+
+func TestCacheConcurrentReadersAndWriters(t *testing.T) {
+	for _, name := range Policies {
+		t.Run(name, func(t *testing.T) {
+			c := newPolicyCache(t, name, 8)
+			keys := []string{"a", "b", "c", "d"}
+			for _, key := range keys {
+				c.Set(immutableOrder(key, 0))
+			}
+
+			var wg sync.WaitGroup
+			for w := 0; w < 4; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for v := 1; v <= 200; v++ {
+						order := immutableOrder(keys[v%len(keys)], v)
+						c.Set(order)
+						// писатель продолжает менять свой экземпляр после Set
+						order.Items[0].Name = "writer mutated"
+					}
+				}()
+			}
+			for r := 0; r < 8; r++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < 500; i++ {
+						order, has := c.Get(keys[i%len(keys)])
+						if !has {
+							continue
+						}
+						// читатель "маскирует" данные в своей копии
+						order.TrackNumber = "reader mutated"
+						order.Items[0].Name = "reader mutated"
+						order.Items = append(order.Items, models.Item{Name: "extra"})
+					}
+				}()
+			}
+			wg.Wait()
+
+			for _, key := range keys {
+				order, has := c.Get(key)
+				if !has {
+					continue
+				}
+				version := int(order.Payment.Amount)
+				assert.Equal(t, immutableOrder(key, version), order)
+			}
+		})
+	}
+}
+
+func TestOrderCloneIsDeep(t *testing.T) {
+	order := immutableOrder("a", 1)
+	clone := order.Clone()
+	clone.Items[0].Name = "changed"
+	clone.Delivery.Name = "changed"
+
+	assert.Equal(t, immutableOrder("a", 1), order)
+	assert.Nil(t, (*models.Order)(nil).Clone())
+}
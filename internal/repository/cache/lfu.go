@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"container/list"
+	"sort"
+)
+
+// lfu - O(1) LFU: ключи разложены по корзинам частот, внутри корзины порядок LRU
+type lfu struct {
+	entries  map[string]*lfuEntry
+	buckets  map[uint64]*list.List
+	capacity uint64
+	minFreq  uint64
+}
+
+type lfuEntry struct {
+	key  string
+	freq uint64
+	elem *list.Element
+}
+
+func newLFU(capacity uint64) *lfu {
+	return &lfu{
+		entries:  make(map[string]*lfuEntry, capacity),
+		buckets:  make(map[uint64]*list.List),
+		capacity: capacity,
+	}
+}
+
+func (l *lfu) Hit(key string) {
+	entry, has := l.entries[key]
+	if !has {
+		return
+	}
+	l.unlink(entry)
+	if entry.freq == l.minFreq && l.buckets[entry.freq] == nil {
+		l.minFreq++
+	}
+	entry.freq++
+	l.link(entry)
+}
+
+func (l *lfu) Miss(string) {}
+
+func (l *lfu) Add(key string) []string {
+	var evicted []string
+	if uint64(len(l.entries)) >= l.capacity {
+		if bucket := l.buckets[l.minFreq]; bucket != nil {
+			victim := bucket.Back().Value.(*lfuEntry)
+			l.unlink(victim)
+			delete(l.entries, victim.key)
+			evicted = append(evicted, victim.key)
+		}
+	}
+	entry := &lfuEntry{key: key, freq: 1}
+	l.entries[key] = entry
+	l.link(entry)
+	l.minFreq = 1
+	return evicted
+}
+
+func (l *lfu) Remove(key string) {
+	entry, has := l.entries[key]
+	if !has {
+		return
+	}
+	l.unlink(entry)
+	delete(l.entries, key)
+	// корзина минимальной частоты могла опустеть, а Add вытесняет именно из нее
+	if l.buckets[l.minFreq] == nil {
+		l.minFreq = 0
+		for freq := range l.buckets {
+			if l.minFreq == 0 || freq < l.minFreq {
+				l.minFreq = freq
+			}
+		}
+	}
+}
+
+func (l *lfu) Keys() []string {
+	entries := make([]*lfuEntry, 0, len(l.entries))
+	for freq := range l.buckets {
+		for elem := l.buckets[freq].Front(); elem != nil; elem = elem.Next() {
+			entries = append(entries, elem.Value.(*lfuEntry))
+		}
+	}
+	// внутри одной частоты порядок корзины (свежие первыми) сохраняется
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].freq > entries[j].freq
+	})
+	keys := make([]string, len(entries))
+	for i, entry := range entries {
+		keys[i] = entry.key
+	}
+	return keys
+}
+
+func (l *lfu) link(entry *lfuEntry) {
+	bucket, has := l.buckets[entry.freq]
+	if !has {
+		bucket = list.New()
+		l.buckets[entry.freq] = bucket
+	}
+	entry.elem = bucket.PushFront(entry)
+}
+
+func (l *lfu) unlink(entry *lfuEntry) {
+	bucket := l.buckets[entry.freq]
+	bucket.Remove(entry.elem)
+	if bucket.Len() == 0 {
+		delete(l.buckets, entry.freq)
+	}
+}
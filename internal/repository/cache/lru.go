@@ -0,0 +1,125 @@
+package cache
+
+type lru struct {
+	nodes    map[string]*Node
+	capacity uint64
+	size     uint64
+	head     *Node
+	tail     *Node
+}
+
+type Node struct {
+	prev *Node
+	next *Node
+	key  string
+}
+
+func newLRU(capacity uint64) *lru {
+	return &lru{
+		nodes:    make(map[string]*Node, capacity),
+		capacity: capacity,
+	}
+}
+
+func (l *lru) Hit(key string) {
+	if node, has := l.nodes[key]; has {
+		l.moveToTop(node)
+	}
+}
+
+func (l *lru) Miss(string) {}
+
+func (l *lru) Add(key string) []string {
+	var evicted []string
+	if l.size >= l.capacity {
+		if removed := l.deleteBottom(); removed != nil {
+			evicted = append(evicted, removed.key)
+		}
+	}
+	l.addToFront(&Node{key: key})
+	return evicted
+}
+
+func (l *lru) Remove(key string) {
+	node, has := l.nodes[key]
+	if !has {
+		return
+	}
+	if node.prev != nil {
+		node.prev.next = node.next
+	} else {
+		l.head = node.next
+	}
+	if node.next != nil {
+		node.next.prev = node.prev
+	} else {
+		l.tail = node.prev
+	}
+	delete(l.nodes, key)
+	l.size--
+}
+
+func (l *lru) Keys() []string {
+	keys := make([]string, 0, l.size)
+	for node := l.head; node != nil; node = node.next {
+		keys = append(keys, node.key)
+	}
+	return keys
+}
+
+func (l *lru) moveToTop(node *Node) {
+	//если у нас элемент вверху - скип
+	if node == l.head {
+		return
+	}
+	//предыдущего элемента нет только у первого элемента
+	if node.prev != nil {
+		node.prev.next = node.next
+	}
+	// если элемент - хвост, то нужно сдвинуть указатель хвоста
+	if node.next != nil {
+		node.next.prev = node.prev
+	} else {
+		l.tail = l.tail.prev
+	}
+	//текущий элемент становится головой, т.е предыдущего нет, следующий - бывшая голова
+	node.prev = nil
+	node.next = l.head
+	if l.head != nil {
+		l.head.prev = node
+	}
+	l.head = node
+
+}
+
+func (l *lru) deleteBottom() *Node {
+	if l.tail == nil {
+		return nil
+	}
+	removed := l.tail
+	if l.head == l.tail {
+		l.tail = nil
+		l.head = nil
+	} else {
+		l.tail = l.tail.prev
+		l.tail.next = nil
+	}
+	delete(l.nodes, removed.key)
+	l.size--
+	return removed
+}
+
+func (l *lru) addToFront(node *Node) {
+	node.next = l.head
+	node.prev = nil
+	if l.head != nil {
+		l.head.prev = node
+	}
+	l.head = node
+
+	if l.tail == nil {
+		l.tail = node
+	}
+	l.size++
+	l.nodes[node.key] = node
+}
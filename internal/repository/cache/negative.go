@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// NegativeCache помнит uid, которых точно нет в бд, чтобы сканеры со случайными uid не долбили postgres.
+// Размер ограничен, при переполнении выкидывается самая старая запись; capacity <= 0 - ничего не запоминает
+type NegativeCache struct {
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	order    *list.List
+	capacity int
+	ttl      time.Duration
+	now      func() time.Time
+}
+
+type negativeEntry struct {
+	key       string
+	expiresAt time.Time
+}
+
+func NewNegativeCache(capacity int, ttl time.Duration) *NegativeCache {
+	return &NegativeCache{
+		entries:  make(map[string]*list.Element, max(capacity, 0)),
+		order:    list.New(),
+		capacity: capacity,
+		ttl:      ttl,
+		now:      time.Now,
+	}
+}
+
+func (c *NegativeCache) Has(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, has := c.entries[key]
+	if !has {
+		return false
+	}
+	if c.now().After(elem.Value.(*negativeEntry).expiresAt) {
+		c.removeElement(elem)
+		return false
+	}
+	return true
+}
+
+func (c *NegativeCache) Add(key string) {
+	if c.capacity <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expiresAt := c.now().Add(c.ttl)
+	if elem, has := c.entries[key]; has {
+		elem.Value.(*negativeEntry).expiresAt = expiresAt
+		c.order.MoveToFront(elem)
+		return
+	}
+	if c.order.Len() >= c.capacity {
+		c.removeElement(c.order.Back())
+	}
+	c.entries[key] = c.order.PushFront(&negativeEntry{key: key, expiresAt: expiresAt})
+}
+
+func (c *NegativeCache) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, has := c.entries[key]; has {
+		c.removeElement(elem)
+	}
+}
+
+func (c *NegativeCache) removeElement(elem *list.Element) {
+	if elem == nil {
+		return
+	}
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*negativeEntry).key)
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNegativeCacheExpires(t *testing.T) {
+	now := time.Now()
+	c := NewNegativeCache(10, time.Second)
+	c.now = func() time.Time { return now }
+
+	c.Add("missing")
+	assert.True(t, c.Has("missing"))
+
+	now = now.Add(2 * time.Second)
+	assert.False(t, c.Has("missing"))
+	assert.Equal(t, 0, c.order.Len())
+}
+
+func TestNegativeCacheBounded(t *testing.T) {
+	c := NewNegativeCache(2, time.Minute)
+
+	c.Add("a")
+	c.Add("b")
+	c.Add("c")
+
+	assert.False(t, c.Has("a"))
+	assert.True(t, c.Has("b"))
+	assert.True(t, c.Has("c"))
+}
+
+func TestNegativeCacheRemove(t *testing.T) {
+	c := NewNegativeCache(10, time.Minute)
+
+	c.Add("created")
+	c.Remove("created")
+
+	assert.False(t, c.Has("created"))
+}
+
+func TestNegativeCacheZeroCapacityIsOff(t *testing.T) {
+	for _, capacity := range []int{0, -1} {
+		c := NewNegativeCache(capacity, time.Minute)
+		c.Add("missing")
+		assert.False(t, c.Has("missing"))
+		assert.Equal(t, 0, c.order.Len())
+	}
+}
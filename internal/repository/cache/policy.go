@@ -0,0 +1,41 @@
+package cache
+
+import "fmt"
+
+// Policy решает, какие ключи держать в кэше. Все методы вызываются под мьютексом кэша
+type Policy interface {
+	// Hit - ключ из кэша прочитали или перезаписали
+	Hit(key string)
+	// Miss - ключ искали, но его нет в кэше
+	Miss(key string)
+	// Add - в кэш кладут новый ключ, возвращаются вытесненные ключи, среди них может оказаться и сам key
+	Add(key string) []string
+	// Remove - ключ убрали из кэша снаружи (заказ отменили)
+	Remove(key string)
+	// Keys - ключи от самых ценных к наименее ценным
+	Keys() []string
+}
+
+const (
+	PolicyLRU     = "lru"
+	PolicyLFU     = "lfu"
+	PolicyTinyLFU = "tinylfu"
+	PolicyARC     = "arc"
+)
+
+var Policies = []string{PolicyLRU, PolicyLFU, PolicyTinyLFU, PolicyARC}
+
+func NewPolicy(name string, capacity uint64) (Policy, error) {
+	switch name {
+	case PolicyLRU:
+		return newLRU(capacity), nil
+	case PolicyLFU:
+		return newLFU(capacity), nil
+	case PolicyTinyLFU:
+		return newTinyLFU(capacity), nil
+	case PolicyARC:
+		return newARC(capacity), nil
+	default:
+		return nil, fmt.Errorf("unknown cache policy %q", name)
+	}
+}
@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func newPolicyCache(t *testing.T, name string, capacity uint64) *Cache {
+	policy, err := NewPolicy(name, capacity)
+	require.NoError(t, err)
+	return NewCacheWithPolicy(capacity, policy)
+}
+
+// access - как сервис: читаем, на промахе кладем
+func access(c *Cache, key string) bool {
+	if _, has := c.Get(key); has {
+		return true
+	}
+	c.Set(&models.Order{OrderUId: key})
+	return false
+}
+
+func TestPoliciesKeepInvariants(t *testing.T) {
+	for _, name := range Policies {
+		t.Run(name, func(t *testing.T) {
+			c := newPolicyCache(t, name, 50)
+			rnd := rand.New(rand.NewSource(1))
+			for i := 0; i < 20_000; i++ {
+				access(c, fmt.Sprint(rnd.Intn(200)))
+				if i%7 == 0 {
+					c.Remove(fmt.Sprint(rnd.Intn(200)))
+				}
+
+				require.LessOrEqual(t, len(c.data), 50)
+			}
+			policyKeys := c.policy.Keys()
+			dataKeys := make([]string, 0, len(c.data))
+			for key := range c.data {
+				dataKeys = append(dataKeys, key)
+			}
+			sort.Strings(policyKeys)
+			sort.Strings(dataKeys)
+			assert.Equal(t, dataKeys, policyKeys)
+		})
+	}
+}
+
+func TestUnknownPolicy(t *testing.T) {
+	_, err := NewPolicy("fifo", 10)
+	assert.Error(t, err)
+}
+
+func TestLRUEvictsLeastRecent(t *testing.T) {
+	c := newPolicyCache(t, PolicyLRU, 2)
+	access(c, "a")
+	access(c, "b")
+	access(c, "a")
+	access(c, "c")
+
+	assert.Equal(t, []string{"c", "a"}, c.policy.Keys())
+}
+
+func TestLFUEvictsLeastFrequent(t *testing.T) {
+	c := newPolicyCache(t, PolicyLFU, 2)
+	access(c, "a")
+	access(c, "a")
+	access(c, "b")
+	access(c, "c")
+
+	assert.Equal(t, []string{"a", "c"}, c.policy.Keys())
+}
+
+// горячий набор должен пережить разовый скан по холодным ключам
+func TestScanResistance(t *testing.T) {
+	for _, name := range []string{PolicyLFU, PolicyTinyLFU, PolicyARC} {
+		t.Run(name, func(t *testing.T) {
+			c := newPolicyCache(t, name, 100)
+			for round := 0; round < 5; round++ {
+				for i := 0; i < 50; i++ {
+					access(c, fmt.Sprintf("hot-%d", i))
+				}
+			}
+			for i := 0; i < 1000; i++ {
+				access(c, fmt.Sprintf("scan-%d", i))
+			}
+
+			hits := 0
+			for i := 0; i < 50; i++ {
+				if _, has := c.Get(fmt.Sprintf("hot-%d", i)); has {
+					hits++
+				}
+			}
+			assert.GreaterOrEqual(t, hits, 45)
+		})
+	}
+}
+
+func TestLoadFullMostRecentOnTop(t *testing.T) {
+	c := NewCache(2)
+	c.Set(&models.Order{OrderUId: "live"})
+	c.LoadFull([]*models.Order{{OrderUId: "newest"}, {OrderUId: "live"}, {OrderUId: "oldest"}})
+
+	assert.Equal(t, []string{"newest", "live"}, c.policy.Keys())
+}
@@ -0,0 +1,221 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// формат снапшота:
+// magic(4) | version(2) | created_at unix nano(8) | count(4) | count * (len(4) | order json) | crc32c(4)
+// записи идут в порядке политики (для LRU - от самой свежей к самой старой), чтобы при загрузке его восстановить
+const (
+	snapshotMagic   = "WBCS"
+	snapshotVersion = uint16(1)
+	headerSize      = 4 + 2 + 8 + 4
+	checksumSize    = 4
+)
+
+var (
+	ErrSnapshotCorrupt = errors.New("cache snapshot is corrupt")
+	ErrSnapshotStale   = errors.New("cache snapshot is stale")
+	ErrSnapshotVersion = errors.New("unsupported cache snapshot version")
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// CancelledFunc отдает, какие из ids уже отменены. Снапшот мог быть снят до отмены, и без проверки
+// отмененный заказ после рестарта вернулся бы в кэш
+type CancelledFunc func(ctx context.Context, ids []string) ([]string, error)
+
+func (c *Cache) WriteSnapshot(w io.Writer) error {
+	orders := c.ordered()
+
+	hash := crc32.New(crcTable)
+	bw := bufio.NewWriter(io.MultiWriter(w, hash))
+
+	header := make([]byte, 0, headerSize)
+	header = append(header, snapshotMagic...)
+	header = binary.BigEndian.AppendUint16(header, snapshotVersion)
+	header = binary.BigEndian.AppendUint64(header, uint64(time.Now().UnixNano()))
+	header = binary.BigEndian.AppendUint32(header, uint32(len(orders)))
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+
+	for _, order := range orders {
+		data, err := json.Marshal(order)
+		if err != nil {
+			return fmt.Errorf("marshal order %s for snapshot: %w", order.OrderUId, err)
+		}
+		if _, err = bw.Write(binary.BigEndian.AppendUint32(nil, uint32(len(data)))); err != nil {
+			return err
+		}
+		if _, err = bw.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := w.Write(binary.BigEndian.AppendUint32(nil, hash.Sum32()))
+	return err
+}
+
+// SaveSnapshot пишет во временный файл и переименовывает, чтобы при падении не остался огрызок
+func (c *Cache) SaveSnapshot(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if err = c.WriteSnapshot(tmp); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ReadSnapshot загружает заказы из снапшота, maxAge = 0 отключает проверку свежести.
+// Отмененные по cancelled заказы выкидываются, cancelled может быть nil
+func (c *Cache) ReadSnapshot(ctx context.Context, r io.Reader, maxAge time.Duration, cancelled CancelledFunc) (int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) < headerSize+checksumSize || string(data[:4]) != snapshotMagic {
+		return 0, ErrSnapshotCorrupt
+	}
+	body, sum := data[:len(data)-checksumSize], data[len(data)-checksumSize:]
+	if crc32.Checksum(body, crcTable) != binary.BigEndian.Uint32(sum) {
+		return 0, ErrSnapshotCorrupt
+	}
+
+	if version := binary.BigEndian.Uint16(body[4:6]); version != snapshotVersion {
+		return 0, fmt.Errorf("%w: %d", ErrSnapshotVersion, version)
+	}
+	createdAt := time.Unix(0, int64(binary.BigEndian.Uint64(body[6:14])))
+	if maxAge > 0 && time.Since(createdAt) > maxAge {
+		return 0, fmt.Errorf("%w: created at %s", ErrSnapshotStale, createdAt.Format(time.RFC3339))
+	}
+	count := binary.BigEndian.Uint32(body[14:18])
+
+	orders := make([]*models.Order, 0, min(uint64(count), c.capacity))
+	buf := bytes.NewReader(body[headerSize:])
+	for i := uint32(0); i < count; i++ {
+		var size uint32
+		if err = binary.Read(buf, binary.BigEndian, &size); err != nil {
+			return 0, ErrSnapshotCorrupt
+		}
+		if int64(size) > int64(buf.Len()) {
+			return 0, ErrSnapshotCorrupt
+		}
+		raw := make([]byte, size)
+		if _, err = io.ReadFull(buf, raw); err != nil {
+			return 0, ErrSnapshotCorrupt
+		}
+		if uint64(len(orders)) >= c.capacity {
+			continue
+		}
+		var order models.Order
+		if err = json.Unmarshal(raw, &order); err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrSnapshotCorrupt, err)
+		}
+		orders = append(orders, &order)
+	}
+	if buf.Len() != 0 {
+		return 0, ErrSnapshotCorrupt
+	}
+	if cancelled != nil && len(orders) > 0 {
+		if orders, err = dropCancelled(ctx, orders, cancelled); err != nil {
+			return 0, err
+		}
+	}
+
+	c.LoadFull(orders)
+	return len(orders), nil
+}
+
+func (c *Cache) LoadSnapshot(ctx context.Context, path string, maxAge time.Duration, cancelled CancelledFunc) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	return c.ReadSnapshot(ctx, f, maxAge, cancelled)
+}
+
+func dropCancelled(ctx context.Context, orders []*models.Order, cancelled CancelledFunc) ([]*models.Order, error) {
+	ids := make([]string, 0, len(orders))
+	for _, order := range orders {
+		ids = append(ids, order.OrderUId)
+	}
+	gone, err := cancelled(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("check cancelled orders: %w", err)
+	}
+	if len(gone) == 0 {
+		return orders, nil
+	}
+	drop := make(map[string]struct{}, len(gone))
+	for _, id := range gone {
+		drop[id] = struct{}{}
+	}
+	return slices.DeleteFunc(orders, func(order *models.Order) bool {
+		_, has := drop[order.OrderUId]
+		return has
+	}), nil
+}
+
+// RunSnapshots периодически сохраняет кэш на диск, пока не отменят контекст
+func (c *Cache) RunSnapshots(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.SaveSnapshot(path); err != nil {
+				log.Printf("failed to save cache snapshot: %v", err)
+			}
+		}
+	}
+}
+
+// ordered возвращает заказы от самых ценных для политики к наименее ценным
+func (c *Cache) ordered() []*models.Order {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := c.policy.Keys()
+	orders := make([]*models.Order, 0, len(keys))
+	for _, key := range keys {
+		orders = append(orders, c.data[key])
+	}
+	return orders
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func filledCache(keys ...string) *Cache {
+	c := NewCache(uint64(len(keys)))
+	for _, key := range keys {
+		c.Set(&models.Order{OrderUId: key, Items: []models.Item{{Name: key}}})
+	}
+	return c
+}
+
+func keys(c *Cache) []string {
+	var res []string
+	for _, order := range c.ordered() {
+		res = append(res, order.OrderUId)
+	}
+	return res
+}
+
+func TestSnapshotKeepsLRUOrder(t *testing.T) {
+	src := filledCache("a", "b", "c")
+	src.Get("a")
+
+	path := filepath.Join(t.TempDir(), "cache.snap")
+	require.NoError(t, src.SaveSnapshot(path))
+
+	dst := NewCache(3)
+	n, err := dst.LoadSnapshot(context.Background(), path, time.Minute, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, []string{"a", "c", "b"}, keys(dst))
+
+	order, has := dst.Get("b")
+	require.True(t, has)
+	assert.Equal(t, "b", order.Items[0].Name)
+}
+
+func TestSnapshotTruncatedToCapacity(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, filledCache("a", "b", "c").WriteSnapshot(&buf))
+
+	dst := NewCache(2)
+	n, err := dst.ReadSnapshot(context.Background(), &buf, 0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"c", "b"}, keys(dst))
+}
+
+func TestSnapshotCorrupt(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, filledCache("a", "b").WriteSnapshot(&buf))
+	data := buf.Bytes()
+	data[headerSize+6] ^= 0xff
+
+	_, err := NewCache(2).ReadSnapshot(context.Background(), bytes.NewReader(data), 0, nil)
+	assert.ErrorIs(t, err, ErrSnapshotCorrupt)
+
+	_, err = NewCache(2).ReadSnapshot(context.Background(), bytes.NewReader(data[:10]), 0, nil)
+	assert.ErrorIs(t, err, ErrSnapshotCorrupt)
+}
+
+func TestSnapshotStale(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, filledCache("a").WriteSnapshot(&buf))
+	time.Sleep(5 * time.Millisecond)
+
+	c := NewCache(1)
+	_, err := c.ReadSnapshot(context.Background(), &buf, time.Millisecond, nil)
+	assert.ErrorIs(t, err, ErrSnapshotStale)
+	assert.Empty(t, keys(c))
+}
+
+// заказ отменили после снапшота: при загрузке он в кэш не возвращается
+func TestSnapshotDropsCancelled(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, filledCache("a", "b", "c").WriteSnapshot(&buf))
+
+	var asked []string
+	cancelled := func(_ context.Context, ids []string) ([]string, error) {
+		asked = ids
+		return []string{"b"}, nil
+	}
+	c := NewCache(3)
+	n, err := c.ReadSnapshot(context.Background(), &buf, 0, cancelled)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"c", "a"}, keys(c))
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, asked, "one check for the whole snapshot")
+}
+
+func TestSnapshotCancelledCheckFails(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, filledCache("a").WriteSnapshot(&buf))
+
+	c := NewCache(1)
+	_, err := c.ReadSnapshot(context.Background(), &buf, 0, func(context.Context, []string) ([]string, error) {
+		return nil, errors.New("db is down")
+	})
+	assert.ErrorContains(t, err, "db is down")
+	assert.Empty(t, keys(c), "without the check the snapshot is not trusted")
+}
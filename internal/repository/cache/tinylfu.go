@@ -0,0 +1,209 @@
+package cache
+
+import (
+	"container/list"
+	"hash/fnv"
+)
+
+// tinyLFU - упрощенный W-TinyLFU: маленькое окно LRU (1%) и основная часть SLRU (probation 20% / protected 80%).
+// Вылетевший из окна кандидат попадает в основную часть, только если по скетчу его спрашивали чаще,
+// чем жертву из probation, так что разовые сканы не вымывают горячие заказы
+type tinyLFU struct {
+	sketch *countMinSketch
+
+	window    *list.List
+	probation *list.List
+	protected *list.List
+	entries   map[string]*tinyEntry
+
+	windowCap    int
+	protectedCap int
+	mainCap      int
+}
+
+type tinySegment uint8
+
+const (
+	segmentWindow tinySegment = iota
+	segmentProbation
+	segmentProtected
+)
+
+type tinyEntry struct {
+	key     string
+	segment tinySegment
+	elem    *list.Element
+}
+
+func newTinyLFU(capacity uint64) *tinyLFU {
+	total := int(capacity)
+	windowCap := max(1, total/100)
+	mainCap := max(0, total-windowCap)
+	return &tinyLFU{
+		sketch:       newCountMinSketch(total),
+		window:       list.New(),
+		probation:    list.New(),
+		protected:    list.New(),
+		entries:      make(map[string]*tinyEntry, capacity),
+		windowCap:    windowCap,
+		mainCap:      mainCap,
+		protectedCap: mainCap * 8 / 10,
+	}
+}
+
+func (t *tinyLFU) Hit(key string) {
+	t.sketch.increment(key)
+	entry, has := t.entries[key]
+	if !has {
+		return
+	}
+	switch entry.segment {
+	case segmentWindow:
+		t.window.MoveToFront(entry.elem)
+	case segmentProtected:
+		t.protected.MoveToFront(entry.elem)
+	case segmentProbation:
+		t.probation.Remove(entry.elem)
+		entry.segment = segmentProtected
+		entry.elem = t.protected.PushFront(entry)
+		if t.protected.Len() > t.protectedCap {
+			demoted := t.protected.Remove(t.protected.Back()).(*tinyEntry)
+			demoted.segment = segmentProbation
+			demoted.elem = t.probation.PushFront(demoted)
+		}
+	}
+}
+
+func (t *tinyLFU) Miss(key string) {
+	t.sketch.increment(key)
+}
+
+func (t *tinyLFU) Add(key string) []string {
+	t.sketch.increment(key)
+	entry := &tinyEntry{key: key, segment: segmentWindow}
+	entry.elem = t.window.PushFront(entry)
+	t.entries[key] = entry
+	if t.window.Len() <= t.windowCap {
+		return nil
+	}
+
+	candidate := t.window.Remove(t.window.Back()).(*tinyEntry)
+	if t.probation.Len()+t.protected.Len() < t.mainCap {
+		candidate.segment = segmentProbation
+		candidate.elem = t.probation.PushFront(candidate)
+		return nil
+	}
+
+	victims := t.probation
+	if victims.Len() == 0 {
+		victims = t.protected
+	}
+	if victims.Len() == 0 {
+		delete(t.entries, candidate.key)
+		return []string{candidate.key}
+	}
+	victim := victims.Back().Value.(*tinyEntry)
+	if t.sketch.estimate(candidate.key) <= t.sketch.estimate(victim.key) {
+		delete(t.entries, candidate.key)
+		return []string{candidate.key}
+	}
+	victims.Remove(victim.elem)
+	delete(t.entries, victim.key)
+	candidate.segment = segmentProbation
+	candidate.elem = t.probation.PushFront(candidate)
+	return []string{victim.key}
+}
+
+// Remove не трогает скетч: частота ключа еще пригодится, если заказ вернется
+func (t *tinyLFU) Remove(key string) {
+	entry, has := t.entries[key]
+	if !has {
+		return
+	}
+	switch entry.segment {
+	case segmentWindow:
+		t.window.Remove(entry.elem)
+	case segmentProbation:
+		t.probation.Remove(entry.elem)
+	case segmentProtected:
+		t.protected.Remove(entry.elem)
+	}
+	delete(t.entries, key)
+}
+
+func (t *tinyLFU) Keys() []string {
+	keys := make([]string, 0, len(t.entries))
+	for _, segment := range []*list.List{t.protected, t.probation, t.window} {
+		for elem := segment.Front(); elem != nil; elem = elem.Next() {
+			keys = append(keys, elem.Value.(*tinyEntry).key)
+		}
+	}
+	return keys
+}
+
+// countMinSketch - частоты обращений с 4 строками и старением: после sampleSize инкрементов все счетчики делятся пополам.
+// Индексы строк считаются из одного fnv хэша (h1 + i*h2), так что симуляция детерминирована
+type countMinSketch struct {
+	rows       [4][]uint8
+	mask       uint64
+	additions  int
+	sampleSize int
+}
+
+const sketchMaxCount = 15
+
+func newCountMinSketch(capacity int) *countMinSketch {
+	width := 16
+	for width < capacity {
+		width <<= 1
+	}
+	s := &countMinSketch{
+		mask:       uint64(width - 1),
+		sampleSize: 10 * max(capacity, 1),
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *countMinSketch) indexes(key string) [4]uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32|1
+	var res [4]uint64
+	for i := range res {
+		res[i] = (h1 + uint64(i)*h2) & s.mask
+	}
+	return res
+}
+
+func (s *countMinSketch) increment(key string) {
+	for i, idx := range s.indexes(key) {
+		if s.rows[i][idx] < sketchMaxCount {
+			s.rows[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.sampleSize {
+		s.reset()
+	}
+}
+
+func (s *countMinSketch) estimate(key string) uint8 {
+	res := uint8(sketchMaxCount)
+	for i, idx := range s.indexes(key) {
+		res = min(res, s.rows[i][idx])
+	}
+	return res
+}
+
+func (s *countMinSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
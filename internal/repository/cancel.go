@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/apperror"
+)
+
+// AuditCancelled - заказ отменен tombstone-записью
+const AuditCancelled = "cancelled"
+
+const (
+	queryCancelOrder = `UPDATE orders SET cancelled_at = now() WHERE order_uid = $1 AND cancelled_at IS NULL`
+
+	queryInsertAudit = `INSERT INTO order_audit (order_uid, action, source) VALUES ($1, $2, $3)`
+
+	queryCancelledIDs = `SELECT o.order_uid FROM orders AS o WHERE o.order_uid = ANY($1) AND o.cancelled_at IS NOT NULL`
+)
+
+// CancelOrder помечает заказ отмененным и пишет это в журнал одной транзакцией.
+// source - откуда пришла отмена (например, топик/партиция@оффсет).
+// ErrNotFound - заказа нет или он уже отменен, тогда журнал не трогается
+func (r *Repo) CancelOrder(ctx context.Context, orderUID, source string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	tag, err := tx.Exec(ctx, queryCancelOrder, orderUID)
+	if err != nil {
+		return fmt.Errorf("error while cancelling order in repository: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return apperror.ErrNotFound
+	}
+	if _, err = tx.Exec(ctx, queryInsertAudit, orderUID, AuditCancelled, source); err != nil {
+		return fmt.Errorf("error while writing order audit in repository: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error transaction commit in repository - CancelOrder: %w", err)
+	}
+	return nil
+}
+
+// CancelledIDs - какие из ids отменены, одним запросом
+func (r *Repo) CancelledIDs(ctx context.Context, ids []string) ([]string, error) {
+	rows, err := r.executor().Query(ctx, queryCancelledIDs, ids)
+	if err != nil {
+		return nil, fmt.Errorf("error while selecting cancelled orders in repository: %w", err)
+	}
+	defer rows.Close()
+
+	var cancelled []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		cancelled = append(cancelled, id)
+	}
+	return cancelled, rows.Err()
+}
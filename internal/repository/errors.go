@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
+	"strings"
+)
+
+// IsDataError - бд отвергла сами данные: integrity constraint violation (unique, foreign key, check, not null)
+// или data exception. Повтор с теми же данными упадет так же
+func IsDataError(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (strings.HasPrefix(pgErr.Code, "23") || strings.HasPrefix(pgErr.Code, "22"))
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+const (
+	queryIDsCreatedBetween = `
+			SELECT o.order_uid FROM orders AS o
+			WHERE o.cancelled_at IS NULL AND o.date_created >= $1 AND o.date_created < $2
+			ORDER BY o.date_created, o.order_uid`
+
+	querySampleIDs = `SELECT o.order_uid FROM orders AS o WHERE o.cancelled_at IS NULL ORDER BY random() LIMIT $1`
+)
+
+// GetIDsCreatedBetween - uid активных заказов, созданных в [from, to), от старых к новым
+func (r *Repo) GetIDsCreatedBetween(ctx context.Context, from, to time.Time) ([]string, error) {
+	rows, err := r.executor().Query(ctx, queryIDsCreatedBetween, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return scanIDs(rows)
+}
+
+// GetSampleIDs - amount случайных активных заказов
+func (r *Repo) GetSampleIDs(ctx context.Context, amount uint64) ([]string, error) {
+	rows, err := r.executor().Query(ctx, querySampleIDs, amount)
+	if err != nil {
+		return nil, err
+	}
+	return scanIDs(rows)
+}
+
+func scanIDs(rows pgx.Rows) ([]string, error) {
+	defer rows.Close()
+	var result []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error while getting IDs in repository: %w", err)
+		}
+		result = append(result, id)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error in repository scanIDs: %w", rows.Err())
+	}
+	return result, nil
+}
@@ -1,16 +1,21 @@
 package repository
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"github.com/GameXost/wbTestCase/internal/apperror"
 	"github.com/GameXost/wbTestCase/internal/generator"
+	"github.com/GameXost/wbTestCase/internal/generator/generatortest"
+	"github.com/GameXost/wbTestCase/internal/models"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/modules/postgres"
 	"github.com/testcontainers/testcontainers-go/wait"
 	"os"
 	"reflect"
+	"slices"
 	"testing"
 
 	"time"
@@ -60,8 +65,8 @@ func TestMain(m *testing.M) {
 
 func TestCreateGetOrder(t *testing.T) {
 	ctx := context.Background()
-	order := generator.ValidOrder("correct")
-	err := repo.CreateFullOrder(ctx, order)
+	order := generatortest.New(t).ValidOrder("correct")
+	err := repo.CreateFullOrder(ctx, order, nil)
 	if err != nil {
 		t.Fatalf("CreateFullOrder failed: %v", err)
 	}
@@ -71,10 +76,14 @@ func TestCreateGetOrder(t *testing.T) {
 		t.Fatalf("GetFullOrderOnId failed: %v", err)
 	}
 	got.Payment.OrderId = order.OrderUId // эти айдишники есть в структурах, но я их не получаю из репозитория
-	got.Items[0].OrderUId = order.OrderUId
-
-	//служебные поля
-	order.Items[0].Id = got.Items[0].Id // только в бд есть, уникальный primary key, не возвращаю из бд
+	if len(got.Items) != len(order.Items) {
+		t.Fatalf("got %d items, want %d", len(got.Items), len(order.Items))
+	}
+	for i := range got.Items {
+		got.Items[i].OrderUId = order.OrderUId
+		//служебные поля
+		order.Items[i].Id = got.Items[i].Id // только в бд есть, уникальный primary key, не возвращаю из бд
+	}
 	order.Delivery.Id = got.Delivery.Id
 
 	order.DateCreated = got.DateCreated // разные таймзоны, хз как поменять
@@ -85,20 +94,22 @@ func TestCreateGetOrder(t *testing.T) {
 
 func TestIdempotentCreateOrder(t *testing.T) {
 	ctx := context.Background()
-	order := generator.ValidOrder("idempotent")
+	order := generatortest.New(t).ValidOrder("idempotent")
 
 	order.OrderUId = "Idemp"
 	order.Payment.OrderId = "Idemp"
 	order.Delivery.OrderUId = "Idemp"
-	order.Items[0].OrderUId = "Idemp"
+	for i := range order.Items {
+		order.Items[i].OrderUId = "Idemp"
+	}
 
-	err := repo.CreateFullOrder(ctx, order)
+	err := repo.CreateFullOrder(ctx, order, nil)
 	if err != nil {
 		t.Fatalf("CreateFullOrder try 1 failed: %v", err)
 	}
-	err = repo.CreateFullOrder(ctx, order)
-	if err != nil {
-		t.Fatalf("CreateFullOrder try 2 failed: %v", err)
+	err = repo.CreateFullOrder(ctx, order, nil)
+	if !errors.Is(err, apperror.ErrDuplicate) {
+		t.Fatalf("CreateFullOrder try 2: want ErrDuplicate, got: %v", err)
 	}
 
 }
@@ -111,3 +122,260 @@ func TestOrderNotFound(t *testing.T) {
 	}
 
 }
+
+func TestGetFullOrdersOnIds(t *testing.T) {
+	ctx := context.Background()
+	first := generatortest.New(t).ValidOrder("batch_1")
+	second := generatortest.New(t).ValidOrder("batch_2")
+	for _, order := range []*models.Order{first, second} {
+		if err := repo.CreateFullOrder(ctx, order, nil); err != nil {
+			t.Fatalf("CreateFullOrder failed: %v", err)
+		}
+	}
+
+	got, err := repo.GetFullOrdersOnIds(ctx, []string{"batch_1", "batch_2", "batch_missing"})
+	if err != nil {
+		t.Fatalf("GetFullOrdersOnIds failed: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("want 2 orders, got %d", len(got))
+	}
+	for _, order := range got {
+		single, err := repo.GetFullOrderOnId(ctx, order.OrderUId)
+		if err != nil {
+			t.Fatalf("GetFullOrderOnId failed: %v", err)
+		}
+		if !reflect.DeepEqual(order, single) {
+			t.Fatalf("batch and single reads differ, batch:\n %+v, single:\n %+v", order, single)
+		}
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	ctx := context.Background()
+	record := &models.QuarantinedRecord{
+		Topic:     "orders",
+		Partition: 3,
+		Offset:    42,
+		Key:       []byte("q_1"),
+		Value:     []byte("{not json \xff\x00"),
+		Headers:   []models.Header{{Key: "dlq.reason", Value: []byte("invalid_json")}, {Key: "trace", Value: []byte{0, 0xff, 'x'}}},
+		Reason:    "invalid_json",
+		Error:     "kafka is down",
+	}
+	if err := repo.Quarantine(ctx, record); err != nil {
+		t.Fatalf("Quarantine failed: %v", err)
+	}
+	if err := repo.Quarantine(ctx, record); err != nil {
+		t.Fatalf("Quarantine of the same offset failed: %v", err)
+	}
+
+	list, err := repo.ListQuarantined(ctx, 10)
+	if err != nil {
+		t.Fatalf("ListQuarantined failed: %v", err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("want 1 quarantined record, got %d", len(list))
+	}
+	got, err := repo.GetQuarantined(ctx, list[0].Id)
+	if err != nil {
+		t.Fatalf("GetQuarantined failed: %v", err)
+	}
+	if !bytes.Equal(got.Value, record.Value) || !bytes.Equal(got.Key, record.Key) || !reflect.DeepEqual(got.Headers, record.Headers) {
+		t.Fatalf("record changed in quarantine, got:\n %+v, want:\n %+v", got, record)
+	}
+
+	claimed, err := repo.ClaimQuarantined(ctx, got.Id)
+	if err != nil {
+		t.Fatalf("ClaimQuarantined failed: %v", err)
+	}
+	if claimed.ReleasedAt == nil || !bytes.Equal(claimed.Value, record.Value) {
+		t.Fatalf("claimed record is not released or changed: %+v", claimed)
+	}
+	if _, err = repo.ClaimQuarantined(ctx, got.Id); !errors.Is(err, apperror.ErrNotFound) {
+		t.Fatalf("want ErrNotFound on second claim, got: %v", err)
+	}
+	if list, _ = repo.ListQuarantined(ctx, 10); len(list) != 0 {
+		t.Fatalf("released record is still listed: %+v", list)
+	}
+	if err = repo.UnclaimQuarantined(ctx, got.Id); err != nil {
+		t.Fatalf("UnclaimQuarantined failed: %v", err)
+	}
+	if list, _ = repo.ListQuarantined(ctx, 10); len(list) != 1 {
+		t.Fatalf("unclaimed record is not listed: %+v", list)
+	}
+}
+
+func TestCreateFullOrderAtStoresOffset(t *testing.T) {
+	ctx := context.Background()
+	offset := models.PartitionOffset{Group: "test_group", Topic: "orders", Partition: 1, Offset: 10}
+	order := generatortest.New(t).ValidOrder("with_offset")
+	if err := repo.CreateFullOrderAt(ctx, order, nil, offset); err != nil {
+		t.Fatalf("CreateFullOrderAt failed: %v", err)
+	}
+
+	// дубль заказа все равно двигает оффсет
+	offset.Offset = 11
+	if err := repo.CreateFullOrderAt(ctx, order, nil, offset); !errors.Is(err, apperror.ErrDuplicate) {
+		t.Fatalf("CreateFullOrderAt of duplicate: want ErrDuplicate, got: %v", err)
+	}
+	offsets, err := repo.LoadOffsets(ctx, "test_group", "orders")
+	if err != nil {
+		t.Fatalf("LoadOffsets failed: %v", err)
+	}
+	if offsets[1] != 11 {
+		t.Fatalf("want offset 11, got %v", offsets)
+	}
+
+	// заказ не сохранился - оффсет не двигается
+	broken := generatortest.New(t).ValidOrder("broken_with_offset")
+	broken.Payment.Transaction = order.Payment.Transaction
+	offset.Offset = 12
+	if err = repo.CreateFullOrderAt(ctx, broken, nil, offset); err == nil {
+		t.Fatalf("want error on duplicate payment transaction")
+	}
+	if offsets, _ = repo.LoadOffsets(ctx, "test_group", "orders"); offsets[1] != 11 {
+		t.Fatalf("offset moved without order: %v", offsets)
+	}
+}
+
+func TestCancelOrder(t *testing.T) {
+	ctx := context.Background()
+	order := generatortest.New(t).ValidOrder("to_cancel")
+	if err := repo.CreateFullOrder(ctx, order, nil); err != nil {
+		t.Fatalf("CreateFullOrder failed: %v", err)
+	}
+
+	if err := repo.CancelOrder(ctx, order.OrderUId, "orders/0@7"); err != nil {
+		t.Fatalf("CancelOrder failed: %v", err)
+	}
+	if _, err := repo.GetFullOrderOnId(ctx, order.OrderUId); !errors.Is(err, apperror.ErrNotFound) {
+		t.Fatalf("cancelled order: want ErrNotFound, got: %v", err)
+	}
+	if got, _ := repo.GetFullOrdersOnIds(ctx, []string{order.OrderUId}); len(got) != 0 {
+		t.Fatalf("cancelled order is returned by batch read: %+v", got)
+	}
+	ids, err := repo.GetRecentIDs(ctx, 1000)
+	if err != nil {
+		t.Fatalf("GetRecentIDs failed: %v", err)
+	}
+	if slices.Contains(ids, order.OrderUId) {
+		t.Fatalf("cancelled order is in recent ids")
+	}
+	cancelled, err := repo.CancelledIDs(ctx, []string{order.OrderUId, "cancel_missing"})
+	if err != nil {
+		t.Fatalf("CancelledIDs failed: %v", err)
+	}
+	if !slices.Equal(cancelled, []string{order.OrderUId}) {
+		t.Fatalf("want only the cancelled order, got %v", cancelled)
+	}
+
+	// повторная отмена ничего не пишет
+	if err = repo.CancelOrder(ctx, order.OrderUId, "orders/0@8"); !errors.Is(err, apperror.ErrNotFound) {
+		t.Fatalf("second cancel: want ErrNotFound, got: %v", err)
+	}
+	if err = repo.CancelOrder(ctx, "cancel_missing", "orders/0@9"); !errors.Is(err, apperror.ErrNotFound) {
+		t.Fatalf("cancel of missing order: want ErrNotFound, got: %v", err)
+	}
+
+	var action, source string
+	var count int
+	err = repo.pool.QueryRow(ctx, `SELECT max(action), max(source), count(*) FROM order_audit WHERE order_uid = $1`, order.OrderUId).
+		Scan(&action, &source, &count)
+	if err != nil {
+		t.Fatalf("select audit failed: %v", err)
+	}
+	if count != 1 || action != AuditCancelled || source != "orders/0@7" {
+		t.Fatalf("want one audit row (cancelled, orders/0@7), got %d (%s, %s)", count, action, source)
+	}
+}
+
+func TestRawOrderArchiveAndRebuild(t *testing.T) {
+	ctx := context.Background()
+	order := generatortest.New(t).ValidOrder("raw_1")
+	value, err := json.Marshal(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// бинарное значение заголовка должно пережить jsonb без изменений
+	raw := &models.RawOrder{
+		OrderUId:   order.OrderUId,
+		Topic:      "orders",
+		Partition:  2,
+		Offset:     5,
+		Headers:    []models.Header{{Key: "content-type", Value: []byte("application/json")}, {Key: "trace", Value: []byte{0, 0xff, 0xfe}}},
+		Value:      value,
+		ReceivedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+	if err = repo.CreateFullOrder(ctx, order, raw); err != nil {
+		t.Fatalf("CreateFullOrder failed: %v", err)
+	}
+	var payloadUID string
+	if err = repo.pool.QueryRow(ctx, `SELECT payload->>'order_uid' FROM raw_orders WHERE order_uid = $1`, order.OrderUId).Scan(&payloadUID); err != nil {
+		t.Fatalf("select raw payload failed: %v", err)
+	}
+	if payloadUID != order.OrderUId {
+		t.Fatalf("want json payload of %s, got %q", order.OrderUId, payloadUID)
+	}
+
+	list, err := repo.ListRawOrders(ctx, "raw_0", 1)
+	if err != nil {
+		t.Fatalf("ListRawOrders failed: %v", err)
+	}
+	if len(list) != 1 || !reflect.DeepEqual(list[0].Value, raw.Value) || !reflect.DeepEqual(list[0].Headers, raw.Headers) ||
+		list[0].Partition != 2 || list[0].Offset != 5 || !list[0].ReceivedAt.Equal(raw.ReceivedAt) {
+		t.Fatalf("raw record changed in archive, got:\n %+v, want:\n %+v", list, raw)
+	}
+
+	rebuilt := generatortest.New(t).ValidOrder("raw_1")
+	rebuilt.Items = append(rebuilt.Items, rebuilt.Items[0])
+	rebuilt.Items[len(rebuilt.Items)-1].ChrtId++
+	if err = repo.RebuildOrder(ctx, rebuilt); err != nil {
+		t.Fatalf("RebuildOrder failed: %v", err)
+	}
+	got, err := repo.GetFullOrderOnId(ctx, order.OrderUId)
+	if err != nil {
+		t.Fatalf("GetFullOrderOnId failed: %v", err)
+	}
+	if len(got.Items) != len(rebuilt.Items) || got.Payment.Transaction != rebuilt.Payment.Transaction || got.TrackNumber != rebuilt.TrackNumber {
+		t.Fatalf("order is not rebuilt, got:\n %+v, want:\n %+v", got, rebuilt)
+	}
+	if err = repo.RebuildOrder(ctx, generatortest.New(t).ValidOrder("raw_missing")); !errors.Is(err, apperror.ErrNotFound) {
+		t.Fatalf("rebuild of missing order: want ErrNotFound, got: %v", err)
+	}
+}
+
+func TestExportIDs(t *testing.T) {
+	ctx := context.Background()
+	// окно, в которое не попадают заказы других тестов
+	from := time.Date(1999, 1, 1, 0, 0, 0, 0, time.UTC)
+	g := generator.NewWithOptions(generatortest.New(t).Seed(), generator.Options{MaxItems: 2, From: from, To: from.Add(time.Hour)})
+	var want []string
+	for i, uid := range []string{"export_2", "export_0", "export_1"} {
+		order := g.ValidOrder(uid)
+		order.DateCreated = from.Add(time.Duration(i) * time.Minute)
+		if err := repo.CreateFullOrder(ctx, order, nil); err != nil {
+			t.Fatalf("CreateFullOrder failed: %v", err)
+		}
+		want = append(want, uid)
+	}
+	if err := repo.CancelOrder(ctx, "export_1", "test"); err != nil {
+		t.Fatalf("CancelOrder failed: %v", err)
+	}
+
+	got, err := repo.GetIDsCreatedBetween(ctx, from, from.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetIDsCreatedBetween failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, want[:2]) {
+		t.Fatalf("got ids %v, want %v (oldest first, without cancelled)", got, want[:2])
+	}
+
+	sample, err := repo.GetSampleIDs(ctx, 2)
+	if err != nil {
+		t.Fatalf("GetSampleIDs failed: %v", err)
+	}
+	if len(sample) != 2 || sample[0] == sample[1] {
+		t.Fatalf("want 2 distinct ids, got %v", sample)
+	}
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/models"
+)
+
+const (
+	queryUpsertOffset = `
+						INSERT INTO consumer_offsets (group_id, topic, partition_id, next_offset)
+						VALUES ($1, $2, $3, $4)
+						ON CONFLICT (group_id, topic, partition_id) DO UPDATE SET next_offset = EXCLUDED.next_offset, updated_at = now()`
+
+	querySelectOffsets = `
+			SELECT c.partition_id, c.next_offset
+			FROM consumer_offsets AS c
+			WHERE c.group_id = $1 AND c.topic = $2
+			`
+)
+
+// SaveOffset запоминает позицию консьюмера. Внутри CreateFullOrderAt идет в той же транзакции, что и заказ
+func (r *Repo) SaveOffset(ctx context.Context, offset models.PartitionOffset) error {
+	_, err := r.executor().Exec(ctx, queryUpsertOffset, offset.Group, offset.Topic, offset.Partition, offset.Offset)
+	if err != nil {
+		return fmt.Errorf("error while saving consumer offset in repository: %w", err)
+	}
+	return nil
+}
+
+// LoadOffsets - сохраненные позиции группы по партициям топика
+func (r *Repo) LoadOffsets(ctx context.Context, group, topic string) (map[int32]int64, error) {
+	rows, err := r.executor().Query(ctx, querySelectOffsets, group, topic)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[int32]int64)
+	for rows.Next() {
+		var partition int32
+		var offset int64
+		if err = rows.Scan(&partition, &offset); err != nil {
+			return nil, fmt.Errorf("error while scanning consumer offsets in repository: %w", err)
+		}
+		result[partition] = offset
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error in repository LoadOffsets: %w", rows.Err())
+	}
+	return result, nil
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/apperror"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	queryInsertQuarantine = `
+						INSERT INTO quarantine (topic, partition_id, record_offset, record_key, record_value, headers, reason, error)
+						VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+						ON CONFLICT (topic, partition_id, record_offset) DO NOTHING`
+
+	querySelectQuarantine = `
+			SELECT
+			q.id, q.topic,
+			q.partition_id, q.record_offset,
+			q.record_key, q.record_value,
+			q.headers, q.reason,
+			q.error, q.created_at,
+			q.released_at
+			FROM quarantine AS q
+			`
+
+	queryClaimQuarantine = `
+			UPDATE quarantine AS q SET released_at = now()
+			WHERE q.id = $1 AND q.released_at IS NULL
+			RETURNING
+			q.id, q.topic,
+			q.partition_id, q.record_offset,
+			q.record_key, q.record_value,
+			q.headers, q.reason,
+			q.error, q.created_at,
+			q.released_at`
+
+	queryUnclaimQuarantine = `UPDATE quarantine SET released_at = NULL WHERE id = $1`
+)
+
+// Quarantine сохраняет запись, повторная запись того же оффсета игнорируется
+func (r *Repo) Quarantine(ctx context.Context, record *models.QuarantinedRecord) error {
+	headers := record.Headers
+	if headers == nil {
+		headers = []models.Header{}
+	}
+	_, err := r.executor().Exec(ctx, queryInsertQuarantine, record.Topic, record.Partition, record.Offset,
+		record.Key, record.Value, headers, record.Reason, record.Error)
+	if err != nil {
+		return fmt.Errorf("error while quarantining record in repository: %w", err)
+	}
+	return nil
+}
+
+// ListQuarantined - еще не отпущенные записи, старые первыми
+func (r *Repo) ListQuarantined(ctx context.Context, limit int) ([]models.QuarantinedRecord, error) {
+	rows, err := r.executor().Query(ctx, querySelectQuarantine+`WHERE q.released_at IS NULL ORDER BY q.id LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.QuarantinedRecord
+	for rows.Next() {
+		record, err := scanQuarantined(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error while scanning quarantine in repository: %w", err)
+		}
+		result = append(result, *record)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error in repository ListQuarantined: %w", rows.Err())
+	}
+	return result, nil
+}
+
+func (r *Repo) GetQuarantined(ctx context.Context, id int64) (*models.QuarantinedRecord, error) {
+	record, err := scanQuarantined(r.executor().QueryRow(ctx, querySelectQuarantine+`WHERE q.id = $1`, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperror.ErrNotFound
+		}
+		return nil, fmt.Errorf("error while getting quarantined record in repository: %w", err)
+	}
+	return record, nil
+}
+
+// ClaimQuarantined одним UPDATE помечает запись отпущенной и отдает ее: из двух одновременных release
+// запись достанется одному. ErrNotFound - если ее нет или она уже отпущена
+func (r *Repo) ClaimQuarantined(ctx context.Context, id int64) (*models.QuarantinedRecord, error) {
+	record, err := scanQuarantined(r.executor().QueryRow(ctx, queryClaimQuarantine, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, apperror.ErrNotFound
+		}
+		return nil, fmt.Errorf("error while claiming quarantined record in repository: %w", err)
+	}
+	return record, nil
+}
+
+// UnclaimQuarantined возвращает запись в карантин, если отпустить ее не получилось
+func (r *Repo) UnclaimQuarantined(ctx context.Context, id int64) error {
+	if _, err := r.executor().Exec(ctx, queryUnclaimQuarantine, id); err != nil {
+		return fmt.Errorf("error while returning record to quarantine in repository: %w", err)
+	}
+	return nil
+}
+
+func scanQuarantined(row pgx.Row) (*models.QuarantinedRecord, error) {
+	var record models.QuarantinedRecord
+	err := row.Scan(
+		&record.Id, &record.Topic,
+		&record.Partition, &record.Offset,
+		&record.Key, &record.Value,
+		&record.Headers, &record.Reason,
+		&record.Error, &record.CreatedAt,
+		&record.ReleasedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/apperror"
+	"github.com/GameXost/wbTestCase/internal/models"
+)
+
+const (
+	queryInsertRawOrder = `
+						INSERT INTO raw_orders (order_uid, topic, partition_id, record_offset, headers, value, payload, received_at)
+						VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	querySelectRawOrders = `
+			SELECT
+			r.order_uid, r.topic,
+			r.partition_id, r.record_offset,
+			r.headers, r.value,
+			r.received_at
+			FROM raw_orders AS r
+			WHERE r.order_uid > $1
+			ORDER BY r.order_uid
+			LIMIT $2
+			`
+
+	queryUpdateOrder = `
+						UPDATE orders SET track_number = $2, entry = $3, locale = $4, internal_signature = $5, customer_id = $6,
+						delivery_service = $7, shardkey = $8, sm_id = $9, date_created = $10, oof_shard = $11
+						WHERE order_uid = $1`
+
+	queryDeleteOrderParts = `
+						WITH i AS (DELETE FROM items WHERE order_uid = $1),
+						p AS (DELETE FROM payment WHERE order_id = $1)
+						DELETE FROM delivery WHERE order_uid = $1`
+)
+
+func (r *Repo) createRawOrder(ctx context.Context, raw *models.RawOrder) error {
+	headers := raw.Headers
+	if headers == nil {
+		headers = []models.Header{}
+	}
+	// json дополнительно кладем в jsonb, чтобы по нему можно было искать
+	var payload []byte
+	if json.Valid(raw.Value) {
+		payload = raw.Value
+	}
+	_, err := r.executor().Exec(ctx, queryInsertRawOrder, raw.OrderUId, raw.Topic, raw.Partition, raw.Offset,
+		headers, raw.Value, payload, raw.ReceivedAt)
+	if err != nil {
+		return fmt.Errorf("error while saving raw order in repository: %w", err)
+	}
+	return nil
+}
+
+// ListRawOrders - сохраненные записи по порядку uid, начиная после afterUID (для первой пачки пустой)
+func (r *Repo) ListRawOrders(ctx context.Context, afterUID string, limit int) ([]models.RawOrder, error) {
+	rows, err := r.executor().Query(ctx, querySelectRawOrders, afterUID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.RawOrder
+	for rows.Next() {
+		var raw models.RawOrder
+		err = rows.Scan(&raw.OrderUId, &raw.Topic, &raw.Partition, &raw.Offset, &raw.Headers, &raw.Value, &raw.ReceivedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error while scanning raw orders in repository: %w", err)
+		}
+		result = append(result, raw)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error in repository ListRawOrders: %w", rows.Err())
+	}
+	return result, nil
+}
+
+// RebuildOrder перезаписывает нормализованные таблицы заказа одной транзакцией (отмена заказа сохраняется).
+// ErrNotFound - заказа нет
+func (r *Repo) RebuildOrder(ctx context.Context, order *models.Order) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	tag, err := tx.Exec(ctx, queryUpdateOrder, order.OrderUId, order.TrackNumber, order.Entry, order.Locale, order.InternalSignature,
+		order.CustomerId, order.DeliveryService, order.Shardkey, order.SmId, order.DateCreated, order.OofShard)
+	if err != nil {
+		return fmt.Errorf("error while updating base order in repository: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return apperror.ErrNotFound
+	}
+	if _, err = tx.Exec(ctx, queryDeleteOrderParts, order.OrderUId); err != nil {
+		return fmt.Errorf("error while deleting order parts in repository: %w", err)
+	}
+	if err = r.repoWithTX(tx).createOrderParts(ctx, order); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error transaction commit in repository - RebuildOrder: %w", err)
+	}
+	return nil
+}
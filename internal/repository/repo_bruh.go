@@ -30,7 +30,7 @@ const (
 		o.shardkey, o.sm_id,
 		o.date_created, o.oof_shard
 		FROM orders AS o
-		WHERE o.order_uid = $1;
+		WHERE o.order_uid = $1 AND o.cancelled_at IS NULL;
 		`
 
 	queryPayment = `
@@ -53,7 +53,8 @@ const (
 			i.nm_id, i.brand,
 			i.status
 			FROM items AS i
-			WHERE i.order_uid = $1;
+			WHERE i.order_uid = $1
+			ORDER BY i.id;
 			`
 )
 const (
@@ -100,7 +101,19 @@ func (r *Repo) executor() dbExecutor {
 	return r.tx
 }
 
-func (r *Repo) CreateFullOrder(ctx context.Context, order *models.Order) error {
+// CreateFullOrder сохраняет заказ, ErrDuplicate - такой order_uid уже есть (ничего не записано).
+// raw - запись кафки, из которой собран заказ, ложится в raw_orders той же транзакцией; nil - не сохранять
+func (r *Repo) CreateFullOrder(ctx context.Context, order *models.Order, raw *models.RawOrder) error {
+	return r.createFullOrder(ctx, order, raw, nil)
+}
+
+// CreateFullOrderAt сохраняет заказ и оффсет консьюмера одной транзакцией:
+// либо есть и заказ, и сдвинутая позиция, либо ничего. На дубле оффсет сдвигается и возвращается ErrDuplicate
+func (r *Repo) CreateFullOrderAt(ctx context.Context, order *models.Order, raw *models.RawOrder, offset models.PartitionOffset) error {
+	return r.createFullOrder(ctx, order, raw, &offset)
+}
+
+func (r *Repo) createFullOrder(ctx context.Context, order *models.Order, raw *models.RawOrder, offset *models.PartitionOffset) error {
 	tx, err := r.pool.Begin(ctx)
 	if err != nil {
 		return err
@@ -115,31 +128,61 @@ func (r *Repo) CreateFullOrder(ctx context.Context, order *models.Order) error {
 	if err != nil {
 		return fmt.Errorf("error while creating base order in repository: %w", err)
 	}
+	if !isNewOrder && offset == nil {
+		return apperror.ErrDuplicate
+	}
+
+	// дубль: заказ уже есть, но оффсет все равно надо сдвинуть
+	if isNewOrder {
+		if err = txRepo.createOrderParts(ctx, order); err != nil {
+			return err
+		}
+		if raw != nil {
+			if err = txRepo.createRawOrder(ctx, raw); err != nil {
+				return err
+			}
+		}
+	}
+
+	if offset != nil {
+		if err = txRepo.SaveOffset(ctx, *offset); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error transaction commit in repository - CreateFullOrder: %w", err)
+	}
 	if !isNewOrder {
-		return nil
+		return apperror.ErrDuplicate
 	}
 
-	err = txRepo.createPayment(ctx, &order.Payment)
+	return nil
+}
+
+// createOrderParts пишет части заказа под его uid: protobuf и avro не несут uid во вложенных структурах
+func (r *Repo) createOrderParts(ctx context.Context, order *models.Order) error {
+	payment := order.Payment
+	payment.OrderId = order.OrderUId
+	err := r.createPayment(ctx, &payment)
 	if err != nil {
 		return fmt.Errorf("error while creating payment in repository: %w", err)
 	}
 
-	err = txRepo.createDelivery(ctx, &order.Delivery)
+	delivery := order.Delivery
+	delivery.OrderUId = order.OrderUId
+	err = r.createDelivery(ctx, &delivery)
 	if err != nil {
 		return fmt.Errorf("error while creating delivery in repository: %w", err)
 	}
 
 	for _, item := range order.Items {
-		err = txRepo.createItem(ctx, &item)
+		item.OrderUId = order.OrderUId
+		err = r.createItem(ctx, &item)
 		if err != nil {
 			return fmt.Errorf("error while creating item in repository: %w", err)
 		}
 	}
-
-	if err = tx.Commit(ctx); err != nil {
-		return fmt.Errorf("error transaction commit in repository - CreateFullOrder: %w", err)
-	}
-
 	return nil
 }
 
@@ -185,6 +228,47 @@ func (r *Repo) GetFullOrderOnId(ctx context.Context, OrderUId string) (*models.O
 
 }
 
+// GetFullOrdersOnIds достает пачку заказов одним запросом, ненайденные uid просто отсутствуют в результате
+func (r *Repo) GetFullOrdersOnIds(ctx context.Context, ids []string) ([]*models.Order, error) {
+	rows, err := r.executor().Query(ctx, queryFullOrders, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*models.Order, 0, len(ids))
+	for rows.Next() {
+		var order models.Order
+		err = rows.Scan(
+			&order.OrderUId, &order.TrackNumber,
+			&order.Entry, &order.Locale,
+			&order.InternalSignature, &order.CustomerId,
+			&order.DeliveryService, &order.Shardkey,
+			&order.SmId, &order.DateCreated,
+			&order.OofShard,
+			&order.Delivery.Id, &order.Delivery.Name,
+			&order.Delivery.Phone, &order.Delivery.Zip,
+			&order.Delivery.City, &order.Delivery.Address,
+			&order.Delivery.Region, &order.Delivery.Email,
+			&order.Payment.Transaction, &order.Payment.RequestId,
+			&order.Payment.Currency, &order.Payment.Provider,
+			&order.Payment.Amount, &order.Payment.PaymentDt,
+			&order.Payment.Bank, &order.Payment.DeliveryCost,
+			&order.Payment.GoodsTotal, &order.Payment.CustomFee,
+			&order.Items,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error while scanning orders in repository GetFullOrdersOnIds: %w", err)
+		}
+		order.Delivery.OrderUId = order.OrderUId
+		result = append(result, &order)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error in repository GetFullOrdersOnIds: %w", rows.Err())
+	}
+	return result, nil
+}
+
 func (r *Repo) GetRecentIDs(ctx context.Context, amount uint64) ([]string, error) {
 	result := make([]string, 0, amount)
 	rows, err := r.executor().Query(ctx, queryIDs, amount)
@@ -328,4 +412,40 @@ func (r *Repo) createBaseOrder(ctx context.Context, order *models.Order) (bool,
 	return tag.RowsAffected() > 0, nil
 }
 
-const queryIDs = `SELECT o.order_uid FROM orders AS o  ORDER BY date_created DESC LIMIT $1`
+const queryIDs = `SELECT o.order_uid FROM orders AS o WHERE o.cancelled_at IS NULL ORDER BY date_created DESC LIMIT $1`
+
+// один запрос на пачку заказов для прогрева кэша, items собираются в json массив
+const queryFullOrders = `
+		SELECT
+		o.order_uid, o.track_number,
+		o.entry, o.locale,
+		o.internal_signature, o.customer_id,
+		o.delivery_service, o.shardkey,
+		o.sm_id, o.date_created,
+		o.oof_shard,
+		d.id, d.name,
+		d.phone, d.zip,
+		d.city, d.address,
+		d.region, d.email,
+		p.transaction, p.request_id,
+		p.currency, p.provider,
+		p.amount, p.payment_dt,
+		p.bank, p.delivery_cost,
+		p.goods_total, p.custom_fee,
+		COALESCE((
+			SELECT json_agg(json_build_object(
+				'chrt_id', i.chrt_id, 'track_number', i.track_number,
+				'price', i.price, 'rid', i.rid,
+				'name', i.name, 'sale', i.sale,
+				'size', i.size, 'total_price', i.total_price,
+				'nm_id', i.nm_id, 'brand', i.brand,
+				'status', i.status
+			) ORDER BY i.id)
+			FROM items AS i
+			WHERE i.order_uid = o.order_uid
+		), '[]')
+		FROM orders AS o
+		JOIN delivery AS d ON d.order_uid = o.order_uid
+		JOIN payment AS p ON p.order_id = o.order_uid
+		WHERE o.order_uid = ANY($1) AND o.cancelled_at IS NULL;
+		`
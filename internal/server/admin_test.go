@@ -0,0 +1,37 @@
+package server
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminAuth(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{"right token", "secret", "Bearer secret", http.StatusOK},
+		{"wrong token", "secret", "Bearer other", http.StatusUnauthorized},
+		{"no header", "secret", "", http.StatusUnauthorized},
+		{"not bearer", "secret", "Basic secret", http.StatusUnauthorized},
+		{"empty token configured", "", "Bearer ", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/quarantine/1/release", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			AdminAuth(tt.token)(ok).ServeHTTP(w, req)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
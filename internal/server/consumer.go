@@ -0,0 +1,24 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"log"
+	"net/http"
+)
+
+type ConsumerMonitor interface {
+	Status() models.ConsumerStatus
+}
+
+// ConsumerStatus - GET /admin/consumer, назначенные партиции, оффсеты и лаг
+func (h *Handler) ConsumerStatus(w http.ResponseWriter, r *http.Request) {
+	status := h.Consumer.Status()
+	if status.Partitions == nil {
+		status.Partitions = []models.PartitionStatus{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.Printf("failed to encode response: %v", err)
+	}
+}
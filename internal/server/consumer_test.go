@@ -0,0 +1,31 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandlerConsumerStatus(t *testing.T) {
+	consumer := NewMockConsumerMonitor(t)
+	handler := NewHandler(NewMockOrderService(t))
+	handler.Consumer = consumer
+	status := models.ConsumerStatus{
+		Group:      "order_consumers",
+		Host:       "host",
+		Partitions: []models.PartitionStatus{{Topic: "orders", Partition: 1, Committed: 10, Processed: 12, Lag: 3}},
+	}
+	consumer.EXPECT().Status().Return(status)
+
+	w := httptest.NewRecorder()
+	handler.ConsumerStatus(w, httptest.NewRequest(http.MethodGet, "/admin/consumer", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var got models.ConsumerStatus
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	assert.Equal(t, status, got)
+}
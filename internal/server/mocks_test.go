@@ -105,3 +105,226 @@ func (_c *MockOrderService_GetOrder_Call) RunAndReturn(run func(ctx context.Cont
 	_c.Call.Return(run)
 	return _c
 }
+
+// NewMockQuarantineService creates a new instance of MockQuarantineService. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockQuarantineService(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockQuarantineService {
+	mock := &MockQuarantineService{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
+
+// MockQuarantineService is an autogenerated mock type for the QuarantineService type
+type MockQuarantineService struct {
+	mock.Mock
+}
+
+type MockQuarantineService_Expecter struct {
+	mock *mock.Mock
+}
+
+func (_m *MockQuarantineService) EXPECT() *MockQuarantineService_Expecter {
+	return &MockQuarantineService_Expecter{mock: &_m.Mock}
+}
+
+// ListQuarantined provides a mock function for the type MockQuarantineService
+func (_mock *MockQuarantineService) ListQuarantined(ctx context.Context, limit int) ([]models.QuarantinedRecord, error) {
+	ret := _mock.Called(ctx, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListQuarantined")
+	}
+
+	var r0 []models.QuarantinedRecord
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, int) ([]models.QuarantinedRecord, error)); ok {
+		return returnFunc(ctx, limit)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context, int) []models.QuarantinedRecord); ok {
+		r0 = returnFunc(ctx, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]models.QuarantinedRecord)
+		}
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context, int) error); ok {
+		r1 = returnFunc(ctx, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockQuarantineService_ListQuarantined_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ListQuarantined'
+type MockQuarantineService_ListQuarantined_Call struct {
+	*mock.Call
+}
+
+// ListQuarantined is a helper method to define mock.On call
+//   - ctx context.Context
+//   - limit int
+func (_e *MockQuarantineService_Expecter) ListQuarantined(ctx interface{}, limit interface{}) *MockQuarantineService_ListQuarantined_Call {
+	return &MockQuarantineService_ListQuarantined_Call{Call: _e.mock.On("ListQuarantined", ctx, limit)}
+}
+
+func (_c *MockQuarantineService_ListQuarantined_Call) Run(run func(ctx context.Context, limit int)) *MockQuarantineService_ListQuarantined_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 context.Context
+		if args[0] != nil {
+			arg0 = args[0].(context.Context)
+		}
+		var arg1 int
+		if args[1] != nil {
+			arg1 = args[1].(int)
+		}
+		run(
+			arg0,
+			arg1,
+		)
+	})
+	return _c
+}
+
+func (_c *MockQuarantineService_ListQuarantined_Call) Return(quarantinedRecords []models.QuarantinedRecord, err error) *MockQuarantineService_ListQuarantined_Call {
+	_c.Call.Return(quarantinedRecords, err)
+	return _c
+}
+
+func (_c *MockQuarantineService_ListQuarantined_Call) RunAndReturn(run func(ctx context.Context, limit int) ([]models.QuarantinedRecord, error)) *MockQuarantineService_ListQuarantined_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// ReleaseQuarantined provides a mock function for the type MockQuarantineService
+func (_mock *MockQuarantineService) ReleaseQuarantined(ctx context.Context, id int64) error {
+	ret := _mock.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ReleaseQuarantined")
+	}
+
+	var r0 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, int64) error); ok {
+		r0 = returnFunc(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+	return r0
+}
+
+// MockQuarantineService_ReleaseQuarantined_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ReleaseQuarantined'
+type MockQuarantineService_ReleaseQuarantined_Call struct {
+	*mock.Call
+}
+
+// ReleaseQuarantined is a helper method to define mock.On call
+//   - ctx context.Context
+//   - id int64
+func (_e *MockQuarantineService_Expecter) ReleaseQuarantined(ctx interface{}, id interface{}) *MockQuarantineService_ReleaseQuarantined_Call {
+	return &MockQuarantineService_ReleaseQuarantined_Call{Call: _e.mock.On("ReleaseQuarantined", ctx, id)}
+}
+
+func (_c *MockQuarantineService_ReleaseQuarantined_Call) Run(run func(ctx context.Context, id int64)) *MockQuarantineService_ReleaseQuarantined_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 context.Context
+		if args[0] != nil {
+			arg0 = args[0].(context.Context)
+		}
+		var arg1 int64
+		if args[1] != nil {
+			arg1 = args[1].(int64)
+		}
+		run(
+			arg0,
+			arg1,
+		)
+	})
+	return _c
+}
+
+func (_c *MockQuarantineService_ReleaseQuarantined_Call) Return(err error) *MockQuarantineService_ReleaseQuarantined_Call {
+	_c.Call.Return(err)
+	return _c
+}
+
+func (_c *MockQuarantineService_ReleaseQuarantined_Call) RunAndReturn(run func(ctx context.Context, id int64) error) *MockQuarantineService_ReleaseQuarantined_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// NewMockConsumerMonitor creates a new instance of MockConsumerMonitor. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockConsumerMonitor(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockConsumerMonitor {
+	mock := &MockConsumerMonitor{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
+
+// MockConsumerMonitor is an autogenerated mock type for the ConsumerMonitor type
+type MockConsumerMonitor struct {
+	mock.Mock
+}
+
+type MockConsumerMonitor_Expecter struct {
+	mock *mock.Mock
+}
+
+func (_m *MockConsumerMonitor) EXPECT() *MockConsumerMonitor_Expecter {
+	return &MockConsumerMonitor_Expecter{mock: &_m.Mock}
+}
+
+// Status provides a mock function for the type MockConsumerMonitor
+func (_mock *MockConsumerMonitor) Status() models.ConsumerStatus {
+	ret := _mock.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Status")
+	}
+
+	var r0 models.ConsumerStatus
+	if returnFunc, ok := ret.Get(0).(func() models.ConsumerStatus); ok {
+		r0 = returnFunc()
+	} else {
+		r0 = ret.Get(0).(models.ConsumerStatus)
+	}
+	return r0
+}
+
+// MockConsumerMonitor_Status_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Status'
+type MockConsumerMonitor_Status_Call struct {
+	*mock.Call
+}
+
+// Status is a helper method to define mock.On call
+func (_e *MockConsumerMonitor_Expecter) Status() *MockConsumerMonitor_Status_Call {
+	return &MockConsumerMonitor_Status_Call{Call: _e.mock.On("Status")}
+}
+
+func (_c *MockConsumerMonitor_Status_Call) Run(run func()) *MockConsumerMonitor_Status_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *MockConsumerMonitor_Status_Call) Return(consumerStatus models.ConsumerStatus) *MockConsumerMonitor_Status_Call {
+	_c.Call.Return(consumerStatus)
+	return _c
+}
+
+func (_c *MockConsumerMonitor_Status_Call) RunAndReturn(run func() models.ConsumerStatus) *MockConsumerMonitor_Status_Call {
+	_c.Call.Return(run)
+	return _c
+}
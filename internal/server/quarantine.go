@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/GameXost/wbTestCase/internal/apperror"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultQuarantineLimit = 100
+	maxQuarantineLimit     = 1000
+)
+
+type QuarantineService interface {
+	ListQuarantined(ctx context.Context, limit int) ([]models.QuarantinedRecord, error)
+	ReleaseQuarantined(ctx context.Context, id int64) error
+}
+
+// ListQuarantined - GET /admin/quarantine?limit=N, записи, которые не удалось положить в dlq
+func (h *Handler) ListQuarantined(w http.ResponseWriter, r *http.Request) {
+	limit := defaultQuarantineLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 || parsed > maxQuarantineLimit {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	records, err := h.Quarantine.ListQuarantined(r.Context(), limit)
+	if err != nil {
+		log.Printf("failed to list quarantine: %v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if records == nil {
+		records = []models.QuarantinedRecord{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(records); err != nil {
+		log.Printf("failed to encode response: %v", err)
+	}
+}
+
+// ReleaseQuarantined - POST /admin/quarantine/{id}/release, отправляет запись в dlq
+func (h *Handler) ReleaseQuarantined(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "bad id", http.StatusBadRequest)
+		return
+	}
+
+	err = h.Quarantine.ReleaseQuarantined(r.Context(), id)
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, apperror.ErrNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	default:
+		log.Printf("failed to release quarantined record %d: %v", id, err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+	}
+}
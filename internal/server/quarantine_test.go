@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/GameXost/wbTestCase/internal/apperror"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func quarantineRouter(t *testing.T) (*MockQuarantineService, *chi.Mux) {
+	quarantine := NewMockQuarantineService(t)
+	handler := NewHandler(NewMockOrderService(t))
+	handler.Quarantine = quarantine
+
+	r := chi.NewRouter()
+	r.Get("/admin/quarantine", handler.ListQuarantined)
+	r.Post("/admin/quarantine/{id}/release", handler.ReleaseQuarantined)
+	return quarantine, r
+}
+
+func TestHandlerListQuarantined(t *testing.T) {
+	quarantine, r := quarantineRouter(t)
+	records := []models.QuarantinedRecord{{Id: 1, Topic: "orders", Key: []byte("k\x00\xff"), Reason: "invalid_json"}}
+	quarantine.EXPECT().ListQuarantined(mock.Anything, 5).Return(records, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/quarantine?limit=5", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var got []models.QuarantinedRecord
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&got))
+	assert.Equal(t, records[0].Key, got[0].Key)
+}
+
+func TestHandlerListQuarantinedBadLimit(t *testing.T) {
+	_, r := quarantineRouter(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/quarantine?limit=0", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandlerReleaseQuarantined(t *testing.T) {
+	quarantine, r := quarantineRouter(t)
+	quarantine.EXPECT().ReleaseQuarantined(mock.Anything, int64(7)).Return(nil)
+	quarantine.EXPECT().ReleaseQuarantined(mock.Anything, int64(8)).Return(apperror.ErrNotFound)
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/admin/quarantine/7/release", http.StatusNoContent},
+		{"/admin/quarantine/8/release", http.StatusNotFound},
+		{"/admin/quarantine/abc/release", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, tt.want, w.Code, tt.path)
+	}
+}
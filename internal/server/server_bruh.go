@@ -18,6 +18,9 @@ type OrderService interface {
 
 type Handler struct {
 	Service OrderService
+	// выставляется после старта консьюмера
+	Quarantine QuarantineService
+	Consumer   ConsumerMonitor
 }
 
 func NewHandler(srv OrderService) *Handler {
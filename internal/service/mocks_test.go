@@ -38,17 +38,80 @@ func (_m *MockOrderRepo) EXPECT() *MockOrderRepo_Expecter {
 	return &MockOrderRepo_Expecter{mock: &_m.Mock}
 }
 
+// CancelOrder provides a mock function for the type MockOrderRepo
+func (_mock *MockOrderRepo) CancelOrder(ctx context.Context, orderUID string, source string) error {
+	ret := _mock.Called(ctx, orderUID, source)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CancelOrder")
+	}
+
+	var r0 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = returnFunc(ctx, orderUID, source)
+	} else {
+		r0 = ret.Error(0)
+	}
+	return r0
+}
+
+// MockOrderRepo_CancelOrder_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CancelOrder'
+type MockOrderRepo_CancelOrder_Call struct {
+	*mock.Call
+}
+
+// CancelOrder is a helper method to define mock.On call
+//   - ctx context.Context
+//   - orderUID string
+//   - source string
+func (_e *MockOrderRepo_Expecter) CancelOrder(ctx interface{}, orderUID interface{}, source interface{}) *MockOrderRepo_CancelOrder_Call {
+	return &MockOrderRepo_CancelOrder_Call{Call: _e.mock.On("CancelOrder", ctx, orderUID, source)}
+}
+
+func (_c *MockOrderRepo_CancelOrder_Call) Run(run func(ctx context.Context, orderUID string, source string)) *MockOrderRepo_CancelOrder_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 context.Context
+		if args[0] != nil {
+			arg0 = args[0].(context.Context)
+		}
+		var arg1 string
+		if args[1] != nil {
+			arg1 = args[1].(string)
+		}
+		var arg2 string
+		if args[2] != nil {
+			arg2 = args[2].(string)
+		}
+		run(
+			arg0,
+			arg1,
+			arg2,
+		)
+	})
+	return _c
+}
+
+func (_c *MockOrderRepo_CancelOrder_Call) Return(err error) *MockOrderRepo_CancelOrder_Call {
+	_c.Call.Return(err)
+	return _c
+}
+
+func (_c *MockOrderRepo_CancelOrder_Call) RunAndReturn(run func(ctx context.Context, orderUID string, source string) error) *MockOrderRepo_CancelOrder_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // CreateFullOrder provides a mock function for the type MockOrderRepo
-func (_mock *MockOrderRepo) CreateFullOrder(ctx context.Context, order *models.Order) error {
-	ret := _mock.Called(ctx, order)
+func (_mock *MockOrderRepo) CreateFullOrder(ctx context.Context, order *models.Order, raw *models.RawOrder) error {
+	ret := _mock.Called(ctx, order, raw)
 
 	if len(ret) == 0 {
 		panic("no return value specified for CreateFullOrder")
 	}
 
 	var r0 error
-	if returnFunc, ok := ret.Get(0).(func(context.Context, *models.Order) error); ok {
-		r0 = returnFunc(ctx, order)
+	if returnFunc, ok := ret.Get(0).(func(context.Context, *models.Order, *models.RawOrder) error); ok {
+		r0 = returnFunc(ctx, order, raw)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -63,11 +126,12 @@ type MockOrderRepo_CreateFullOrder_Call struct {
 // CreateFullOrder is a helper method to define mock.On call
 //   - ctx context.Context
 //   - order *models.Order
-func (_e *MockOrderRepo_Expecter) CreateFullOrder(ctx interface{}, order interface{}) *MockOrderRepo_CreateFullOrder_Call {
-	return &MockOrderRepo_CreateFullOrder_Call{Call: _e.mock.On("CreateFullOrder", ctx, order)}
+//   - raw *models.RawOrder
+func (_e *MockOrderRepo_Expecter) CreateFullOrder(ctx interface{}, order interface{}, raw interface{}) *MockOrderRepo_CreateFullOrder_Call {
+	return &MockOrderRepo_CreateFullOrder_Call{Call: _e.mock.On("CreateFullOrder", ctx, order, raw)}
 }
 
-func (_c *MockOrderRepo_CreateFullOrder_Call) Run(run func(ctx context.Context, order *models.Order)) *MockOrderRepo_CreateFullOrder_Call {
+func (_c *MockOrderRepo_CreateFullOrder_Call) Run(run func(ctx context.Context, order *models.Order, raw *models.RawOrder)) *MockOrderRepo_CreateFullOrder_Call {
 	_c.Call.Run(func(args mock.Arguments) {
 		var arg0 context.Context
 		if args[0] != nil {
@@ -77,9 +141,14 @@ func (_c *MockOrderRepo_CreateFullOrder_Call) Run(run func(ctx context.Context,
 		if args[1] != nil {
 			arg1 = args[1].(*models.Order)
 		}
+		var arg2 *models.RawOrder
+		if args[2] != nil {
+			arg2 = args[2].(*models.RawOrder)
+		}
 		run(
 			arg0,
 			arg1,
+			arg2,
 		)
 	})
 	return _c
@@ -90,7 +159,76 @@ func (_c *MockOrderRepo_CreateFullOrder_Call) Return(err error) *MockOrderRepo_C
 	return _c
 }
 
-func (_c *MockOrderRepo_CreateFullOrder_Call) RunAndReturn(run func(ctx context.Context, order *models.Order) error) *MockOrderRepo_CreateFullOrder_Call {
+func (_c *MockOrderRepo_CreateFullOrder_Call) RunAndReturn(run func(ctx context.Context, order *models.Order, raw *models.RawOrder) error) *MockOrderRepo_CreateFullOrder_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// CreateFullOrderAt provides a mock function for the type MockOrderRepo
+func (_mock *MockOrderRepo) CreateFullOrderAt(ctx context.Context, order *models.Order, raw *models.RawOrder, offset models.PartitionOffset) error {
+	ret := _mock.Called(ctx, order, raw, offset)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CreateFullOrderAt")
+	}
+
+	var r0 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, *models.Order, *models.RawOrder, models.PartitionOffset) error); ok {
+		r0 = returnFunc(ctx, order, raw, offset)
+	} else {
+		r0 = ret.Error(0)
+	}
+	return r0
+}
+
+// MockOrderRepo_CreateFullOrderAt_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CreateFullOrderAt'
+type MockOrderRepo_CreateFullOrderAt_Call struct {
+	*mock.Call
+}
+
+// CreateFullOrderAt is a helper method to define mock.On call
+//   - ctx context.Context
+//   - order *models.Order
+//   - raw *models.RawOrder
+//   - offset models.PartitionOffset
+func (_e *MockOrderRepo_Expecter) CreateFullOrderAt(ctx interface{}, order interface{}, raw interface{}, offset interface{}) *MockOrderRepo_CreateFullOrderAt_Call {
+	return &MockOrderRepo_CreateFullOrderAt_Call{Call: _e.mock.On("CreateFullOrderAt", ctx, order, raw, offset)}
+}
+
+func (_c *MockOrderRepo_CreateFullOrderAt_Call) Run(run func(ctx context.Context, order *models.Order, raw *models.RawOrder, offset models.PartitionOffset)) *MockOrderRepo_CreateFullOrderAt_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 context.Context
+		if args[0] != nil {
+			arg0 = args[0].(context.Context)
+		}
+		var arg1 *models.Order
+		if args[1] != nil {
+			arg1 = args[1].(*models.Order)
+		}
+		var arg2 *models.RawOrder
+		if args[2] != nil {
+			arg2 = args[2].(*models.RawOrder)
+		}
+		var arg3 models.PartitionOffset
+		if args[3] != nil {
+			arg3 = args[3].(models.PartitionOffset)
+		}
+		run(
+			arg0,
+			arg1,
+			arg2,
+			arg3,
+		)
+	})
+	return _c
+}
+
+func (_c *MockOrderRepo_CreateFullOrderAt_Call) Return(err error) *MockOrderRepo_CreateFullOrderAt_Call {
+	_c.Call.Return(err)
+	return _c
+}
+
+func (_c *MockOrderRepo_CreateFullOrderAt_Call) RunAndReturn(run func(ctx context.Context, order *models.Order, raw *models.RawOrder, offset models.PartitionOffset) error) *MockOrderRepo_CreateFullOrderAt_Call {
 	_c.Call.Return(run)
 	return _c
 }
@@ -163,6 +301,74 @@ func (_c *MockOrderRepo_GetFullOrderOnId_Call) RunAndReturn(run func(ctx context
 	return _c
 }
 
+// GetFullOrdersOnIds provides a mock function for the type MockOrderRepo
+func (_mock *MockOrderRepo) GetFullOrdersOnIds(ctx context.Context, ids []string) ([]*models.Order, error) {
+	ret := _mock.Called(ctx, ids)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetFullOrdersOnIds")
+	}
+
+	var r0 []*models.Order
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, []string) ([]*models.Order, error)); ok {
+		return returnFunc(ctx, ids)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context, []string) []*models.Order); ok {
+		r0 = returnFunc(ctx, ids)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*models.Order)
+		}
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context, []string) error); ok {
+		r1 = returnFunc(ctx, ids)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockOrderRepo_GetFullOrdersOnIds_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'GetFullOrdersOnIds'
+type MockOrderRepo_GetFullOrdersOnIds_Call struct {
+	*mock.Call
+}
+
+// GetFullOrdersOnIds is a helper method to define mock.On call
+//   - ctx context.Context
+//   - ids []string
+func (_e *MockOrderRepo_Expecter) GetFullOrdersOnIds(ctx interface{}, ids interface{}) *MockOrderRepo_GetFullOrdersOnIds_Call {
+	return &MockOrderRepo_GetFullOrdersOnIds_Call{Call: _e.mock.On("GetFullOrdersOnIds", ctx, ids)}
+}
+
+func (_c *MockOrderRepo_GetFullOrdersOnIds_Call) Run(run func(ctx context.Context, ids []string)) *MockOrderRepo_GetFullOrdersOnIds_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 context.Context
+		if args[0] != nil {
+			arg0 = args[0].(context.Context)
+		}
+		var arg1 []string
+		if args[1] != nil {
+			arg1 = args[1].([]string)
+		}
+		run(
+			arg0,
+			arg1,
+		)
+	})
+	return _c
+}
+
+func (_c *MockOrderRepo_GetFullOrdersOnIds_Call) Return(orders []*models.Order, err error) *MockOrderRepo_GetFullOrdersOnIds_Call {
+	_c.Call.Return(orders, err)
+	return _c
+}
+
+func (_c *MockOrderRepo_GetFullOrdersOnIds_Call) RunAndReturn(run func(ctx context.Context, ids []string) ([]*models.Order, error)) *MockOrderRepo_GetFullOrdersOnIds_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // GetRecentIDs provides a mock function for the type MockOrderRepo
 func (_mock *MockOrderRepo) GetRecentIDs(ctx context.Context, amount uint64) ([]string, error) {
 	ret := _mock.Called(ctx, amount)
@@ -360,6 +566,46 @@ func (_c *MockOrderCache_LoadFull_Call) RunAndReturn(run func(ids []*models.Orde
 	return _c
 }
 
+// Remove provides a mock function for the type MockOrderCache
+func (_mock *MockOrderCache) Remove(key string) {
+	_mock.Called(key)
+	return
+}
+
+// MockOrderCache_Remove_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Remove'
+type MockOrderCache_Remove_Call struct {
+	*mock.Call
+}
+
+// Remove is a helper method to define mock.On call
+//   - key string
+func (_e *MockOrderCache_Expecter) Remove(key interface{}) *MockOrderCache_Remove_Call {
+	return &MockOrderCache_Remove_Call{Call: _e.mock.On("Remove", key)}
+}
+
+func (_c *MockOrderCache_Remove_Call) Run(run func(key string)) *MockOrderCache_Remove_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 string
+		if args[0] != nil {
+			arg0 = args[0].(string)
+		}
+		run(
+			arg0,
+		)
+	})
+	return _c
+}
+
+func (_c *MockOrderCache_Remove_Call) Return() *MockOrderCache_Remove_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockOrderCache_Remove_Call) RunAndReturn(run func(key string)) *MockOrderCache_Remove_Call {
+	_c.Run(run)
+	return _c
+}
+
 // Set provides a mock function for the type MockOrderCache
 func (_mock *MockOrderCache) Set(order *models.Order) {
 	_mock.Called(order)
@@ -399,3 +645,161 @@ func (_c *MockOrderCache_Set_Call) RunAndReturn(run func(order *models.Order)) *
 	_c.Run(run)
 	return _c
 }
+
+// NewMockMissCache creates a new instance of MockMissCache. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockMissCache(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockMissCache {
+	mock := &MockMissCache{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
+
+// MockMissCache is an autogenerated mock type for the MissCache type
+type MockMissCache struct {
+	mock.Mock
+}
+
+type MockMissCache_Expecter struct {
+	mock *mock.Mock
+}
+
+func (_m *MockMissCache) EXPECT() *MockMissCache_Expecter {
+	return &MockMissCache_Expecter{mock: &_m.Mock}
+}
+
+// Add provides a mock function for the type MockMissCache
+func (_mock *MockMissCache) Add(key string) {
+	_mock.Called(key)
+	return
+}
+
+// MockMissCache_Add_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Add'
+type MockMissCache_Add_Call struct {
+	*mock.Call
+}
+
+// Add is a helper method to define mock.On call
+//   - key string
+func (_e *MockMissCache_Expecter) Add(key interface{}) *MockMissCache_Add_Call {
+	return &MockMissCache_Add_Call{Call: _e.mock.On("Add", key)}
+}
+
+func (_c *MockMissCache_Add_Call) Run(run func(key string)) *MockMissCache_Add_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 string
+		if args[0] != nil {
+			arg0 = args[0].(string)
+		}
+		run(
+			arg0,
+		)
+	})
+	return _c
+}
+
+func (_c *MockMissCache_Add_Call) Return() *MockMissCache_Add_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockMissCache_Add_Call) RunAndReturn(run func(key string)) *MockMissCache_Add_Call {
+	_c.Run(run)
+	return _c
+}
+
+// Has provides a mock function for the type MockMissCache
+func (_mock *MockMissCache) Has(key string) bool {
+	ret := _mock.Called(key)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Has")
+	}
+
+	var r0 bool
+	if returnFunc, ok := ret.Get(0).(func(string) bool); ok {
+		r0 = returnFunc(key)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+	return r0
+}
+
+// MockMissCache_Has_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Has'
+type MockMissCache_Has_Call struct {
+	*mock.Call
+}
+
+// Has is a helper method to define mock.On call
+//   - key string
+func (_e *MockMissCache_Expecter) Has(key interface{}) *MockMissCache_Has_Call {
+	return &MockMissCache_Has_Call{Call: _e.mock.On("Has", key)}
+}
+
+func (_c *MockMissCache_Has_Call) Run(run func(key string)) *MockMissCache_Has_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 string
+		if args[0] != nil {
+			arg0 = args[0].(string)
+		}
+		run(
+			arg0,
+		)
+	})
+	return _c
+}
+
+func (_c *MockMissCache_Has_Call) Return(b bool) *MockMissCache_Has_Call {
+	_c.Call.Return(b)
+	return _c
+}
+
+func (_c *MockMissCache_Has_Call) RunAndReturn(run func(key string) bool) *MockMissCache_Has_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Remove provides a mock function for the type MockMissCache
+func (_mock *MockMissCache) Remove(key string) {
+	_mock.Called(key)
+	return
+}
+
+// MockMissCache_Remove_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Remove'
+type MockMissCache_Remove_Call struct {
+	*mock.Call
+}
+
+// Remove is a helper method to define mock.On call
+//   - key string
+func (_e *MockMissCache_Expecter) Remove(key interface{}) *MockMissCache_Remove_Call {
+	return &MockMissCache_Remove_Call{Call: _e.mock.On("Remove", key)}
+}
+
+func (_c *MockMissCache_Remove_Call) Run(run func(key string)) *MockMissCache_Remove_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 string
+		if args[0] != nil {
+			arg0 = args[0].(string)
+		}
+		run(
+			arg0,
+		)
+	})
+	return _c
+}
+
+func (_c *MockMissCache_Remove_Call) Return() *MockMissCache_Remove_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockMissCache_Remove_Call) RunAndReturn(run func(key string)) *MockMissCache_Remove_Call {
+	_c.Run(run)
+	return _c
+}
@@ -2,82 +2,212 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/GameXost/wbTestCase/internal/apperror"
 	"github.com/GameXost/wbTestCase/internal/models"
-	"github.com/go-playground/validator/v10"
+	"github.com/GameXost/wbTestCase/metrics"
 	"log"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type OrderRepo interface {
 	GetRecentIDs(ctx context.Context, amount uint64) ([]string, error)
-	CreateFullOrder(ctx context.Context, order *models.Order) error
+	CreateFullOrder(ctx context.Context, order *models.Order, raw *models.RawOrder) error
+	CreateFullOrderAt(ctx context.Context, order *models.Order, raw *models.RawOrder, offset models.PartitionOffset) error
 	GetFullOrderOnId(ctx context.Context, OrderUId string) (*models.Order, error)
+	GetFullOrdersOnIds(ctx context.Context, ids []string) ([]*models.Order, error)
+	CancelOrder(ctx context.Context, orderUID, source string) error
 }
 
 type OrderCache interface {
 	Get(key string) (*models.Order, bool)
 	Set(order *models.Order)
 	LoadFull(ids []*models.Order)
+	Remove(key string)
+}
+
+// MissCache - негативный кэш uid, которых нет в бд
+type MissCache interface {
+	Has(key string) bool
+	Add(key string)
+	Remove(key string)
 }
 
 type Service struct {
-	repo  OrderRepo
-	cache OrderCache
+	repo   OrderRepo
+	cache  OrderCache
+	misses MissCache
+	// растет на каждое сохранение: GetOrder по нему видит, что пока он ходил в бд, заказы создавались
+	created atomic.Uint64
 }
 
-func NewService(repo OrderRepo, cache OrderCache) *Service {
+// misses может быть nil, тогда негативное кэширование выключено
+func NewService(repo OrderRepo, cache OrderCache, misses MissCache) *Service {
+	if misses == nil {
+		misses = noMisses{}
+	}
 	return &Service{
-		repo:  repo,
-		cache: cache,
+		repo:   repo,
+		cache:  cache,
+		misses: misses,
 	}
 }
 
-func (s *Service) CreateOrder(ctx context.Context, order *models.Order) error {
+// CreateOrder валидирует и сохраняет заказ вместе с исходной записью raw (может быть nil).
+// ErrDuplicate - заказ уже был сохранен раньше
+func (s *Service) CreateOrder(ctx context.Context, order *models.Order, raw *models.RawOrder) error {
+	return s.createOrder(ctx, order, func() error {
+		return s.repo.CreateFullOrder(ctx, order, raw)
+	})
+}
+
+// CreateOrderAt - CreateOrder, который атомарно с заказом сохраняет оффсет консьюмера
+func (s *Service) CreateOrderAt(ctx context.Context, order *models.Order, raw *models.RawOrder, offset models.PartitionOffset) error {
+	return s.createOrder(ctx, order, func() error {
+		return s.repo.CreateFullOrderAt(ctx, order, raw, offset)
+	})
+}
+
+func (s *Service) createOrder(ctx context.Context, order *models.Order, save func() error) error {
 	if err := ValidateOrder(order); err != nil {
 		log.Printf("inalid order data: %v", err)
-		return apperror.ErrValidation
+		return fmt.Errorf("%w: %w", apperror.ErrValidation, err)
 	}
-	err := s.repo.CreateFullOrder(ctx, order)
+	err := save()
+	if err != nil && !errors.Is(err, apperror.ErrDuplicate) {
+		return err
+	}
+	// сначала поколение, потом Remove: промах, записанный после Remove, увидит новое поколение и снимется сам
+	s.created.Add(1)
+	s.misses.Remove(order.OrderUId)
 	if err != nil {
+		// заказ в бд есть, пусть кэш отдает его оттуда, а не из повторного сообщения
 		return err
 	}
 	s.cache.Set(order)
 	return nil
 }
 
+// CancelOrder отменяет заказ: в бд он остается, но больше не отдается. ErrNotFound - активного заказа нет
+func (s *Service) CancelOrder(ctx context.Context, orderUID, source string) error {
+	err := s.repo.CancelOrder(ctx, orderUID, source)
+	if err != nil && !errors.Is(err, apperror.ErrNotFound) {
+		return err
+	}
+	// выкидываем и на ErrNotFound: заказ могли отменить раньше, а кэш его еще держит
+	s.cache.Remove(orderUID)
+	return err
+}
+
 func (s *Service) GetOrder(ctx context.Context, orderUID string) (*models.Order, error) {
 	order, has := s.cache.Get(orderUID)
 	if has {
 		return order, nil
 	}
+	// негативный кэш смотрим только после основного: свежесозданный заказ уже лежит в основном кэше
+	if s.misses.Has(orderUID) {
+		metrics.NegativeCacheHits.Inc()
+		return nil, apperror.ErrNotFound
+	}
+	generation := s.created.Load()
 	order, err := s.repo.GetFullOrderOnId(ctx, orderUID)
 	if err != nil {
+		if errors.Is(err, apperror.ErrNotFound) {
+			s.rememberMiss(orderUID, generation)
+		}
 		return nil, err
 	}
 	s.cache.Set(order)
 	return order, nil
 }
 
-func (s *Service) LoadCache(ctx context.Context, cacheSize uint64) error {
+// rememberMiss кладет uid в негативный кэш. Если с чтения из бд что-то сохранилось, заказ мог создаться
+// между чтением и Add, и его Remove уже прошел - тогда запись снимаем, лучше лишний раз сходить в бд
+func (s *Service) rememberMiss(orderUID string, generation uint64) {
+	s.misses.Add(orderUID)
+	if s.created.Load() != generation {
+		s.misses.Remove(orderUID)
+	}
+}
+
+type WarmupOptions struct {
+	ChunkSize   int
+	Concurrency int
+}
+
+// LoadCache греет кэш последними заказами: uid режутся на пачки, каждая пачка - один запрос,
+// пачки грузятся параллельно, но в кэш попадают в порядке свежести.
+// Битая пачка не валит прогрев, она считается в метриках и логах
+func (s *Service) LoadCache(ctx context.Context, cacheSize uint64, opts WarmupOptions) error {
+	start := time.Now()
 	ids, err := s.repo.GetRecentIDs(ctx, cacheSize)
 	if err != nil {
 		return err
 	}
-	orders := make([]*models.Order, 0)
+	chunkSize := max(opts.ChunkSize, 1)
+	chunks := make([][]string, 0, len(ids)/chunkSize+1)
+	for from := 0; from < len(ids); from += chunkSize {
+		chunks = append(chunks, ids[from:min(from+chunkSize, len(ids))])
+	}
+
+	metrics.CacheWarmupProgress.Set(0)
+	results := make([][]*models.Order, len(chunks))
+	var loaded atomic.Int64
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(opts.Concurrency, 1))
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			orders, err := s.repo.GetFullOrdersOnIds(ctx, chunk)
+			if err != nil {
+				log.Printf("cache warmup: failed to load chunk of %d orders: %v", len(chunk), err)
+				metrics.CacheWarmupFailures.Add(float64(len(chunk)))
+			} else {
+				if missing := len(chunk) - len(orders); missing > 0 {
+					log.Printf("cache warmup: %d orders of chunk are incomplete or missing", missing)
+					metrics.CacheWarmupFailures.Add(float64(missing))
+				}
+				metrics.CacheWarmupLoaded.Add(float64(len(orders)))
+				results[i] = orders
+			}
+			done := loaded.Add(int64(len(chunk)))
+			metrics.CacheWarmupProgress.Set(float64(done) / float64(len(ids)))
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	byID := make(map[string]*models.Order, len(ids))
+	for _, orders := range results {
+		for _, order := range orders {
+			byID[order.OrderUId] = order
+		}
+	}
+	orders := make([]*models.Order, 0, len(byID))
 	for _, id := range ids {
-		order, err := s.repo.GetFullOrderOnId(ctx, id)
-		if err != nil {
-			log.Printf("some incorrect data %s with error: %v", id, err)
-			continue
+		if order, has := byID[id]; has {
+			orders = append(orders, order)
 		}
-		orders = append(orders, order)
 	}
 	s.cache.LoadFull(orders)
+
+	metrics.CacheWarmupProgress.Set(1)
+	metrics.CacheWarmupDuration.Set(time.Since(start).Seconds())
+	log.Printf("cache warmup: %d of %d orders loaded in %s", len(orders), len(ids), time.Since(start))
 	return nil
 }
 
-var validate = validator.New()
+type noMisses struct{}
 
-func ValidateOrder(order *models.Order) error {
-	return validate.Struct(order)
-}
+func (noMisses) Has(string) bool { return false }
+func (noMisses) Add(string)      {}
+func (noMisses) Remove(string)   {}
@@ -4,14 +4,16 @@ import (
 	"context"
 	"github.com/GameXost/wbTestCase/internal/apperror"
 	"github.com/GameXost/wbTestCase/internal/generator"
+	"github.com/GameXost/wbTestCase/internal/generator/generatortest"
 	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/go-playground/validator/v10"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"testing"
 )
 
 func TestValidateOrder(t *testing.T) {
-	for _, tt := range cases {
+	for _, tt := range validationCases(generatortest.New(t)) {
 		t.Run(tt.name, func(t *testing.T) {
 			got := ValidateOrder(&tt.order)
 			if got == nil {
@@ -26,7 +28,7 @@ func TestValidateOrder(t *testing.T) {
 func TestGetOrderCacheHit(t *testing.T) {
 	repo := NewMockOrderRepo(t)
 	cache := NewMockOrderCache(t)
-	serv := NewService(repo, cache)
+	serv := NewService(repo, cache, nil)
 
 	ord := &models.Order{OrderUId: "test1"}
 
@@ -39,7 +41,7 @@ func TestGetOrderCacheHit(t *testing.T) {
 func TestGetOrderCacheMiss(t *testing.T) {
 	repo := NewMockOrderRepo(t)
 	cache := NewMockOrderCache(t)
-	serv := NewService(repo, cache)
+	serv := NewService(repo, cache, nil)
 
 	ord := &models.Order{OrderUId: "test2"}
 
@@ -54,7 +56,7 @@ func TestGetOrderCacheMiss(t *testing.T) {
 func TestGetOrderNothingFound(t *testing.T) {
 	repo := NewMockOrderRepo(t)
 	cache := NewMockOrderCache(t)
-	serv := NewService(repo, cache)
+	serv := NewService(repo, cache, nil)
 
 	cache.EXPECT().Get("test3").Return(nil, false)
 	repo.EXPECT().GetFullOrderOnId(mock.Anything, "test3").Return(nil, apperror.ErrNotFound)
@@ -64,257 +66,457 @@ func TestGetOrderNothingFound(t *testing.T) {
 	assert.Nil(t, res)
 }
 
-var cases = []struct {
+func TestGetOrderRemembersNotFound(t *testing.T) {
+	repo := NewMockOrderRepo(t)
+	cache := NewMockOrderCache(t)
+	misses := NewMockMissCache(t)
+	serv := NewService(repo, cache, misses)
+
+	cache.EXPECT().Get("test4").Return(nil, false)
+	misses.EXPECT().Has("test4").Return(false)
+	repo.EXPECT().GetFullOrderOnId(mock.Anything, "test4").Return(nil, apperror.ErrNotFound)
+	misses.EXPECT().Add("test4")
+
+	res, err := serv.GetOrder(context.Background(), "test4")
+	assert.ErrorIs(t, err, apperror.ErrNotFound)
+	assert.Nil(t, res)
+}
+
+func TestGetOrderNegativeCacheHit(t *testing.T) {
+	repo := NewMockOrderRepo(t)
+	cache := NewMockOrderCache(t)
+	misses := NewMockMissCache(t)
+	serv := NewService(repo, cache, misses)
+
+	cache.EXPECT().Get("test5").Return(nil, false)
+	misses.EXPECT().Has("test5").Return(true)
+
+	res, err := serv.GetOrder(context.Background(), "test5")
+	assert.ErrorIs(t, err, apperror.ErrNotFound)
+	assert.Nil(t, res)
+}
+
+func TestGetOrderServerErrorNotRemembered(t *testing.T) {
+	repo := NewMockOrderRepo(t)
+	cache := NewMockOrderCache(t)
+	misses := NewMockMissCache(t)
+	serv := NewService(repo, cache, misses)
+
+	cache.EXPECT().Get("test6").Return(nil, false)
+	misses.EXPECT().Has("test6").Return(false)
+	repo.EXPECT().GetFullOrderOnId(mock.Anything, "test6").Return(nil, apperror.ErrServer)
+
+	_, err := serv.GetOrder(context.Background(), "test6")
+	assert.ErrorIs(t, err, apperror.ErrServer)
+}
+
+// заказ сохранился, пока GetOrder ходил в бд: промах, записанный после этого, не должен остаться в кэше
+func TestGetOrderDropsMissWhenOrderCreatedMeanwhile(t *testing.T) {
+	repo := NewMockOrderRepo(t)
+	cache := NewMockOrderCache(t)
+	misses := NewMockMissCache(t)
+	serv := NewService(repo, cache, misses)
+
+	ord := generatortest.New(t).ValidOrder("test11")
+	cache.EXPECT().Get("test11").Return(nil, false)
+	misses.EXPECT().Has("test11").Return(false)
+	repo.EXPECT().CreateFullOrder(mock.Anything, ord, (*models.RawOrder)(nil)).Return(nil)
+	cache.EXPECT().Set(ord)
+	repo.EXPECT().GetFullOrderOnId(mock.Anything, "test11").RunAndReturn(
+		func(ctx context.Context, _ string) (*models.Order, error) {
+			// бд ответила "нет", а консьюмер успел сохранить заказ до Add
+			assert.NoError(t, serv.CreateOrder(ctx, ord, nil))
+			return nil, apperror.ErrNotFound
+		})
+	var added bool
+	misses.EXPECT().Add("test11").Run(func(string) { added = true })
+	misses.EXPECT().Remove("test11").Run(func(string) { added = false })
+
+	_, err := serv.GetOrder(context.Background(), "test11")
+	assert.ErrorIs(t, err, apperror.ErrNotFound)
+	assert.False(t, added, "the miss is dropped after the order appeared")
+}
+
+func TestCreateOrderInvalidatesNegativeCache(t *testing.T) {
+	repo := NewMockOrderRepo(t)
+	cache := NewMockOrderCache(t)
+	misses := NewMockMissCache(t)
+	serv := NewService(repo, cache, misses)
+
+	ord := generatortest.New(t).ValidOrder("test7")
+
+	repo.EXPECT().CreateFullOrder(mock.Anything, ord, (*models.RawOrder)(nil)).Return(nil)
+	misses.EXPECT().Remove("test7")
+	cache.EXPECT().Set(ord)
+
+	assert.NoError(t, serv.CreateOrder(context.Background(), ord, nil))
+}
+
+func TestCreateOrderDuplicate(t *testing.T) {
+	repo := NewMockOrderRepo(t)
+	misses := NewMockMissCache(t)
+	serv := NewService(repo, NewMockOrderCache(t), misses)
+
+	ord := generatortest.New(t).ValidOrder("test10")
+	repo.EXPECT().CreateFullOrder(mock.Anything, ord, (*models.RawOrder)(nil)).Return(apperror.ErrDuplicate)
+	misses.EXPECT().Remove("test10")
+
+	assert.ErrorIs(t, serv.CreateOrder(context.Background(), ord, nil), apperror.ErrDuplicate)
+}
+
+func TestCreateOrderAtPassesOffset(t *testing.T) {
+	repo := NewMockOrderRepo(t)
+	cache := NewMockOrderCache(t)
+	serv := NewService(repo, cache, nil)
+
+	ord := generatortest.New(t).ValidOrder("test9")
+	offset := models.PartitionOffset{Group: "g", Topic: "orders", Partition: 2, Offset: 7}
+
+	repo.EXPECT().CreateFullOrderAt(mock.Anything, ord, (*models.RawOrder)(nil), offset).Return(nil)
+	cache.EXPECT().Set(ord)
+
+	assert.NoError(t, serv.CreateOrderAt(context.Background(), ord, nil, offset))
+}
+
+func TestCreateOrderKeepsViolations(t *testing.T) {
+	serv := NewService(NewMockOrderRepo(t), NewMockOrderCache(t), nil)
+
+	ord := generatortest.New(t).ValidOrder("test8")
+	ord.Payment.Amount = -1
+
+	err := serv.CreateOrder(context.Background(), ord, nil)
+	assert.ErrorIs(t, err, apperror.ErrValidation)
+	var violations validator.ValidationErrors
+	assert.ErrorAs(t, err, &violations)
+}
+
+func TestLoadCacheKeepsRecencyOrder(t *testing.T) {
+	repo := NewMockOrderRepo(t)
+	cache := NewMockOrderCache(t)
+	serv := NewService(repo, cache, nil)
+
+	ids := []string{"o5", "o4", "o3", "o2", "o1"}
+	repo.EXPECT().GetRecentIDs(mock.Anything, uint64(5)).Return(ids, nil)
+	repo.EXPECT().GetFullOrdersOnIds(mock.Anything, mock.Anything).RunAndReturn(
+		func(_ context.Context, chunk []string) ([]*models.Order, error) {
+			if chunk[0] == "o3" {
+				return nil, apperror.ErrServer
+			}
+			orders := make([]*models.Order, 0, len(chunk))
+			// бд не обязана отдавать в порядке uid
+			for i := len(chunk) - 1; i >= 0; i-- {
+				orders = append(orders, &models.Order{OrderUId: chunk[i]})
+			}
+			return orders, nil
+		}).Times(3)
+
+	var loaded []string
+	cache.EXPECT().LoadFull(mock.Anything).Run(func(orders []*models.Order) {
+		for _, order := range orders {
+			loaded = append(loaded, order.OrderUId)
+		}
+	})
+
+	err := serv.LoadCache(context.Background(), 5, WarmupOptions{ChunkSize: 2, Concurrency: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"o5", "o4", "o1"}, loaded)
+}
+
+type validationCase struct {
 	name  string
 	order models.Order
 	want  error
-}{
-	{
-		"correct",
-		*generator.ValidOrder("test"),
-		nil,
-	},
-	{
-		name: "no Items",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.Items = []models.Item{}
-			return ord
-		}(),
-		want: apperror.ErrItemsEmpty,
-	},
-	{
-		name: "no TrackNumber",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.TrackNumber = ""
-			return ord
-		}(),
-		want: apperror.ErrTrackNumberMissing,
-	},
-	{
-		name: "no OrderUId",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.OrderUId = ""
-			return ord
-		}(),
-		want: apperror.ErrOrderUIDMissing,
-	},
-	{
-		name: "no Entry",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.Entry = ""
-			return ord
-		}(),
-		want: apperror.ErrEntryMissing,
-	},
-	{
-		name: "no Locale",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.Locale = ""
-			return ord
-		}(),
-		want: apperror.ErrLocaleMissing,
-	},
-	{
-		name: "no CustomerID",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.CustomerId = ""
-			return ord
-		}(),
-		want: apperror.ErrCustomerIDMissing,
-	},
-	{
-		name: "no DeliveryService",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.DeliveryService = ""
-			return ord
-		}(),
-		want: apperror.ErrDeliveryServiceMissing,
-	},
-	{
-		name: "no Shardkey",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.Shardkey = ""
-			return ord
-		}(),
-		want: apperror.ErrShardkeyMissing,
-	},
-	{
-		name: "invalid SmId",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.SmId = 0
-			return ord
-		}(),
-		want: apperror.ErrInvalidSmID,
-	},
-	{
-		name: "no Delivery Name",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.Delivery.Name = ""
-			return ord
-		}(),
-		want: apperror.ErrDeliveryNameMissing,
-	},
-	{
-		name: "no Delivery Phone",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.Delivery.Phone = ""
-			return ord
-		}(),
-		want: apperror.ErrDeliveryPhoneMissing,
-	},
-	{
-		name: "no Delivery ZIP",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.Delivery.Zip = ""
-			return ord
-		}(),
-		want: apperror.ErrDeliveryZIPMissing,
-	},
-	{
-		name: "no Delivery City",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.Delivery.City = ""
-			return ord
-		}(),
-		want: apperror.ErrDeliveryCityMissing,
-	},
-	{
-		name: "no Delivery Address",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.Delivery.Address = ""
-			return ord
-		}(),
-		want: apperror.ErrDeliveryAddressMissing,
-	},
-	{
-		name: "no Delivery Region",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.Delivery.Region = ""
-			return ord
-		}(),
-		want: apperror.ErrDeliveryRegionMissing,
-	},
-	{
-		name: "no Delivery Email",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.Delivery.Email = ""
-			return ord
-		}(),
-		want: apperror.ErrDeliveryEmailMissing,
-	},
-	{
-		name: "no Payment Transaction",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.Payment.Transaction = ""
-			return ord
-		}(),
-		want: apperror.ErrPaymentTransactionMissing,
-	},
-	{
-		name: "no Payment Currency",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.Payment.Currency = ""
-			return ord
-		}(),
-		want: apperror.ErrPaymentCurrencyMissing,
-	},
-	{
-		name: "invalid Payment Amount",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.Payment.Amount = 0
-			return ord
-		}(),
-		want: apperror.ErrPaymentAmountInvalid,
-	},
-	{
-		name: "invalid Payment DeliveryCost",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.Payment.DeliveryCost = -1
-			return ord
-		}(),
-		want: apperror.ErrPaymentDeliveryInvalid,
-	},
-	{
-		name: "invalid Payment GoodsTotal",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.Payment.GoodsTotal = 0
-			return ord
-		}(),
-		want: apperror.ErrPaymentGoodsTotalInvalid,
-	},
-	{
-		name: "item name missing",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.Items[0].Name = ""
-			return ord
-		}(),
-		want: apperror.ErrItemNameMissing,
-	},
-	{
-		name: "item invalid ChrtId",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.Items[0].ChrtId = 0
-			return ord
-		}(),
-		want: apperror.ErrItemChrtMissing,
-	},
-	{
-		name: "item invalid Price",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.Items[0].Price = -1
-			return ord
-		}(),
-		want: apperror.ErrItemPriceInvalid,
-	},
-	{
-		name: "item invalid Sale",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.Items[0].Sale = -1
-			return ord
-		}(),
-		want: apperror.ErrItemSaleInvalid,
-	},
-	{
-		name: "item invalid TotalPrice",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.Items[0].TotalPrice = -1
-			return ord
-		}(),
-		want: apperror.ErrItemTotalPriceInvalid,
-	},
-	{
-		name: "item invalid Status",
-		order: func() models.Order {
-			ord := *generator.ValidOrder("test")
-			ord.Items[0].Status = -1
-			return ord
-		}(),
-		want: apperror.ErrStatusCodeInvalid,
-	},
+}
+
+func validationCases(g *generator.Generator) []validationCase {
+	return []validationCase{
+		{
+			"correct",
+			*g.ValidOrder("test"),
+			nil,
+		},
+		{
+			name: "no Items",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.Items = []models.Item{}
+				return ord
+			}(),
+			want: apperror.ErrItemsEmpty,
+		},
+		{
+			name: "no TrackNumber",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.TrackNumber = ""
+				return ord
+			}(),
+			want: apperror.ErrTrackNumberMissing,
+		},
+		{
+			name: "no OrderUId",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.OrderUId = ""
+				return ord
+			}(),
+			want: apperror.ErrOrderUIDMissing,
+		},
+		{
+			name: "no Entry",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.Entry = ""
+				return ord
+			}(),
+			want: apperror.ErrEntryMissing,
+		},
+		{
+			name: "no Locale",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.Locale = ""
+				return ord
+			}(),
+			want: apperror.ErrLocaleMissing,
+		},
+		{
+			name: "no CustomerID",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.CustomerId = ""
+				return ord
+			}(),
+			want: apperror.ErrCustomerIDMissing,
+		},
+		{
+			name: "no DeliveryService",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.DeliveryService = ""
+				return ord
+			}(),
+			want: apperror.ErrDeliveryServiceMissing,
+		},
+		{
+			name: "no Shardkey",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.Shardkey = ""
+				return ord
+			}(),
+			want: apperror.ErrShardkeyMissing,
+		},
+		{
+			name: "invalid SmId",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.SmId = 0
+				return ord
+			}(),
+			want: apperror.ErrInvalidSmID,
+		},
+		{
+			name: "no Delivery Name",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.Delivery.Name = ""
+				return ord
+			}(),
+			want: apperror.ErrDeliveryNameMissing,
+		},
+		{
+			name: "no Delivery Phone",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.Delivery.Phone = ""
+				return ord
+			}(),
+			want: apperror.ErrDeliveryPhoneMissing,
+		},
+		{
+			name: "no Delivery ZIP",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.Delivery.Zip = ""
+				return ord
+			}(),
+			want: apperror.ErrDeliveryZIPMissing,
+		},
+		{
+			name: "no Delivery City",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.Delivery.City = ""
+				return ord
+			}(),
+			want: apperror.ErrDeliveryCityMissing,
+		},
+		{
+			name: "no Delivery Address",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.Delivery.Address = ""
+				return ord
+			}(),
+			want: apperror.ErrDeliveryAddressMissing,
+		},
+		{
+			name: "no Delivery Region",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.Delivery.Region = ""
+				return ord
+			}(),
+			want: apperror.ErrDeliveryRegionMissing,
+		},
+		{
+			name: "no Delivery Email",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.Delivery.Email = ""
+				return ord
+			}(),
+			want: apperror.ErrDeliveryEmailMissing,
+		},
+		{
+			name: "no Payment Transaction",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.Payment.Transaction = ""
+				return ord
+			}(),
+			want: apperror.ErrPaymentTransactionMissing,
+		},
+		{
+			name: "no Payment Currency",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.Payment.Currency = ""
+				return ord
+			}(),
+			want: apperror.ErrPaymentCurrencyMissing,
+		},
+		{
+			name: "invalid Payment Amount",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.Payment.Amount = 0
+				return ord
+			}(),
+			want: apperror.ErrPaymentAmountInvalid,
+		},
+		{
+			name: "invalid Payment DeliveryCost",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.Payment.DeliveryCost = -1
+				return ord
+			}(),
+			want: apperror.ErrPaymentDeliveryInvalid,
+		},
+		{
+			name: "invalid Payment GoodsTotal",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.Payment.GoodsTotal = 0
+				return ord
+			}(),
+			want: apperror.ErrPaymentGoodsTotalInvalid,
+		},
+		{
+			name: "item name missing",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.Items[0].Name = ""
+				return ord
+			}(),
+			want: apperror.ErrItemNameMissing,
+		},
+		{
+			name: "item invalid ChrtId",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.Items[0].ChrtId = 0
+				return ord
+			}(),
+			want: apperror.ErrItemChrtMissing,
+		},
+		{
+			name: "item invalid Price",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.Items[0].Price = -1
+				return ord
+			}(),
+			want: apperror.ErrItemPriceInvalid,
+		},
+		{
+			name: "item invalid Sale",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.Items[0].Sale = -1
+				return ord
+			}(),
+			want: apperror.ErrItemSaleInvalid,
+		},
+		{
+			name: "item invalid TotalPrice",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.Items[0].TotalPrice = -1
+				return ord
+			}(),
+			want: apperror.ErrItemTotalPriceInvalid,
+		},
+		{
+			name: "item invalid Status",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.Items[0].Status = -1
+				return ord
+			}(),
+			want: apperror.ErrStatusCodeInvalid,
+		},
+		{
+			name: "bad email",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.Delivery.Email = "test at gmail.com"
+				return ord
+			}(),
+			want: apperror.ErrValidation,
+		},
+		{
+			name: "unknown currency",
+			order: func() models.Order {
+				ord := *g.ValidOrder("test")
+				ord.Payment.Currency = "RUR"
+				return ord
+			}(),
+			want: apperror.ErrValidation,
+		},
+	}
+}
+
+func TestCancelOrderEvictsCache(t *testing.T) {
+	repo := NewMockOrderRepo(t)
+	cache := NewMockOrderCache(t)
+	serv := NewService(repo, cache, nil)
+
+	repo.EXPECT().CancelOrder(mock.Anything, "test11", "orders/0@1").Return(nil)
+	cache.EXPECT().Remove("test11")
+	assert.NoError(t, serv.CancelOrder(context.Background(), "test11", "orders/0@1"))
+
+	repo.EXPECT().CancelOrder(mock.Anything, "test12", "orders/0@2").Return(apperror.ErrNotFound)
+	cache.EXPECT().Remove("test12")
+	assert.ErrorIs(t, serv.CancelOrder(context.Background(), "test12", "orders/0@2"), apperror.ErrNotFound)
+}
+
+func TestCancelOrderServerErrorKeepsCache(t *testing.T) {
+	repo := NewMockOrderRepo(t)
+	serv := NewService(repo, NewMockOrderCache(t), nil)
+
+	repo.EXPECT().CancelOrder(mock.Anything, "test13", "orders/0@3").Return(apperror.ErrServer)
+	assert.ErrorIs(t, serv.CancelOrder(context.Background(), "test13", "orders/0@3"), apperror.ErrServer)
 }
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"errors"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/go-playground/validator/v10"
+	"strconv"
+	"time"
+)
+
+var validate = newValidator()
+
+// на сколько date_created может убежать вперед из-за часов отправителя
+const maxClockSkew = time.Hour
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterStructValidation(validateOrderTotals, models.Order{})
+	return v
+}
+
+func ValidateOrder(order *models.Order) error {
+	return validate.Struct(order)
+}
+
+// Violations - нарушения валидации вида "поле: правило=параметр", по ним в dlq и отчетах видно, что не так с заказом
+func Violations(err error) []string {
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return nil
+	}
+	violations := make([]string, 0, len(errs))
+	for _, v := range errs {
+		violation := v.Namespace() + ": " + v.Tag()
+		if v.Param() != "" {
+			violation += "=" + v.Param()
+		}
+		violations = append(violations, violation)
+	}
+	return violations
+}
+
+// validateOrderTotals - то, что тегами не проверить: goods_total - сумма total_price позиций,
+// amount = goods_total + delivery_cost + custom_fee, и заказ создан не в будущем
+func validateOrderTotals(sl validator.StructLevel) {
+	order := sl.Current().Interface().(models.Order)
+	var goodsTotal int64
+	for _, item := range order.Items {
+		goodsTotal += item.TotalPrice
+	}
+	payment := order.Payment
+	if payment.GoodsTotal != goodsTotal {
+		sl.ReportError(payment.GoodsTotal, "Payment.GoodsTotal", "GoodsTotal", "items_total", strconv.FormatInt(goodsTotal, 10))
+	}
+	if amount := payment.GoodsTotal + payment.DeliveryCost + payment.CustomFee; payment.Amount != amount {
+		sl.ReportError(payment.Amount, "Payment.Amount", "Amount", "payment_total", strconv.FormatInt(amount, 10))
+	}
+	if order.DateCreated.After(time.Now().Add(maxClockSkew)) {
+		sl.ReportError(order.DateCreated, "DateCreated", "DateCreated", "not_future", "")
+	}
+}
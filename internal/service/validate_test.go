@@ -0,0 +1,84 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/GameXost/wbTestCase/internal/apperror"
+	"github.com/GameXost/wbTestCase/internal/generator/generatortest"
+	"github.com/GameXost/wbTestCase/internal/models"
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// violations - нарушения в виде "поле: тег=параметр"
+func violations(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var errs validator.ValidationErrors
+	require.True(t, errors.As(err, &errs), "want validation errors, got %v", err)
+	res := make([]string, 0, len(errs))
+	for _, e := range errs {
+		res = append(res, e.Namespace()+": "+e.Tag()+"="+e.Param())
+	}
+	return res
+}
+
+func TestValidateOrderTotals(t *testing.T) {
+	g := generatortest.New(t)
+	tests := []struct {
+		name   string
+		mutate func(o *models.Order)
+		want   []string
+	}{
+		{"consistent order", func(o *models.Order) {}, nil},
+		{"goods total differs from items", func(o *models.Order) {
+			o.Payment.GoodsTotal++
+			o.Payment.Amount++
+		}, []string{"Order.Payment.GoodsTotal: items_total="}},
+		{"amount differs from totals", func(o *models.Order) {
+			o.Payment.Amount += 100
+		}, []string{"Order.Payment.Amount: payment_total="}},
+		{"delivery and fee count in amount", func(o *models.Order) {
+			o.Payment.DeliveryCost += 10
+			o.Payment.CustomFee += 5
+			o.Payment.Amount += 15
+		}, nil},
+		{"created within clock skew", func(o *models.Order) {
+			o.DateCreated = time.Now().Add(maxClockSkew / 2)
+		}, nil},
+		{"created in future", func(o *models.Order) {
+			o.DateCreated = time.Now().Add(24 * time.Hour)
+		}, []string{"Order.DateCreated: not_future="}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := g.ValidOrder("totals")
+			tt.mutate(order)
+			got := violations(t, ValidateOrder(order))
+			if tt.want == nil {
+				assert.Empty(t, got)
+				return
+			}
+			require.Len(t, got, len(tt.want), "%v", got)
+			for i := range tt.want {
+				assert.Contains(t, got[i], tt.want[i])
+			}
+		})
+	}
+}
+
+func TestViolations(t *testing.T) {
+	order := generatortest.New(t).ValidOrder("violations")
+	order.TrackNumber = ""
+	order.Items[0].Sale = -1
+	err := fmt.Errorf("%w: %w", apperror.ErrValidation, ValidateOrder(order))
+	assert.Equal(t, []string{"Order.Items[0].Sale: gte=0", "Order.TrackNumber: required"}, Violations(err))
+
+	assert.Empty(t, Violations(apperror.ErrValidation))
+	assert.Empty(t, Violations(nil))
+}
@@ -11,6 +11,79 @@ var (
 		Name: "cache_misses_total",
 		Help: "total number of cache misses",
 	})
+	NegativeCacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "negative_cache_hits_total",
+		Help: "total number of requests answered not found by the negative cache",
+	})
+	CacheWarmupLoaded = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cache_warmup_orders_loaded_total",
+		Help: "total number of orders loaded into cache during warmup",
+	})
+	CacheWarmupFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cache_warmup_orders_failed_total",
+		Help: "total number of orders that failed to load during cache warmup",
+	})
+	CacheWarmupProgress = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cache_warmup_progress_ratio",
+		Help: "share of recent orders processed by the current cache warmup",
+	})
+	CacheWarmupDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cache_warmup_duration_seconds",
+		Help: "duration of the last completed cache warmup",
+	})
+	ConsumerCircuitOpen = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "kafka_consumer_circuit_open",
+		Help: "1 while the consumer has paused fetching because the database is unavailable",
+	})
+	DLQMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dlq_messages_total",
+		Help: "total number of records sent to the dead letter topic by failure reason",
+	}, []string{"reason"})
+	QuarantinedMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "dlq_quarantined_total",
+		Help: "total number of records saved to the quarantine table because the dead letter topic was unavailable",
+	}, []string{"reason"})
+	ConsumerStoppedPartitions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "kafka_consumer_stopped_partitions",
+		Help: "number of partitions stopped because a record could not be dead-lettered",
+	})
+	ConsumerRecordsConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_consumer_records_consumed_total",
+		Help: "total number of records taken into processing by the consumer",
+	}, []string{"topic", "partition"})
+	ConsumerRecordsPersisted = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kafka_consumer_records_persisted_total",
+		Help: "total number of orders saved to the database by the consumer",
+	})
+	ConsumerRecordsDuplicated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kafka_consumer_records_duplicated_total",
+		Help: "total number of records skipped because the order was already saved",
+	})
+	ConsumerKeyMismatches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_consumer_key_mismatches_total",
+		Help: "total number of records whose key does not match the order by action: dead_letter, rekeyed, ignored",
+	}, []string{"action"})
+	ConsumerTombstones = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_consumer_tombstones_total",
+		Help: "total number of tombstone records by result: cancelled, not_found",
+	}, []string{"result"})
+	ConsumerStageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kafka_consumer_stage_duration_seconds",
+		Help:    "duration of record processing stages: decode, persist (one attempt), dead_letter and total",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 16),
+	}, []string{"stage"})
+	ConsumerLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kafka_consumer_lag",
+		Help: "records between the group committed offset and the partition end",
+	}, []string{"topic", "partition"})
+	ConsumerCommitFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kafka_consumer_commit_failures_total",
+		Help: "total number of failed offset commits",
+	})
+	ConsumerRebalances = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_consumer_rebalances_total",
+		Help: "total number of partition assignment changes by event: assigned, revoked, lost",
+	}, []string{"event"})
 	RequestsTotal = prometheus.NewCounter(
 		prometheus.CounterOpts{
 			Name: "http_requests_total",